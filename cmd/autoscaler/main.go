@@ -11,6 +11,10 @@ import (
 func main() {
 	log.Print("starting server...")
 	http.HandleFunc("/spanner/autoscaler", spanner.Handler)
+	http.HandleFunc("/spanner/autoscaler/batch", spanner.BatchHandler)
+	http.HandleFunc("/spanner/autoscaler/digest", spanner.DigestHandler)
+	http.HandleFunc("/spanner/autoscaler/history", spanner.HistoryHandler)
+	http.HandleFunc("/spanner/autoscaler/config", spanner.ConfigHandler)
 
 	// Determine port for HTTP service.
 	port := os.Getenv("PORT")
@@ -0,0 +1,92 @@
+package spanner
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// AdaptiveThresholds widens the gap between scaleUpThreshold and scaleDownThreshold while the instance is flapping,
+// and restores it once the reversals age out of the window.
+type AdaptiveThresholds struct {
+	// WindowMinutes はスケールの向きの反転を数える期間です。デフォルトは 180 分です。
+	WindowMinutes float64 `json:"windowMinutes"`
+	// MaxReversals までの反転は許容し、それを超えた反転1回ごとに WidenPercent ずつ閾値を広げます。
+	MaxReversals int `json:"maxReversals"`
+	// WidenPercent は反転1回ごとに scaleUpThreshold を上げ、scaleDownThreshold を下げる幅 (ポイント) です。デフォルトは 5 です。
+	WidenPercent float64 `json:"widenPercent"`
+	// MaxWidenPercent は片側の閾値を広げる幅の上限 (ポイント) です。デフォルトは 15 です。
+	MaxWidenPercent float64 `json:"maxWidenPercent"`
+}
+
+// ThresholdAdjustment reports how the thresholds were widened because of recent flapping.
+type ThresholdAdjustment struct {
+	Reversals          int     `json:"reversals"`
+	WidenedBy          float64 `json:"widenedBy"`
+	ScaleUpThreshold   float64 `json:"scaleUpThreshold"`
+	ScaleDownThreshold float64 `json:"scaleDownThreshold"`
+}
+
+func (a *AdaptiveThresholds) applyDefaults() {
+	if a.WindowMinutes == 0 {
+		a.WindowMinutes = 180
+	}
+	if a.WidenPercent == 0 {
+		a.WidenPercent = 5
+	}
+	if a.MaxWidenPercent == 0 {
+		a.MaxWidenPercent = 15
+	}
+}
+
+func (a *AdaptiveThresholds) validate() error {
+	if a.WindowMinutes < 0 || a.MaxReversals < 0 || a.WidenPercent < 0 || a.MaxWidenPercent < 0 {
+		return errors.New("Invalid adaptiveThresholds.")
+	}
+	return nil
+}
+
+// adaptThresholds は直近の反転の回数に応じて閾値の間隔を広げた config を返します。
+// scaleUpThreshold は 100 (panicCPUThreshold を指定した場合はその値) を超えないように広げます。
+// 閾値を広げた場合はその内容を result に記録します。
+func adaptThresholds(config AutoscalerConfig, state instanceState, now time.Time, result *ScaleResult) AutoscalerConfig {
+	a := config.AdaptiveThresholds
+	if a == nil {
+		return config
+	}
+	window := time.Duration(a.WindowMinutes * float64(time.Minute))
+	reversals := countReversals(state.History, now.Add(-window))
+	if reversals <= a.MaxReversals {
+		return config
+	}
+	widen := math.Min(float64(reversals-a.MaxReversals)*a.WidenPercent, a.MaxWidenPercent)
+	ceiling := 100.0
+	if config.PanicCPUThreshold > 0 {
+		ceiling = config.PanicCPUThreshold
+	}
+	config.ScaleUpThreshold = math.Min(config.ScaleUpThreshold+widen, math.Max(config.ScaleUpThreshold, ceiling))
+	config.ScaleDownThreshold = math.Max(config.ScaleDownThreshold-widen, 0)
+	result.ThresholdAdjustment = &ThresholdAdjustment{
+		Reversals:          reversals,
+		WidenedBy:          widen,
+		ScaleUpThreshold:   config.ScaleUpThreshold,
+		ScaleDownThreshold: config.ScaleDownThreshold,
+	}
+	return config
+}
+
+// countReversals は since 以降の history でスケールアップとスケールダウンが入れ替わった回数を返します。
+func countReversals(history []historyEntry, since time.Time) int {
+	var reversals int
+	var last string
+	for _, e := range history {
+		if e.Time.Before(since) || (e.Action != actionScaleUp && e.Action != actionScaleDown) {
+			continue
+		}
+		if last != "" && last != e.Action {
+			reversals++
+		}
+		last = e.Action
+	}
+	return reversals
+}
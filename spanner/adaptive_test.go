@@ -0,0 +1,126 @@
+package spanner
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func flappingHistory(now time.Time, n int, age time.Duration) []historyEntry {
+	var history []historyEntry
+	for i := 0; i < n; i++ {
+		action := actionScaleUp
+		if i%2 == 1 {
+			action = actionScaleDown
+		}
+		history = append(history, historyEntry{Time: now.Add(-age + time.Duration(i)*time.Minute), Action: action})
+	}
+	return history
+}
+
+func TestAdaptThresholds(t *testing.T) {
+	now := time.Now()
+	a := &AdaptiveThresholds{WindowMinutes: 60, MaxReversals: 2, WidenPercent: 5, MaxWidenPercent: 12}
+	cases := []struct {
+		name     string
+		history  []historyEntry
+		wantUp   float64
+		wantDown float64
+		widened  bool
+	}{
+		{"stable", nil, 60, 30, false},
+		{"few reversals", flappingHistory(now, 3, 30*time.Minute), 60, 30, false},
+		{"flapping", flappingHistory(now, 5, 30*time.Minute), 70, 20, true},
+		{"heavy flapping is capped", flappingHistory(now, 10, 30*time.Minute), 72, 18, true},
+		{"flapping outside the window", flappingHistory(now, 10, 3*time.Hour), 60, 30, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := AutoscalerConfig{ScaleUpThreshold: 60, ScaleDownThreshold: 30, AdaptiveThresholds: a}
+			result := &ScaleResult{}
+			got := adaptThresholds(config, instanceState{History: tc.history}, now, result)
+			if got.ScaleUpThreshold != tc.wantUp || got.ScaleDownThreshold != tc.wantDown {
+				t.Errorf("thresholds got up=%v down=%v want up=%v down=%v", got.ScaleUpThreshold, got.ScaleDownThreshold, tc.wantUp, tc.wantDown)
+			}
+			if (result.ThresholdAdjustment != nil) != tc.widened {
+				t.Errorf("adjustment got %+v want widened=%v", result.ThresholdAdjustment, tc.widened)
+			}
+		})
+	}
+}
+
+func TestAdaptThresholds_Ceiling(t *testing.T) {
+	now := time.Now()
+	a := &AdaptiveThresholds{WindowMinutes: 60, WidenPercent: 10, MaxWidenPercent: 30}
+	history := flappingHistory(now, 10, 30*time.Minute)
+	cases := []struct {
+		name   string
+		panic  float64
+		wantUp float64
+	}{
+		{"capped at 100", 0, 100},
+		{"capped at panicCPUThreshold", 95, 95},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := AutoscalerConfig{ScaleUpThreshold: 85, ScaleDownThreshold: 30, PanicCPUThreshold: tc.panic, AdaptiveThresholds: a}
+			got := adaptThresholds(config, instanceState{History: history}, now, &ScaleResult{})
+			if got.ScaleUpThreshold != tc.wantUp || got.ScaleDownThreshold != 0 {
+				t.Errorf("thresholds got up=%v down=%v want up=%v down=0", got.ScaleUpThreshold, got.ScaleDownThreshold, tc.wantUp)
+			}
+		})
+	}
+}
+
+func TestAdaptiveThresholds_Validate(t *testing.T) {
+	cases := []struct {
+		name    string
+		a       AdaptiveThresholds
+		wantErr bool
+	}{
+		{"defaults", AdaptiveThresholds{}, false},
+		{"ok", AdaptiveThresholds{WindowMinutes: 60, MaxReversals: 2, WidenPercent: 5, MaxWidenPercent: 15}, false},
+		{"negative windowMinutes", AdaptiveThresholds{WindowMinutes: -1}, true},
+		{"negative maxReversals", AdaptiveThresholds{MaxReversals: -1}, true},
+		{"negative widenPercent", AdaptiveThresholds{WidenPercent: -5}, true},
+		{"negative maxWidenPercent", AdaptiveThresholds{MaxWidenPercent: -15}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := tc.a
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000, AdaptiveThresholds: &a}
+			if err := config.validate(); (err != nil) != tc.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestEvaluate_AdaptiveThresholdsDampenFlapping(t *testing.T) {
+	const name = "projects/p/instances/a"
+	admin := newFakeInstanceAdmin(map[string]int32{name: 300})
+	metrics := &fakeMetricClient{cpu: map[string]float64{"a": 65}}
+	useFakes(t, admin, metrics)
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000,
+		ScaleUpThreshold: 60, ScaleDownThreshold: 30, AdaptiveThresholds: &AdaptiveThresholds{MaxReversals: 2}}
+	config.applyDefaults()
+
+	// 安定している間は通常の閾値でスケールアップします。
+	result, err := evaluate(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Action != actionScaleUp || result.ThresholdAdjustment != nil {
+		t.Errorf("stable: got action=%s adjustment=%+v", result.Action, result.ThresholdAdjustment)
+	}
+
+	// flapping が続くと閾値が広がり、同じ CPU 使用率ではスケールアップしなくなります。
+	updateState(name, func(s *instanceState) { s.History = flappingHistory(time.Now(), 4, 30*time.Minute) })
+	result, err = evaluate(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Action != actionNone || result.ThresholdAdjustment == nil || result.ThresholdAdjustment.ScaleUpThreshold != 65 {
+		t.Errorf("flapping: got action=%s adjustment=%+v", result.Action, result.ThresholdAdjustment)
+	}
+}
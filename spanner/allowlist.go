@@ -0,0 +1,93 @@
+package spanner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const reasonInstanceNotAllowed = "instance_not_allowed"
+
+// instanceAllowlist はこのデプロイがスケールしてよいインスタンスです。
+type instanceAllowlist struct {
+	names   map[string]bool
+	pattern *regexp.Regexp
+}
+
+// loadInstanceAllowlist は環境変数 ALLOWED_INSTANCES と ALLOWED_INSTANCES_REGEX から allowlist を作ります。
+// ALLOWED_INSTANCES は "project/instance" のカンマ区切り、ALLOWED_INSTANCES_REGEX は "project/instance" 全体に一致する正規表現です。
+// どちらも設定されていない場合は nil を返し、すべてのインスタンスを許可します。
+func loadInstanceAllowlist() (*instanceAllowlist, error) {
+	names, expr := os.Getenv("ALLOWED_INSTANCES"), os.Getenv("ALLOWED_INSTANCES_REGEX")
+	if names == "" && expr == "" {
+		return nil, nil
+	}
+	a := &instanceAllowlist{names: make(map[string]bool)}
+	for _, n := range strings.Split(names, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			a.names[n] = true
+		}
+	}
+	if expr != "" {
+		p, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid ALLOWED_INSTANCES_REGEX: %w", err)
+		}
+		a.pattern = p
+	}
+	return a, nil
+}
+
+// allows は project の instance をスケールしてよいかを返します。
+func (a *instanceAllowlist) allows(project, instance string) bool {
+	if a == nil {
+		return true
+	}
+	key := project + "/" + instance
+	return a.names[key] || (a.pattern != nil && a.pattern.MatchString(key))
+}
+
+// notAllowedResult は allowlist にないインスタンスへのリクエストを拒否した結果です。
+func notAllowedResult(config AutoscalerConfig, requestID string) *ScaleResult {
+	return &ScaleResult{
+		RequestID:               requestID,
+		Project:                 config.Project,
+		Instance:                config.Instance,
+		Action:                  actionError,
+		Reason:                  reasonInstanceNotAllowed,
+		Message:                 fmt.Sprintf("Instance %s/%s is not allowed in this deployment.", config.Project, config.Instance),
+		EstimatedSecondsToPUMax: noPUMaxEstimate,
+	}
+}
+
+// disallowedInstances は configs のうち allowlist にないインスタンスを拒否した結果を返します。
+// API を呼び出す前に確認するため、Spanner や Cloud Monitoring にはアクセスしません。
+func disallowedInstances(ctx context.Context, configs ...AutoscalerConfig) ([]*ScaleResult, error) {
+	allowlist, err := loadInstanceAllowlist()
+	if err != nil {
+		return nil, err
+	}
+	var rejected []*ScaleResult
+	for _, c := range configs {
+		if !allowlist.allows(c.Project, c.Instance) {
+			logf(ctx, "Rejecting instance %s/%s outside the allowlist", c.Project, c.Instance)
+			rejected = append(rejected, notAllowedResult(c, requestID(ctx)))
+			continue
+		}
+		if r := c.ReferenceInstance; r != nil {
+			project := r.Project
+			if project == "" {
+				project = c.Project
+			}
+			if !allowlist.allows(project, r.Instance) {
+				logf(ctx, "Rejecting instance %s/%s whose reference instance %s/%s is outside the allowlist", c.Project, c.Instance, project, r.Instance)
+				result := notAllowedResult(c, requestID(ctx))
+				result.Message = fmt.Sprintf("Reference instance %s/%s of %s/%s is not allowed in this deployment.", project, r.Instance, c.Project, c.Instance)
+				rejected = append(rejected, result)
+			}
+		}
+	}
+	return rejected, nil
+}
@@ -0,0 +1,171 @@
+package spanner
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInstanceAllowlist_Allows(t *testing.T) {
+	cases := []struct {
+		name     string
+		names    string
+		regex    string
+		instance string
+		want     bool
+	}{
+		{"unset allows all", "", "", "a", true},
+		{"listed", "p/a, p/b", "", "b", true},
+		{"not listed", "p/a,p/b", "", "c", false},
+		{"regex match", "", "p/prod-.*", "prod-orders", true},
+		{"regex is anchored", "", "p/prod-.*", "staging-prod-orders", false},
+		{"listed or regex", "p/a", "p/prod-.*", "a", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("ALLOWED_INSTANCES", tc.names)
+			t.Setenv("ALLOWED_INSTANCES_REGEX", tc.regex)
+			a, err := loadInstanceAllowlist()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := a.allows("p", tc.instance); got != tc.want {
+				t.Errorf("allows(%s) got %v want %v", tc.instance, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHandler_InstanceAllowlist(t *testing.T) {
+	cases := []struct {
+		name       string
+		instance   string
+		wantStatus int
+	}{
+		{"allowed", "a", http.StatusOK},
+		{"not allowed", "b", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("ALLOWED_INSTANCES", "p/a")
+			admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 100, "projects/p/instances/b": 100})
+			metrics := &fakeMetricClient{cpu: map[string]float64{"a": 90, "b": 90}}
+			useFakes(t, admin, metrics)
+
+			body := `{"project": "p", "instance": "` + tc.instance + `", "puStep": 100, "puMin": 100, "puMax": 1000}`
+			rr := httptest.NewRecorder()
+			Handler(rr, httptest.NewRequest(http.MethodPost, "/spanner/autoscaler", strings.NewReader(body)))
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("status got %d want %d: %s", rr.Code, tc.wantStatus, rr.Body.String())
+			}
+			if tc.wantStatus != http.StatusForbidden {
+				return
+			}
+			var result ScaleResult
+			if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+				t.Fatal(err)
+			}
+			if result.Reason != reasonInstanceNotAllowed {
+				t.Errorf("reason got %q want %q", result.Reason, reasonInstanceNotAllowed)
+			}
+			if !admin.getDeadline.IsZero() || metrics.listCalls != 0 || len(admin.updated()) != 0 {
+				t.Errorf("called APIs for a rejected instance: list=%d updated=%v", metrics.listCalls, admin.updated())
+			}
+		})
+	}
+}
+
+func TestBatchHandler_InstanceAllowlist(t *testing.T) {
+	t.Setenv("ALLOWED_INSTANCES_REGEX", "p/a|p/c")
+	admin := newFakeInstanceAdmin(map[string]int32{
+		"projects/p/instances/a": 100,
+		"projects/p/instances/b": 100,
+		"projects/p/instances/c": 100,
+	})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90, "b": 90, "c": 90}})
+
+	body := `{"instances": [
+		{"project": "p", "instance": "a", "puStep": 100, "puMin": 100, "puMax": 1000},
+		{"project": "p", "instance": "b", "puStep": 100, "puMin": 100, "puMax": 1000}
+	]}`
+	rr := httptest.NewRecorder()
+	BatchHandler(rr, httptest.NewRequest(http.MethodPost, "/spanner/autoscaler/batch", strings.NewReader(body)))
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("status got %d want %d", rr.Code, http.StatusForbidden)
+	}
+	var result BatchResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Results) != 1 || result.Results[0].Instance != "b" || result.Results[0].Reason != reasonInstanceNotAllowed {
+		t.Errorf("results got %+v", result.Results)
+	}
+	if len(admin.updated()) != 0 {
+		t.Errorf("updated %v want none", admin.updated())
+	}
+
+	// discovery で見つかった allowlist にないインスタンスは対象にしません。
+	orig := instanceDiscovery
+	instanceDiscovery = newDiscoveryCache()
+	t.Cleanup(func() { instanceDiscovery = orig })
+	body = `{"discovery": {"project": "p", "template": {"puStep": 100, "puMin": 100, "puMax": 1000}}}`
+	rr = httptest.NewRecorder()
+	BatchHandler(rr, httptest.NewRequest(http.MethodPost, "/spanner/autoscaler/batch", strings.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status got %d: %s", rr.Code, rr.Body.String())
+	}
+	if got := admin.updated(); len(got) != 2 || strings.Contains(strings.Join(got, ","), "instances/b") {
+		t.Errorf("updated %v want a and c only", got)
+	}
+}
+
+func TestConfigHandler_InstanceAllowlist(t *testing.T) {
+	t.Setenv("ALLOWED_INSTANCES_REGEX", "p/a|p/c")
+	admin := newFakeInstanceAdmin(map[string]int32{
+		"projects/p/instances/a": 100,
+		"projects/p/instances/b": 100,
+		"projects/p/instances/c": 100,
+	})
+	useFakes(t, admin, &fakeMetricClient{})
+
+	body := `{"instances": [
+		{"project": "p", "instance": "a", "puStep": 100, "puMin": 100, "puMax": 1000},
+		{"project": "p", "instance": "b", "puStep": 100, "puMin": 100, "puMax": 1000}
+	]}`
+	rr := httptest.NewRecorder()
+	ConfigHandler(rr, httptest.NewRequest(http.MethodPost, "/spanner/autoscaler/config", strings.NewReader(body)))
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("status got %d want %d", rr.Code, http.StatusForbidden)
+	}
+	var result BatchResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Results) != 1 || result.Results[0].Instance != "b" || result.Results[0].Reason != reasonInstanceNotAllowed {
+		t.Errorf("results got %+v", result.Results)
+	}
+
+	// discovery で見つかった allowlist にないインスタンスは含めません。
+	orig := instanceDiscovery
+	instanceDiscovery = newDiscoveryCache()
+	t.Cleanup(func() { instanceDiscovery = orig })
+	body = `{"discovery": {"project": "p", "template": {"puStep": 100, "puMin": 100, "puMax": 1000}}}`
+	rr = httptest.NewRecorder()
+	ConfigHandler(rr, httptest.NewRequest(http.MethodPost, "/spanner/autoscaler/config", strings.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status got %d: %s", rr.Code, rr.Body.String())
+	}
+	var dump ConfigDump
+	if err := json.Unmarshal(rr.Body.Bytes(), &dump); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range dump.Instances {
+		got = append(got, c.Instance)
+	}
+	if strings.Join(got, ",") != "a,c" {
+		t.Errorf("instances got %v want a and c", got)
+	}
+}
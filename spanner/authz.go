@@ -0,0 +1,136 @@
+package spanner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"google.golang.org/api/idtoken"
+)
+
+// authorizationError は呼び出し元の認可に失敗した理由と HTTP のステータスコードです。
+type authorizationError struct {
+	status  int
+	message string
+}
+
+func (e *authorizationError) Error() string {
+	return e.message
+}
+
+// verifyIDToken は audience 向けの OIDC の ID token を検証し、呼び出し元のメールアドレスを返します。
+// テストで差し替えられるように変数にしています。
+var verifyIDToken = func(ctx context.Context, token, audience string) (string, error) {
+	payload, err := idtoken.Validate(ctx, token, audience)
+	if err != nil {
+		return "", err
+	}
+	return verifiedEmail(payload.Claims)
+}
+
+// verifiedEmail は ID token の claims から、email_verified が true のメールアドレスを返します。
+func verifiedEmail(claims map[string]any) (string, error) {
+	email, _ := claims["email"].(string)
+	if email == "" {
+		return "", fmt.Errorf("ID token has no email claim")
+	}
+	if verified, _ := claims["email_verified"].(bool); !verified {
+		return "", fmt.Errorf("email %s in ID token is not verified", email)
+	}
+	return email, nil
+}
+
+// authorizedCallers は環境変数 AUTHORIZED_CALLERS の、対象の project ごとにスケールを許可する呼び出し元です。
+// 呼び出し元はサービスアカウントのメールアドレスか、サービスアカウントが属する project ID で指定します。
+// 未設定の場合は nil を返し、アプリケーションでの認可は行いません。
+func authorizedCallers() (map[string][]string, error) {
+	s := os.Getenv("AUTHORIZED_CALLERS")
+	if s == "" {
+		return nil, nil
+	}
+	var m map[string][]string
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		return nil, fmt.Errorf("invalid AUTHORIZED_CALLERS: %w", err)
+	}
+	return m, nil
+}
+
+// authorizeCaller は r の呼び出し元が projects のインスタンスをスケールしてよいかを確認します。
+// AUTHORIZED_CALLERS が設定されていない場合は何もしません。
+// 他のサービス向けの ID token を受け入れないように、AUTHORIZED_CALLERS を設定した場合は OIDC_AUDIENCE も必須です。
+func authorizeCaller(r *http.Request, projects ...string) *authorizationError {
+	callers, err := authorizedCallers()
+	if err != nil {
+		logf(r.Context(), "Failed to authorize caller: %v", err)
+		return &authorizationError{status: http.StatusInternalServerError, message: "Invalid authorization configuration."}
+	}
+	if callers == nil {
+		return nil
+	}
+	audience := os.Getenv("OIDC_AUDIENCE")
+	if audience == "" {
+		logf(r.Context(), "Failed to authorize caller: OIDC_AUDIENCE is required when AUTHORIZED_CALLERS is set")
+		return &authorizationError{status: http.StatusInternalServerError, message: "Invalid authorization configuration."}
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return &authorizationError{status: http.StatusUnauthorized, message: "Missing ID token."}
+	}
+	email, err := verifyIDToken(r.Context(), token, audience)
+	if err != nil {
+		logf(r.Context(), "Failed to verify ID token: %v", err)
+		return &authorizationError{status: http.StatusUnauthorized, message: "Invalid ID token."}
+	}
+	for _, project := range projects {
+		if !callerAllowed(email, callers[project]) {
+			logf(r.Context(), "Caller %s is not authorized to scale instances in project %s", email, project)
+			return &authorizationError{status: http.StatusForbidden, message: fmt.Sprintf("Caller %s is not authorized to scale instances in project %s.", email, project)}
+		}
+	}
+	return nil
+}
+
+// projects は config が読み取る project を返します。referenceInstance と fleetCap の project も含みます。
+// applyDefaults の前に呼び出すため、省略された project は config の project として扱います。
+func (c *AutoscalerConfig) projects() []string {
+	projects := []string{c.Project}
+	add := func(p string) {
+		if p != "" && !slices.Contains(projects, p) {
+			projects = append(projects, p)
+		}
+	}
+	if r := c.ReferenceInstance; r != nil {
+		add(r.Project)
+	}
+	if f := c.FleetCap; f != nil {
+		for _, p := range f.Projects {
+			add(p)
+		}
+		for _, name := range f.Instances {
+			p, _, _ := strings.Cut(name, "/")
+			add(p)
+		}
+	}
+	return projects
+}
+
+// callerAllowed は email が allowed のメールアドレスか、allowed の project のサービスアカウントであるかを返します。
+func callerAllowed(email string, allowed []string) bool {
+	for _, a := range allowed {
+		if strings.Contains(a, "@") {
+			if strings.EqualFold(a, email) {
+				return true
+			}
+			continue
+		}
+		if strings.HasSuffix(strings.ToLower(email), "@"+strings.ToLower(a)+".iam.gserviceaccount.com") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package spanner
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testAudience = "https://autoscaler.example.com"
+
+// useFakeIDTokens は testAudience 向けの token だけを受け入れる fake に verifyIDToken を差し替えます。
+func useFakeIDTokens(t *testing.T, emails map[string]string) {
+	t.Helper()
+	t.Setenv("OIDC_AUDIENCE", testAudience)
+	orig := verifyIDToken
+	verifyIDToken = func(ctx context.Context, token, audience string) (string, error) {
+		email, ok := emails[token]
+		if audience != testAudience {
+			ok = false
+		}
+		if !ok {
+			return "", errors.New("invalid token")
+		}
+		return email, nil
+	}
+	t.Cleanup(func() { verifyIDToken = orig })
+}
+
+func TestHandler_AuthorizeCaller(t *testing.T) {
+	t.Setenv("AUTHORIZED_CALLERS", `{"prod": ["scaler@ops.iam.gserviceaccount.com"], "dev": ["dev"]}`)
+	useFakeIDTokens(t, map[string]string{
+		"ops-token":   "scaler@ops.iam.gserviceaccount.com",
+		"dev-token":   "ci@dev.iam.gserviceaccount.com",
+		"other-token": "other@ops.iam.gserviceaccount.com",
+	})
+	admin := newFakeInstanceAdmin(map[string]int32{
+		"projects/prod/instances/a": 100,
+		"projects/dev/instances/a":  100,
+	})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 40}})
+
+	cases := []struct {
+		name    string
+		token   string
+		project string
+		want    int
+	}{
+		{"allowed service account", "ops-token", "prod", http.StatusOK},
+		{"allowed by caller project", "dev-token", "dev", http.StatusOK},
+		{"service account of another target", "ops-token", "dev", http.StatusForbidden},
+		{"caller project of another target", "dev-token", "prod", http.StatusForbidden},
+		{"other service account in same project", "other-token", "prod", http.StatusForbidden},
+		{"invalid token", "bad-token", "prod", http.StatusUnauthorized},
+		{"missing token", "", "prod", http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			body := `{"project": "` + tc.project + `", "instance": "a", "puStep": 100, "puMin": 100, "puMax": 1000}`
+			req := httptest.NewRequest(http.MethodPost, "/spanner/autoscaler", strings.NewReader(body))
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			rr := httptest.NewRecorder()
+			Handler(rr, req)
+			if rr.Code != tc.want {
+				t.Errorf("status got %d want %d: %s", rr.Code, tc.want, rr.Body.String())
+			}
+			if tc.want == http.StatusForbidden && !strings.Contains(rr.Body.String(), "not authorized to scale instances in project "+tc.project) {
+				t.Errorf("body got %q", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestBatchHandler_AuthorizeCaller(t *testing.T) {
+	t.Setenv("AUTHORIZED_CALLERS", `{"prod": ["ops"]}`)
+	useFakeIDTokens(t, map[string]string{"ops-token": "scaler@ops.iam.gserviceaccount.com"})
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/prod/instances/a": 100})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90}})
+
+	// 1つでも許可されていない project が含まれていれば、どのインスタンスもリサイズしません。
+	body := `{"instances": [
+		{"project": "prod", "instance": "a", "puStep": 100, "puMin": 100, "puMax": 1000},
+		{"project": "dev", "instance": "b", "puStep": 100, "puMin": 100, "puMax": 1000}
+	]}`
+	req := httptest.NewRequest(http.MethodPost, "/spanner/autoscaler/batch", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer ops-token")
+	rr := httptest.NewRecorder()
+	BatchHandler(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("status got %d want %d: %s", rr.Code, http.StatusForbidden, rr.Body.String())
+	}
+	if got := admin.updated(); len(got) != 0 {
+		t.Errorf("updates got %v want none", got)
+	}
+}
+
+func TestAuthorizeCaller_Disabled(t *testing.T) {
+	t.Setenv("AUTHORIZED_CALLERS", "")
+	req := httptest.NewRequest(http.MethodPost, "/spanner/autoscaler", nil)
+	if err := authorizeCaller(req, "prod"); err != nil {
+		t.Errorf("got %v want nil", err)
+	}
+}
+
+func TestAuthorizeCaller_RequiresAudience(t *testing.T) {
+	t.Setenv("AUTHORIZED_CALLERS", `{"prod": ["ops"]}`)
+	useFakeIDTokens(t, map[string]string{"ops-token": "scaler@ops.iam.gserviceaccount.com"})
+	t.Setenv("OIDC_AUDIENCE", "")
+	req := httptest.NewRequest(http.MethodPost, "/spanner/autoscaler", nil)
+	req.Header.Set("Authorization", "Bearer ops-token")
+	err := authorizeCaller(req, "prod")
+	if err == nil || err.status != http.StatusInternalServerError || err.message != "Invalid authorization configuration." {
+		t.Errorf("got %v want a 500 authorization configuration error", err)
+	}
+}
+
+func TestVerifiedEmail(t *testing.T) {
+	cases := []struct {
+		name    string
+		claims  map[string]any
+		want    string
+		wantErr bool
+	}{
+		{"verified", map[string]any{"email": "scaler@ops.iam.gserviceaccount.com", "email_verified": true}, "scaler@ops.iam.gserviceaccount.com", false},
+		{"not verified", map[string]any{"email": "scaler@ops.iam.gserviceaccount.com", "email_verified": false}, "", true},
+		{"verification missing", map[string]any{"email": "scaler@ops.iam.gserviceaccount.com"}, "", true},
+		{"no email", map[string]any{"email_verified": true}, "", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := verifiedEmail(tc.claims)
+			if got != tc.want || (err != nil) != tc.wantErr {
+				t.Errorf("got %q, %v want %q, wantErr %v", got, err, tc.want, tc.wantErr)
+			}
+		})
+	}
+}
@@ -3,31 +3,43 @@ package spanner
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
-	"sync"
+	"strings"
 	"time"
 
-	instanceadmin "cloud.google.com/go/spanner/admin/instance/apiv1"         // Spanner Instance Admin API client
 	instancepb "cloud.google.com/go/spanner/admin/instance/apiv1/instancepb" // Spanner Instance Admin API instance protobuf definitions
 
-	monitoringclient "cloud.google.com/go/monitoring/apiv3/v2"          // Monitoring API client
 	monitoringpb "cloud.google.com/go/monitoring/apiv3/v2/monitoringpb" // Monitoring API protobuf definitions
 	"google.golang.org/api/iterator"
-	"google.golang.org/protobuf/types/known/fieldmaskpb" // For FieldMask in UpdateInstanceRequest
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/timestamppb" // For correct timestamp handling
 )
 
-var (
-	// lastResizedStore はインスタンスごとの最終リサイズ時刻を保持します。
-	// このストアは複数のリクエストから同時にアクセスされるため、Mutexで保護します。
-	lastResizedStore = struct {
-		sync.Mutex
-		m map[string]time.Time
-	}{m: make(map[string]time.Time)}
+const (
+	actionScaleUp   = "scale_up"
+	actionScaleDown = "scale_down"
+	actionNone      = "none"
+	// actionNoChange はリサイズしようとしたが、インスタンスが既にそのサイズだったことを表します。
+	actionNoChange = "no_change"
+)
+
+const (
+	reasonCPUAboveThreshold   = "cpu_above_threshold"
+	reasonCPUBelowThreshold   = "cpu_below_threshold"
+	reasonWithinRange         = "within_range"
+	reasonAtMaxPU             = "at_max_pu"
+	reasonAtMinPU             = "at_min_pu"
+	reasonCooldown            = "cooldown"
+	reasonInsufficientSamples = "insufficient_samples"
+	reasonPendingRetry        = "pending_retry"
+	reasonRateLimited         = "rate_limited"
+	reasonAlreadyAtTarget     = "already_at_target"
 )
 
 // AutoscalerConfig is the configuration for the autoscaler.
@@ -39,151 +51,1160 @@ type AutoscalerConfig struct {
 	PUMax              int     `json:"puMax"`
 	ScaleUpThreshold   float64 `json:"scaleUpThreshold"`
 	ScaleDownThreshold float64 `json:"scaleDownThreshold"`
+	// DeadBandPercent を指定すると、CPU 使用率が scaleUpThreshold を DeadBandPercent ポイント超えるまでスケールアップせず、
+	// scaleDownThreshold を DeadBandPercent ポイント下回るまでスケールダウンしません。
+	DeadBandPercent float64 `json:"deadBandPercent"`
+	// MinSampleCount 未満の CPU 使用率のデータポイントしか取得できなかった場合はスケーリングしません。
+	MinSampleCount int `json:"minSampleCount"`
+	// AcceptPartialReads を有効にすると、CPU 使用率の読み取りが途中でエラーになっても、
+	// それまでに MinSampleCount (指定しない場合は 1) 以上のデータポイントを読み取れていればその値で判断します。
+	AcceptPartialReads bool `json:"acceptPartialReads"`
+	// MinMetricReadIntervalSeconds を指定すると、その間隔以内に読み取ったメトリクスがあれば Cloud Monitoring を呼ばずに再利用します。
+	// 5 分と cooldown より短くする必要があります。
+	MinMetricReadIntervalSeconds float64 `json:"minMetricReadIntervalSeconds"`
+
+	// スケールダウンを抑止する期間は CooldownBaseMinutes に、直前のリサイズの変化量 1 PU あたり
+	// CooldownSecondsPerPU を加えたものです。CooldownMaxMinutes が指定されていればそれを上限とします。
+	// CooldownBaseMinutes を省略した場合は RESIZE_INTERVAL_MINUTES を使います。
+	CooldownBaseMinutes  float64 `json:"cooldownBaseMinutes"`
+	CooldownSecondsPerPU float64 `json:"cooldownSecondsPerPU"`
+	CooldownMaxMinutes   float64 `json:"cooldownMaxMinutes"`
+
+	// ScaleUpDecayHalfLifeMinutes を指定すると、スケールアップの後は cooldown の代わりに、時間とともに弱まる抑止を使います。
+	// スケールアップで増えた割合に応じて scaleDownThreshold を下げ、半減期ごとに下げ幅を半分にします。
+	ScaleUpDecayHalfLifeMinutes float64 `json:"scaleUpDecayHalfLifeMinutes"`
+	// QuietPeriodMinutes を指定すると、最後のスケールアップからその時間が経過するまでスケールダウンしません。
+	// 最後のリサイズからの cooldown とは別に判断します。
+	QuietPeriodMinutes float64 `json:"quietPeriodMinutes"`
+	// SettleSeconds を指定すると、最後のリサイズからその時間が経過するまではメトリクスを読み取るだけで、スケールアップもスケールダウンもしません。
+	// リサイズの直後は PU やメトリクスの反映が遅れるため、その値で行き過ぎたリサイズをしないようにします。
+	SettleSeconds float64 `json:"settleSeconds"`
+
+	// UpdateRetries は UpdateInstance が失敗した場合に再試行する回数です。
+	UpdateRetries int `json:"updateRetries"`
+	// RetryPendingUpdates を有効にすると、再試行しても失敗したリサイズを pending として記録し、
+	// 次回以降の呼び出しで新しい判断に置き換えられるまで再試行します。
+	RetryPendingUpdates bool `json:"retryPendingUpdates"`
+
+	// MetricQuery に Monitoring Query Language (MQL) のクエリを指定すると、CPU 使用率の代わりに
+	// その結果の数値を scaleUpThreshold, scaleDownThreshold と比較します。
+	// クエリは1つの数値の time series を返す必要があります。
+	MetricQuery string `json:"metricQuery"`
+
+	// MinimizeCost は開発用のインスタンス向けの設定です。CPU 使用率が低い場合は cooldown を無視して
+	// 一度に PUMin までスケールダウンします。MIN_UPDATE_INTERVAL_SECONDS の間隔だけは守ります。
+	MinimizeCost bool `json:"minimizeCost"`
+
+	// StorageScaleUpThreshold を指定すると、storage の使用率 (上限に対する %) がこれを超えた場合、
+	// CPU 使用率が正常範囲でもスケールアップします。
+	StorageScaleUpThreshold float64 `json:"storageScaleUpThreshold"`
+
+	AdaptiveThresholds *AdaptiveThresholds `json:"adaptiveThresholds"`
+
+	MetricQuorum *MetricQuorum `json:"metricQuorum"`
+
+	// TimeoutSeconds を指定すると、リクエスト全体をその時間で打ち切ります。
+	// X-Request-Timeout-Seconds ヘッダー、REQUEST_TIMEOUT_SECONDS のうち最も短いものを使います。
+	TimeoutSeconds float64 `json:"timeoutSeconds"`
+
+	// PreProvisionIntervalMinutes に autoscaler を呼び出す間隔を指定すると、CPU 使用率が上昇している場合は
+	// 次の呼び出しの時点の CPU 使用率の見込みが scaleUpThreshold に収まるようにスケールアップします。
+	PreProvisionIntervalMinutes float64 `json:"preProvisionIntervalMinutes"`
+
+	// PanicCPUThreshold を指定すると、CPU 使用率がこれを超えた場合はステップと cooldown を無視して一度に PUMax までスケールアップし、
+	// NOTIFY_WEBHOOK_URL に critical の通知を送ります。
+	PanicCPUThreshold float64 `json:"panicCPUThreshold"`
+
+	// ProportionalStep を有効にすると、PUStep の代わりに現在の PU の ProportionalStepPercent % (デフォルト 25) ずつスケーリングします。
+	// 変化量は有効な PU に丸めます。大きなインスタンスで変化が小さすぎたり、小さなインスタンスで大きすぎたりするのを防ぎます。
+	ProportionalStep        bool    `json:"proportionalStep"`
+	ProportionalStepPercent float64 `json:"proportionalStepPercent"`
+	// SizeLadder を指定すると、PUStep と ProportionalStep の代わりに、昇順に並べた PU の段を1段ずつスケーリングします。
+	// 最上段より大きく、最下段より小さくはしません。各値は Spanner の受け付ける PU である必要があります。
+	SizeLadder []int32 `json:"sizeLadder"`
+
+	// SafeMode を有効にすると、判断した変化量を最大1ステップに制限します。
+	// minimizeCost などの一度に大きく変化する設定を試す際の安全装置です。
+	SafeMode bool `json:"safeMode"`
+
+	// BoundsAdvisory を指定すると、最近の判断の多くで puMin か puMax の近くにいた場合に境界の見直しを提案します。
+	BoundsAdvisory *BoundsAdvisory `json:"boundsAdvisory"`
+
+	// ScaleDownGate を指定すると、CPU 使用率に加えて有効にしたすべてのシグナルが安全な水準の場合だけスケールダウンします。
+	ScaleDownGate *ScaleDownGate `json:"scaleDownGate"`
+
+	// MetricCoverage を指定すると、CPU 使用率のデータポイントが lookback window の一部しか覆っていない場合に警告するか、スケーリングしません。
+	MetricCoverage *MetricCoverage `json:"metricCoverage"`
+
+	// FleetCap を指定すると、autoscaler が管理するすべてのインスタンスの PU の合計がその上限を超えないようにスケールアップを制限します。
+	FleetCap *FleetCap `json:"fleetCap"`
+
+	// RelativeThresholds を指定すると、scaleUpThreshold と scaleDownThreshold に加えて、直近の CPU 使用率の平均 (baseline) からの差でもスケーリングします。
+	RelativeThresholds *RelativeThresholds `json:"relativeThresholds"`
+
+	// DriftZone を指定すると、CPU 使用率が scaleDownThreshold の少し上に留まる場合に、少しずつスケールダウンします。
+	DriftZone *DriftZone `json:"driftZone"`
+
+	// NoShrinkWindows の期間内は、期間に入った時点の PU より小さくスケールダウンしません。
+	NoShrinkWindows []NoShrinkWindow `json:"noShrinkWindows"`
+
+	// ReferenceInstance を指定すると、そのインスタンスの CPU 使用率か PU をもとにスケーリングします。
+	// 参照するインスタンスを読み取れない場合は、設定したインスタンス自身のメトリクスで判断します。
+	ReferenceInstance *ReferenceInstance `json:"referenceInstance"`
+
+	// Trace を有効にすると、判断の途中で評価したすべてのルールとその入力と結果をレスポンスの trace に含めます。
+	// レスポンスが大きくなるため、調査する場合だけ有効にしてください。
+	Trace bool `json:"trace"`
+
+	// CostTiers はインスタンス構成から求めた区分 (regional, multi_region) ごとのスケールダウンの重みです。
+	// 高価な multi_region のインスタンスほど早く縮めるように指定できます。
+	CostTiers map[string]*CostTierPolicy `json:"costTiers"`
+	// costTier は evaluate でインスタンスの区分から選んだ CostTiers の設定です。
+	costTier *CostTierPolicy
+}
+
+func (c *AutoscalerConfig) validate() error {
+	if c.Project == "" || c.Instance == "" || (c.PUStep == 0 && !c.ProportionalStep && len(c.SizeLadder) == 0) || c.PUMin == 0 || c.PUMax == 0 {
+		return errors.New("Missing required fields in JSON.")
+	}
+	if c.DeadBandPercent < 0 {
+		return errors.New("Invalid deadBandPercent.")
+	}
+	// scaleUpThreshold を省略した場合はデフォルト値と比べます。
+	scaleUp := c.ScaleUpThreshold
+	if scaleUp == 0 {
+		d := *c
+		d.applyDefaults()
+		scaleUp = d.ScaleUpThreshold
+	}
+	if c.PanicCPUThreshold < 0 || (c.PanicCPUThreshold > 0 && c.PanicCPUThreshold <= scaleUp) {
+		return errors.New("Invalid panicCPUThreshold. It must be above scaleUpThreshold.")
+	}
+	if c.ProportionalStepPercent < 0 || c.ProportionalStepPercent >= 100 {
+		return errors.New("Invalid proportionalStepPercent.")
+	}
+	if err := c.validateSizeLadder(); err != nil {
+		return err
+	}
+	if err := c.validateMinMetricReadInterval(); err != nil {
+		return err
+	}
+	if c.ScaleUpDecayHalfLifeMinutes < 0 {
+		return errors.New("Invalid scaleUpDecayHalfLifeMinutes.")
+	}
+	if c.QuietPeriodMinutes < 0 {
+		return errors.New("Invalid quietPeriodMinutes.")
+	}
+	if c.SettleSeconds < 0 {
+		return errors.New("Invalid settleSeconds.")
+	}
+	if c.PreProvisionIntervalMinutes < 0 {
+		return errors.New("Invalid preProvisionIntervalMinutes.")
+	}
+	if q := c.MetricQuorum; q != nil && (q.Reads < 1 || q.Quorum < 0 || q.Quorum > q.Reads) {
+		return errors.New("Invalid metricQuorum.")
+	}
+	if b := c.BoundsAdvisory; b != nil && (b.WindowMinutes < 0 || b.MarginPercent < 0 || b.MarginPercent >= 100 || b.Ratio < 0 || b.Ratio > 1 || b.MinDecisions < 0) {
+		return errors.New("Invalid boundsAdvisory.")
+	}
+	if c.ScaleDownGate != nil {
+		if err := c.ScaleDownGate.validate(); err != nil {
+			return err
+		}
+	}
+	if c.AdaptiveThresholds != nil {
+		if err := c.AdaptiveThresholds.validate(); err != nil {
+			return err
+		}
+	}
+	if c.DriftZone != nil {
+		if err := c.DriftZone.validate(); err != nil {
+			return err
+		}
+	}
+	if c.MetricCoverage != nil {
+		if err := c.MetricCoverage.validate(); err != nil {
+			return err
+		}
+	}
+	if c.RelativeThresholds != nil {
+		if err := c.RelativeThresholds.validate(); err != nil {
+			return err
+		}
+	}
+	if c.FleetCap != nil {
+		if err := c.FleetCap.validate(); err != nil {
+			return err
+		}
+	}
+	if err := validateCostTiers(c.CostTiers); err != nil {
+		return err
+	}
+	if err := c.validateReferenceInstance(); err != nil {
+		return err
+	}
+	for _, w := range c.NoShrinkWindows {
+		if err := w.validate(); err != nil {
+			return fmt.Errorf("Invalid noShrinkWindows: %v", err)
+		}
+	}
+	return nil
+}
+
+func (c *AutoscalerConfig) applyDefaults() {
+	c.applyEnvironmentDefaults()
+	if c.ScaleUpThreshold == 0 {
+		c.ScaleUpThreshold = 50.0
+	}
+	if c.ScaleDownThreshold == 0 {
+		c.ScaleDownThreshold = 30.0
+	}
+	if c.ProportionalStep && c.ProportionalStepPercent == 0 {
+		c.ProportionalStepPercent = 25
+	}
+	if c.AdaptiveThresholds != nil {
+		c.AdaptiveThresholds.applyDefaults()
+	}
+	if c.MetricQuorum != nil {
+		c.MetricQuorum.applyDefaults()
+	}
+	if c.BoundsAdvisory != nil {
+		c.BoundsAdvisory.applyDefaults()
+	}
+	if c.DriftZone != nil {
+		c.DriftZone.applyDefaults()
+	}
+	if c.MetricCoverage != nil {
+		c.MetricCoverage.applyDefaults()
+	}
+	if c.RelativeThresholds != nil {
+		c.RelativeThresholds.applyDefaults()
+	}
+	if c.FleetCap != nil {
+		c.FleetCap.applyDefaults(c.Project)
+	}
+	for _, p := range c.CostTiers {
+		p.applyDefaults()
+	}
+	if c.ReferenceInstance != nil {
+		c.ReferenceInstance.applyDefaults(c.Project)
+	}
+}
+
+// cooldown は changePU だけリサイズした後にスケールダウンを抑止する期間を返します。
+func (c *AutoscalerConfig) cooldown(changePU int32) time.Duration {
+	base := resizeInterval()
+	if c.CooldownBaseMinutes > 0 {
+		base = time.Duration(c.CooldownBaseMinutes * float64(time.Minute))
+	}
+	if changePU < 0 {
+		changePU = -changePU
+	}
+	d := base + time.Duration(c.CooldownSecondsPerPU*float64(changePU)*float64(time.Second))
+	if max := time.Duration(c.CooldownMaxMinutes * float64(time.Minute)); max > 0 && d > max {
+		d = max
+	}
+	return time.Duration(float64(d) * c.cooldownMultiplier())
+}
+
+func (c *AutoscalerConfig) instanceName() string {
+	return fmt.Sprintf("projects/%s/instances/%s", c.Project, c.Instance)
+}
+
+// ScaleResult is the outcome of autoscaling a single instance.
+type ScaleResult struct {
+	// RequestID は呼び出しの correlation ID です。
+	RequestID string `json:"requestId,omitempty"`
+	Project   string `json:"project"`
+	Instance  string `json:"instance"`
+	// CostTier はインスタンス構成から求めたコストの区分 (regional, multi_region) です。
+	CostTier string `json:"costTier,omitempty"`
+	// DisplayName はインスタンスの表示名です。人が読むための値で、API の呼び出しには Instance を使います。
+	DisplayName string  `json:"displayName,omitempty"`
+	Group       string  `json:"group,omitempty"`
+	Action      string  `json:"action"`
+	CurrentPU   int32   `json:"currentPU"`
+	NewPU       int32   `json:"newPU"`
+	CPUUsage    float64 `json:"cpuUsage"`
+	// StorageUtilization は storageScaleUpThreshold を指定した場合の storage の使用率 (%) です。
+	StorageUtilization float64 `json:"storageUtilization,omitempty"`
+	// LatencyMs は scaleDownGate の latencySafeThresholdMs を指定した場合の API リクエストの p99 レイテンシ (ms) です。
+	LatencyMs float64 `json:"latencyMs,omitempty"`
+	Reason    string  `json:"reason,omitempty"`
+	Message   string  `json:"message"`
+	Error     string  `json:"error,omitempty"`
+
+	// EstimatedSecondsToPUMax は CPU 使用率が今の傾きで上昇し続けた場合に PUMax でも足りなくなるまでの秒数です。
+	// CPU 使用率が上昇していない場合と既に PUMax の場合は -1 です。
+	EstimatedSecondsToPUMax float64 `json:"estimatedSecondsToPUMax"`
+
+	// NearBounds は boundsAdvisory を指定した場合に、最近の判断の多くで puMin か puMax の近くにいた境界です。
+	NearBounds []NearBound `json:"nearBounds,omitempty"`
+	// Trace は trace を有効にした場合の、評価した順のルールです。
+	Trace []TraceStep `json:"trace,omitempty"`
+
+	// ScaleDownVetoedBy はスケールダウンを許可しなかったメトリクスです。
+	ScaleDownVetoedBy []string `json:"scaleDownVetoedBy,omitempty"`
+	// SafeModeClamped は safeMode によって変化量を1ステップに制限したかどうかです。
+	SafeModeClamped bool `json:"safeModeClamped,omitempty"`
+	// FleetCapped は fleetCap によってスケールアップを制限したかどうかです。
+	FleetCapped bool `json:"fleetCapped,omitempty"`
+
+	// ConfigSource は CONFIG_SOURCE_URL の remote config を使った場合のバージョンです。
+	ConfigSource        *ConfigSource        `json:"configSource,omitempty"`
+	ThresholdAdjustment *ThresholdAdjustment `json:"thresholdAdjustment,omitempty"`
+	Diagnostics         Diagnostics          `json:"diagnostics"`
+
+	instanceName string
+	config       AutoscalerConfig
+	err          error
+	// noShrinkFloor は NoShrinkWindow 内でのスケールダウンの下限です。期間外の場合は 0 です。
+	noShrinkFloor int32
+	// currentCapacity はインスタンスの現在のサイズです。CurrentPU はその Processing Unit です。
+	currentCapacity capacityTarget
+	// driftInvocations は drift zone 内の呼び出しが続いた回数です。apply で状態に記録します。
+	driftInvocations int
+	// panicked は PanicCPUThreshold を超えたため PUMax までスケールアップするかどうかです。
+	panicked bool
+}
+
+// targetCapacity は NewPU にリサイズする場合のインスタンスのサイズです。
+func (r *ScaleResult) targetCapacity() capacityTarget {
+	return r.currentCapacity.withProcessingUnits(r.NewPU)
+}
+
+// label は人が読むためのインスタンスの名前です。表示名がなければ instance ID を返します。
+func (r *ScaleResult) label() string {
+	if r.DisplayName != "" {
+		return r.DisplayName
+	}
+	return r.Instance
+}
+
+// Diagnostics holds details about the data the decision was based on.
+type Diagnostics struct {
+	MetricSource    string  `json:"metricSource"`
+	SampleCount     int     `json:"sampleCount"`
+	CooldownSeconds float64 `json:"cooldownSeconds,omitempty"`
+	// Evaluations はメトリクスごとの判断を評価した順に並べたものです。
+	Evaluations []Evaluation `json:"evaluations,omitempty"`
+	// ScaleDownSuppression は scaleUpDecayHalfLifeMinutes による、最後のスケールアップの後のスケールダウンの抑止の強さ (0 から 1) です。
+	ScaleDownSuppression float64 `json:"scaleDownSuppression,omitempty"`
+	// ClockSkewSeconds は state に記録された時刻が現在時刻より未来になっていた場合の、そのずれの秒数です。
+	ClockSkewSeconds float64 `json:"clockSkewSeconds,omitempty"`
+	// FleetPU は fleetCap を指定してスケールアップする場合の、このインスタンスを含む fleet 全体の PU の合計です。
+	FleetPU int32 `json:"fleetPU,omitempty"`
+	// FleetUnknown は fleetCap の合計を求める際に PU を取得できなかった project か fleet のインスタンスです。その場合はスケールアップしません。
+	FleetUnknown []string `json:"fleetUnknown,omitempty"`
+	// CPUBaseline は relativeThresholds を指定した場合に、比較に使った直近の CPU 使用率の平均です。
+	CPUBaseline *float64 `json:"cpuBaseline,omitempty"`
+	// MetricAgeSeconds は minMetricReadIntervalSeconds により再利用したメトリクスを読み取ってからの秒数です。
+	MetricAgeSeconds float64 `json:"metricAgeSeconds,omitempty"`
+	// PartialRead は acceptPartialReads により、読み取りの途中でエラーになる前の CPU 使用率で判断したかどうかです。
+	PartialRead bool `json:"partialRead,omitempty"`
+	// TrendSlopePerMinute は CPU 使用率の 1 分あたりの変化量 (ポイント) です。
+	TrendSlopePerMinute float64 `json:"trendSlopePerMinute,omitempty"`
+	// ProjectedCPUUsage は preProvisionIntervalMinutes 後の CPU 使用率の見込みです。
+	ProjectedCPUUsage float64 `json:"projectedCPUUsage,omitempty"`
+	// QuorumReads は metricQuorum を指定した場合に読み取った値を読み取った順に並べたものです。
+	QuorumReads []float64 `json:"quorumReads,omitempty"`
+	// ReferencePU は referenceInstance の mode が pu の場合に読み取った参照するインスタンスの PU です。
+	ReferencePU int32 `json:"referencePU,omitempty"`
+	// ReferenceError は referenceInstance を読み取れず、設定したインスタンス自身のメトリクスで判断した場合のエラーです。
+	ReferenceError string `json:"referenceError,omitempty"`
+	// DriftInvocations は driftZone を指定した場合に、CPU 使用率が drift zone 内の呼び出しが続いた回数です。
+	DriftInvocations int `json:"driftInvocations,omitempty"`
+	// MetricCoverageSeconds と MetricCoverageRatio は CPU 使用率のデータポイントが lookback window のうち覆っている期間とその割合です。
+	MetricCoverageSeconds float64 `json:"metricCoverageSeconds,omitempty"`
+	MetricCoverageRatio   float64 `json:"metricCoverageRatio,omitempty"`
+	// LowCoverage は metricCoverage を指定した場合に、データポイントが覆っている割合が minRatio を下回ったかどうかです。
+	LowCoverage bool `json:"lowCoverage,omitempty"`
+}
+
+// autoscaleError は HTTP レスポンスに返すメッセージと原因のエラーを保持します。
+type autoscaleError struct {
+	message string
+	err     error
+}
+
+func (e *autoscaleError) Error() string {
+	return fmt.Sprintf("%s %v", e.message, e.err)
+}
+
+func (e *autoscaleError) Unwrap() error {
+	return e.err
 }
 
 func Handler(w http.ResponseWriter, r *http.Request) {
+	r = withRequestID(w, r)
 	var config AutoscalerConfig
 	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
 		http.Error(w, "Invalid JSON request body.", http.StatusBadRequest)
 		return
 	}
 
-	if config.Project == "" || config.Instance == "" || config.PUStep == 0 || config.PUMin == 0 || config.PUMax == 0 {
-		http.Error(w, "Missing required fields in JSON.", http.StatusBadRequest)
+	if err := config.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	if config.ScaleUpThreshold == 0 {
-		config.ScaleUpThreshold = 50.0
+	if err := authorizeCaller(r, config.projects()...); err != nil {
+		http.Error(w, err.message, err.status)
+		return
 	}
-	if config.ScaleDownThreshold == 0 {
-		config.ScaleDownThreshold = 30.0
+	if rejected, err := disallowedInstances(r.Context(), config); err != nil {
+		logf(r.Context(), "Failed to load the instance allowlist: %v", err)
+		http.Error(w, "Invalid allowlist configuration.", http.StatusInternalServerError)
+		return
+	} else if len(rejected) > 0 {
+		writeJSON(w, http.StatusForbidden, rejected[0])
+		return
 	}
+	config.applyDefaults()
 
-	log.Printf("Request received: project=%s, instance=%s, pu_step=%d, pu_min=%d, pu_max=%d, scale_up_threshold=%.2f, scale_down_threshold=%.2f",
+	logf(r.Context(), "Request received: project=%s, instance=%s, pu_step=%d, pu_min=%d, pu_max=%d, scale_up_threshold=%.2f, scale_down_threshold=%.2f",
 		config.Project, config.Instance, config.PUStep, config.PUMin, config.PUMax, config.ScaleUpThreshold, config.ScaleDownThreshold)
 
-	ctx := context.Background()
-	instanceName := fmt.Sprintf("projects/%s/instances/%s", config.Project, config.Instance)
+	ctx, cancel := requestContext(r, config.TimeoutSeconds)
+	defer cancel()
+	result, err := evaluate(ctx, config)
+	if err == nil {
+		err = apply(ctx, result)
+	}
+	if err != nil {
+		writeError(w, err, retryAfter(config.instanceName(), err))
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
+
+// writeError は err を HTTP レスポンスに書き込みます。
+// retryAfter が正の場合は一時的な障害として 503 と Retry-After を返します。
+func writeError(w http.ResponseWriter, err error, retryAfter time.Duration) {
+	status := http.StatusInternalServerError
+	if retryAfter > 0 {
+		status = http.StatusServiceUnavailable
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+	}
+	var ae *autoscaleError
+	if errors.As(err, &ae) {
+		http.Error(w, ae.message, status)
+		return
+	}
+	http.Error(w, "Internal server error.", status)
+}
+
+// evaluate は現在の Processing Unit と CPU 使用率を取得し、スケーリングの判断を行います。
+// 実際のリサイズは apply で行います。
+func evaluate(ctx context.Context, config AutoscalerConfig) (*ScaleResult, error) {
+	instanceName := config.instanceName()
+	result := &ScaleResult{
+		RequestID:    requestID(ctx),
+		Project:      config.Project,
+		Instance:     config.Instance,
+		Action:       actionNone,
+		instanceName: instanceName,
+	}
+	result.EstimatedSecondsToPUMax = noPUMaxEstimate
+	config = applyRemoteConfig(ctx, config, result)
+	result.config = config
 
 	// Spannerの現在のProcessing Unitを取得
-	currentPU, err := getCurrentProcessingUnits(ctx, instanceName)
+	info, err := getCurrentCapacity(ctx, instanceName)
 	if err != nil {
-		log.Printf("Failed to get current processing units: %v", err)
-		http.Error(w, "Failed to get current processing units.", http.StatusInternalServerError)
-		return
+		logf(ctx, "Failed to get current processing units: %v", err)
+		return nil, &autoscaleError{message: "Failed to get current processing units.", err: err}
 	}
-	log.Printf("Current Processing Units: %d", currentPU)
+	currentPU := info.Capacity.ProcessingUnits
+	result.currentCapacity = info.Capacity
+	result.DisplayName = info.DisplayName
+	config = withCostTier(config, info.Config, result)
+	result.config = config
+	logf(ctx, "Current Processing Units of %s: %d", result.label(), currentPU)
+	result.CurrentPU = currentPU
+	result.NewPU = currentPU
+	result.trace("current_capacity", tracePass, map[string]any{
+		"processingUnits":     currentPU,
+		"nodeCountConfigured": info.Capacity.NodeCountConfigured,
+		"costTier":            result.CostTier,
+	})
 
 	// SpannerのCPU使用率を取得
-	cpuUsage, err := getSpannerCPUUsage(ctx, config.Project, config.Instance)
+	state := correctClockSkew(ctx, loadState(instanceName), time.Now(), result)
+	if skipNewInstance(ctx, info, state, time.Now(), result) {
+		return result, nil
+	}
+	reading, err := readMetricCached(ctx, config, state, time.Now(), result)
 	if err != nil {
-		log.Printf("Failed to get Spanner CPU usage: %v", err)
-		http.Error(w, "Failed to get Spanner CPU usage.", http.StatusInternalServerError)
-		return
+		return nil, err
+	}
+	if config.MetricQuorum != nil {
+		result.Diagnostics.QuorumReads, err = readQuorum(ctx, config, result, reading.Usage)
+		if err != nil {
+			return nil, err
+		}
+	}
+	cpuUsage := reading.Usage
+	result.trace("metric_read", tracePass, map[string]any{
+		"source":         result.Diagnostics.MetricSource,
+		"value":          cpuUsage,
+		"samples":        reading.Samples,
+		"slopePerMinute": reading.SlopePerMinute,
+		"ageSeconds":     result.Diagnostics.MetricAgeSeconds,
+	})
+	logf(ctx, "Current CPU Usage: %.2f%% (%d samples)", cpuUsage, reading.Samples)
+	result.CPUUsage = cpuUsage
+	result.Diagnostics.SampleCount = reading.Samples
+	result.Diagnostics.TrendSlopePerMinute = reading.SlopePerMinute
+	if reading.CoveredSeconds > 0 {
+		result.Diagnostics.MetricCoverageSeconds = reading.CoveredSeconds
+		result.Diagnostics.MetricCoverageRatio = reading.CoveredSeconds / metricLookback.Seconds()
+	}
+	result.EstimatedSecondsToPUMax = estimateSecondsToPUMax(config, result)
+	if result.EstimatedSecondsToPUMax >= 0 {
+		logf(ctx, "Estimated %.0f seconds to reach max PUs at the current trend", result.EstimatedSecondsToPUMax)
+	}
+
+	if config.readsStorage() {
+		storage, err := getSpannerStorageUtilization(ctx, config.Project, config.Instance)
+		if err != nil {
+			logf(ctx, "Failed to get Spanner storage utilization: %v", err)
+			return nil, &autoscaleError{message: "Failed to get Spanner storage utilization.", err: err}
+		}
+		logf(ctx, "Current Storage Utilization: %.2f%%", storage.Usage)
+		result.StorageUtilization = storage.Usage
+	}
+	if config.readsLatency() {
+		latency, err := getSpannerLatency(ctx, config.Project, config.Instance)
+		if err != nil {
+			logf(ctx, "Failed to get Spanner request latency: %v", err)
+			return nil, &autoscaleError{message: "Failed to get Spanner request latency.", err: err}
+		}
+		logf(ctx, "Current p99 Request Latency: %.2fms (%d samples)", latency.Usage, latency.Samples)
+		result.LatencyMs = latency.Usage
 	}
-	log.Printf("Current CPU Usage: %.2f%%", cpuUsage)
 
-	intervalMinutesStr := os.Getenv("RESIZE_INTERVAL_MINUTES")
-	if intervalMinutesStr == "" {
-		intervalMinutesStr = "30" // Default interval
+	readReferencePU(ctx, config, result)
+
+	result.noShrinkFloor = noShrinkFloor(config, state, time.Now(), currentPU)
+	adviseBounds(ctx, config, state, time.Now(), result)
+	if !skipSettling(ctx, config, state, time.Now(), result) {
+		decide(ctx, config, state, result)
+		retryPending(ctx, config, state, result)
+	}
+	clampToSafeMode(ctx, config, result)
+	clampToFleetCap(ctx, config, result, false)
+	result.trace("decision", result.Action, map[string]any{"currentPU": result.CurrentPU, "newPU": result.NewPU, "reason": result.Reason})
+	return result, nil
+}
+
+// readMetric は metricQuery を指定した場合はその値を、そうでなければ CPU 使用率を読み取ります。
+func readMetric(ctx context.Context, config AutoscalerConfig, result *ScaleResult) (*metricReading, error) {
+	if config.MetricQuery != "" {
+		result.Diagnostics.MetricSource = metricSourceQuery
+		reading, err := getMetricQueryValue(ctx, config.Project, config.MetricQuery)
+		if err != nil {
+			logf(ctx, "Failed to get metric query value: %v", err)
+			return nil, &autoscaleError{message: "Failed to get metric query value.", err: err}
+		}
+		return reading, nil
+	}
+	if r := config.ReferenceInstance; r != nil && r.Mode == referenceModeCPU {
+		if reading := readReferenceCPU(ctx, r, result); reading != nil {
+			return reading, nil
+		}
+	}
+	result.Diagnostics.MetricSource = metricSourceCPU
+	reading, err := getSpannerCPUUsage(ctx, config.Project, config.Instance)
+	if err != nil && config.AcceptPartialReads && reading != nil && reading.Samples >= max(config.MinSampleCount, 1) {
+		logf(ctx, "Using %d CPU samples read before the error: %v", reading.Samples, err)
+		result.Diagnostics.PartialRead = true
+		return reading, nil
 	}
-	intervalMinutes, err := strconv.Atoi(intervalMinutesStr)
 	if err != nil {
-		log.Printf("Invalid RESIZE_INTERVAL_MINUTES: %v", err)
-		intervalMinutes = 30
+		logf(ctx, "Failed to get Spanner CPU usage: %v", err)
+		return nil, &autoscaleError{message: "Failed to get Spanner CPU usage.", err: err}
+	}
+	return reading, nil
+}
+
+// decide はメトリクスと閾値からスケーリングの判断を行い、result に設定します。
+// いずれかのメトリクスがスケールアップを求めればスケールアップし、
+// そうでなければ CPU 使用率が低い場合にスケールダウンします。
+func decide(ctx context.Context, config AutoscalerConfig, state instanceState, result *ScaleResult) {
+	currentPU := result.CurrentPU
+	if matchReference(ctx, config, state, result) {
+		return
+	}
+	result.trace("min_sample_count", traceOutcome(result.Diagnostics.SampleCount < config.MinSampleCount), map[string]any{
+		"samples":        result.Diagnostics.SampleCount,
+		"minSampleCount": config.MinSampleCount,
+	})
+	if result.Diagnostics.SampleCount < config.MinSampleCount {
+		logf(ctx, "Skipping scaling due to insufficient samples: %d < %d", result.Diagnostics.SampleCount, config.MinSampleCount)
+		result.Reason = reasonInsufficientSamples
+		result.Message = fmt.Sprintf("Skipping scaling due to insufficient CPU samples (%d < %d).", result.Diagnostics.SampleCount, config.MinSampleCount)
+		return
+	}
+
+	skip := skipLowCoverage(ctx, config, result)
+	if config.MetricCoverage != nil {
+		result.trace("metric_coverage", traceOutcome(skip), map[string]any{
+			"ratio":    result.Diagnostics.MetricCoverageRatio,
+			"minRatio": config.MetricCoverage.MinRatio,
+			"action":   config.MetricCoverage.Action,
+		})
+	}
+	if skip {
+		return
 	}
-	interval := time.Duration(intervalMinutes) * time.Minute
 
 	// スケーリングロジック
-	if cpuUsage > config.ScaleUpThreshold {
-		newPU := currentPU + int32(config.PUStep)
+	config = adaptThresholds(config, state, time.Now(), result)
+	config = decayScaleDownThreshold(config, state, time.Now(), result)
+	result.trace("thresholds", tracePass, map[string]any{
+		"scaleUpThreshold":   config.ScaleUpThreshold,
+		"scaleDownThreshold": config.ScaleDownThreshold,
+		"deadBandPercent":    config.DeadBandPercent,
+	})
+	if r := config.RelativeThresholds; r != nil {
+		if baseline, ok := cpuBaseline(r, state.History, time.Now()); ok {
+			result.Diagnostics.CPUBaseline = &baseline
+		}
+	}
+	evals := evaluateMetrics(config, result)
+	result.Diagnostics.Evaluations = evals
+	for _, e := range evals {
+		result.trace("evaluator:"+e.Name, e.Direction, map[string]any{
+			"value":       e.Value,
+			"permitsDown": e.PermitsDown,
+			"desiredPU":   desiredPU(config, e, currentPU),
+		})
+	}
+	agrees := quorumAgrees(config, evals[0].Direction, result.Diagnostics.QuorumReads)
+	if config.MetricQuorum != nil {
+		result.trace("metric_quorum", traceOutcome(!agrees), map[string]any{
+			"reads":  result.Diagnostics.QuorumReads,
+			"quorum": config.MetricQuorum.Quorum,
+		})
+	}
+	if !agrees {
+		logf(ctx, "Skipping scaling because metric reads do not agree: %v", result.Diagnostics.QuorumReads)
+		result.Reason = reasonNoMetricQuorum
+		result.Message = fmt.Sprintf("Skipping scaling because fewer than %d of %d metric reads agree.", config.MetricQuorum.Quorum, config.MetricQuorum.Reads)
+		return
+	}
+	if config.PanicCPUThreshold > 0 {
+		panicked := result.CPUUsage > config.PanicCPUThreshold
+		result.trace("panic_threshold", traceOutcome(panicked), map[string]any{"cpuUsage": result.CPUUsage, "panicCPUThreshold": config.PanicCPUThreshold})
+		if panicked {
+			panicScaleUp(ctx, config, state, result)
+			return
+		}
+	}
+	wantsDown, vetoes := scaleDownVetoes(evals)
+	scaleDown := wantsDown && len(vetoes) == 0
+	if wantsDown {
+		result.trace("scale_down_veto", traceOutcome(!scaleDown), map[string]any{"vetoedBy": vetoes})
+	}
+	if reason := scaleUpReason(evals); reason != "" {
+		result.Reason = reason
+		newPU := config.stepUp(currentPU)
+		result.trace("step_up", tracePass, map[string]any{"currentPU": currentPU, "newPU": newPU, "reason": reason})
+		if reason == reasonCPUAboveThreshold {
+			if pu := preProvisionPU(config, result); pu > newPU {
+				if len(config.SizeLadder) > 0 {
+					pu = config.ladderCeil(pu)
+				}
+				logf(ctx, "Pre-provisioning %d PUs for projected CPU usage %.2f%%", pu, result.Diagnostics.ProjectedCPUUsage)
+				result.trace("pre_provision", tracePass, map[string]any{"projectedCPUUsage": result.Diagnostics.ProjectedCPUUsage, "newPU": pu})
+				newPU = pu
+			}
+		}
 		if newPU > int32(config.PUMax) {
+			result.trace("clamp_pu_max", traceClamped, map[string]any{"newPU": newPU, "puMax": config.PUMax})
 			newPU = int32(config.PUMax)
 		}
 		if newPU != currentPU {
-			log.Printf("Scaling up to %d PUs", newPU)
-			if err := updateProcessingUnits(ctx, instanceName, newPU); err != nil {
-				log.Printf("Failed to update processing units: %v", err)
-				http.Error(w, "Failed to update processing units.", http.StatusInternalServerError)
-				return
+			result.Action = actionScaleUp
+			result.NewPU = newPU
+			result.Message = fmt.Sprintf("Scaled up to %d PUs.", newPU)
+		} else {
+			result.Reason = reasonAtMaxPU
+			if reason == reasonStorageAboveThreshold {
+				result.Message = "Storage utilization is high, but already at max PUs."
+			} else {
+				result.Message = "CPU usage is high, but already at max PUs."
 			}
-			lastResizedStore.Lock()
-			lastResizedStore.m[instanceName] = time.Now()
-			lastResizedStore.Unlock()
-			fmt.Fprintf(w, "Scaled up to %d PUs.", newPU)
+		}
+	} else if scaleDown && config.MinimizeCost {
+		result.Reason = reasonCPUBelowThreshold
+		floor := scaleDownFloor(config, result)
+		result.trace("minimize_cost", traceOutcome(currentPU <= floor), map[string]any{"currentPU": currentPU, "floor": floor})
+		if currentPU <= floor {
+			setAtFloor(ctx, config, result)
+			return
+		}
+		if deferForQuietPeriod(ctx, config, state, time.Now(), result) {
+			return
+		}
+		if !state.LastResized.IsZero() && time.Since(state.LastResized) < minUpdateInterval() {
+			logf(ctx, "Skipping scale down due to update rate limit.")
+			result.Reason = reasonRateLimited
+			result.Message = "Skipping scale down due to update rate limit."
+			return
+		}
+		result.Action = actionScaleDown
+		result.NewPU = floor
+		result.Message = fmt.Sprintf("Scaled down to %d PUs.", result.NewPU)
+	} else if scaleDown {
+		result.Reason = reasonCPUBelowThreshold
+		if deferForQuietPeriod(ctx, config, state, time.Now(), result) {
+			return
+		}
+		cooldown := config.cooldown(state.LastChangePU)
+		result.Diagnostics.CooldownSeconds = cooldown.Seconds()
+		waiting := !state.LastResized.IsZero() && time.Since(state.LastResized) < cooldown && !config.decaysAfterScaleUp(state)
+		inputs := map[string]any{"cooldownSeconds": cooldown.Seconds()}
+		if !state.LastResized.IsZero() {
+			inputs["secondsSinceLastResize"] = time.Since(state.LastResized).Seconds()
+		}
+		result.trace("cooldown", traceOutcome(waiting), inputs)
+		if waiting {
+			logf(ctx, "Skipping scale down due to interval.")
+			result.Reason = reasonCooldown
+			result.Message = "Skipping scale down due to interval."
+			return
+		}
+		// 減衰する抑止で cooldown を置き換えた場合も、更新の間隔の制限は守ります。
+		if config.decaysAfterScaleUp(state) && time.Since(state.LastResized) < minUpdateInterval() {
+			logf(ctx, "Skipping scale down due to update rate limit.")
+			result.Reason = reasonRateLimited
+			result.Message = "Skipping scale down due to update rate limit."
+			return
+		}
+
+		newPU := config.stepDown(currentPU)
+		result.trace("step_down", tracePass, map[string]any{"currentPU": currentPU, "newPU": newPU})
+		if floor := scaleDownFloor(config, result); newPU < floor {
+			result.trace("clamp_floor", traceClamped, map[string]any{"newPU": newPU, "floor": floor})
+			newPU = floor
+		}
+		if newPU < currentPU {
+			result.Action = actionScaleDown
+			result.NewPU = newPU
+			result.Message = fmt.Sprintf("Scaled down to %d PUs.", newPU)
 		} else {
-			fmt.Fprintf(w, "CPU usage is high, but already at max PUs.")
-		}
-	} else if cpuUsage < config.ScaleDownThreshold {
-		lastResizedStore.Lock()
-		lastResized, ok := lastResizedStore.m[instanceName]
-		lastResizedStore.Unlock()
-		if ok && time.Since(lastResized) < interval {
-			log.Printf("Skipping scale down due to interval.")
-			fmt.Fprintf(w, "Skipping scale down due to interval.")
+			setAtFloor(ctx, config, result)
+		}
+	} else if wantsDown {
+		logf(ctx, "Skipping scale down vetoed by %v.", vetoes)
+		result.Reason = reasonScaleDownVetoed
+		result.ScaleDownVetoedBy = vetoes
+		result.Message = fmt.Sprintf("CPU usage is low, but scale down was vetoed by %s.", strings.Join(vetoes, ", "))
+	} else {
+		drifted := driftDown(ctx, config, state, evals, result)
+		if config.DriftZone != nil {
+			result.trace("drift_zone", traceOutcome(drifted), map[string]any{"invocations": result.Diagnostics.DriftInvocations, "widthPercent": config.DriftZone.WidthPercent})
+		}
+		if drifted {
 			return
 		}
+		logf(ctx, "CPU usage is within the normal range.")
+		result.Reason = reasonWithinRange
+		result.Message = "CPU usage is within the normal range."
+	}
+}
+
+// scaleDownFloor はスケールダウンの下限の PU を返します。
+// NoShrinkWindow 内では、期間に入った時点の PU と PUMin の大きい方です。
+func scaleDownFloor(config AutoscalerConfig, result *ScaleResult) int32 {
+	floor := int32(config.PUMin)
+	if result.noShrinkFloor > floor {
+		floor = result.noShrinkFloor
+	}
+	return floor
+}
+
+// setAtFloor は既に下限の PU でスケールダウンできない理由を result に設定します。
+func setAtFloor(ctx context.Context, config AutoscalerConfig, result *ScaleResult) {
+	if result.noShrinkFloor > int32(config.PUMin) {
+		logf(ctx, "Skipping scale down due to no-shrink window.")
+		result.Reason = reasonNoShrinkWindow
+		result.Message = fmt.Sprintf("CPU usage is low, but scale down below %d PUs is locked during the no-shrink window.", result.noShrinkFloor)
+		return
+	}
+	result.Reason = reasonAtMinPU
+	result.Message = "CPU usage is low, but already at min PUs."
+}
+
+// clampToSafeMode は SafeMode が有効な場合に、判断した変化量を1ステップに制限します。
+// 判断の後に適用するため、どの設定で決まった変化量にも効きます。
+// panicCPUThreshold によるスケールアップはステップを無視して puMax までスケールアップするため制限しません。
+func clampToSafeMode(ctx context.Context, config AutoscalerConfig, result *ScaleResult) {
+	if !config.SafeMode {
+		return
+	}
+	if result.panicked {
+		result.trace("safe_mode", tracePass, map[string]any{"newPU": result.NewPU, "panicked": true})
+		return
+	}
+	newPU := result.NewPU
+	switch up, down := config.stepUp(result.CurrentPU), config.stepDown(result.CurrentPU); {
+	case newPU > up:
+		newPU = up
+	case newPU < down:
+		newPU = down
+	default:
+		result.trace("safe_mode", tracePass, map[string]any{"newPU": newPU, "maxPU": up, "minPU": down})
+		return
+	}
+	result.trace("safe_mode", traceClamped, map[string]any{"newPU": result.NewPU, "clampedPU": newPU})
+	logf(ctx, "Safe mode clamped the resize from %d to %d PUs.", result.NewPU, newPU)
+	result.NewPU = newPU
+	result.SafeModeClamped = true
+	if result.Action == actionScaleUp {
+		result.Message = fmt.Sprintf("Scaled up to %d PUs (limited to one step by safe mode).", newPU)
+	} else {
+		result.Message = fmt.Sprintf("Scaled down to %d PUs (limited to one step by safe mode).", newPU)
+	}
+}
+
+// retryPending は前回までに失敗したリサイズが残っていれば、その再試行を result に設定します。
+// 今回の判断でリサイズする場合は、そちらが pending を置き換えます。
+func retryPending(ctx context.Context, config AutoscalerConfig, state instanceState, result *ScaleResult) {
+	if state.PendingPU == 0 {
+		return
+	}
+	if result.Action != actionNone {
+		result.trace("pending_retry", "superseded", map[string]any{"pendingPU": state.PendingPU})
+		return
+	}
+	pu := state.PendingPU
+	if pu > int32(config.PUMax) {
+		pu = int32(config.PUMax)
+	}
+	if floor := scaleDownFloor(config, result); pu < floor {
+		pu = floor
+	}
+	if pu == result.CurrentPU {
+		// 既に目標のサイズになっているため、次の apply で pending を消します。
+		return
+	}
+	result.trace("pending_retry", traceStop, map[string]any{"pendingPU": state.PendingPU, "newPU": pu})
+	logf(ctx, "Retrying pending resize to %d PUs.", pu)
+	result.Action = actionScaleUp
+	if pu < result.CurrentPU {
+		result.Action = actionScaleDown
+	}
+	result.NewPU = pu
+	result.Reason = reasonPendingRetry
+	result.Message = fmt.Sprintf("Retried pending resize to %d PUs.", pu)
+}
 
-		newPU := currentPU - int32(config.PUStep)
-		if newPU < int32(config.PUMin) {
-			newPU = int32(config.PUMin)
+// apply は evaluate が決定した Processing Unit にインスタンスをリサイズし、判断の結果を history に記録します。
+func apply(ctx context.Context, result *ScaleResult) error {
+	clampToFleetCap(ctx, result.config, result, true)
+	if result.FleetCapped {
+		notify(ctx, resultNotification(severityWarning, result))
+	}
+	switch result.Action {
+	case actionScaleUp:
+		logf(ctx, "Scaling up %s to %d PUs", result.label(), result.NewPU)
+	case actionScaleDown:
+		logf(ctx, "Scaling down %s to %d PUs", result.label(), result.NewPU)
+	}
+
+	resized := result.Action == actionScaleUp || result.Action == actionScaleDown
+	if resized && skipNearDeadline(ctx, result) {
+		result.trace("deadline", traceStop, map[string]any{"minUpdateBudgetSeconds": minUpdateBudget().Seconds()})
+		resized = false
+	}
+	if resized {
+		err := updateWithRetries(ctx, result)
+		outcome := "updated"
+		switch {
+		case errors.Is(err, errNoChange):
+			outcome = actionNoChange
+		case err != nil:
+			outcome = "failed"
 		}
-		if newPU != currentPU {
-			log.Printf("Scaling down to %d PUs", newPU)
-			if err := updateProcessingUnits(ctx, instanceName, newPU); err != nil {
-				log.Printf("Failed to update processing units: %v", err)
-				http.Error(w, "Failed to update processing units.", http.StatusInternalServerError)
-				return
+		result.trace("update", outcome, map[string]any{"newPU": result.NewPU})
+		if errors.Is(err, errNoChange) {
+			// 成功として扱いますが、リサイズはしていないため cooldown は更新しません。
+			logf(ctx, "%s already has %d PUs; no change was made", result.label(), result.NewPU)
+			resized = false
+			result.Action = actionNoChange
+			result.Reason = reasonAlreadyAtTarget
+			result.Message = fmt.Sprintf("Instance already has %d PUs; no change was made.", result.NewPU)
+		} else if err != nil {
+			logf(ctx, "Failed to update processing units: %v", err)
+			if result.config.RetryPendingUpdates {
+				updateState(result.instanceName, func(s *instanceState) {
+					s.PendingPU = result.NewPU
+				})
+			}
+			if result.panicked {
+				n := resultNotification(severityCritical, result)
+				n.Message = fmt.Sprintf("CPU usage %.2f%% is above the panic threshold, but scaling up to %d PUs failed: %v", result.CPUUsage, result.NewPU, err)
+				notify(ctx, n)
+			}
+			return &autoscaleError{message: "Failed to update processing units.", err: err}
+		}
+	}
+	if resized && result.panicked {
+		notify(ctx, resultNotification(severityCritical, result))
+	}
+
+	// 別のプロセスと比較できるように、state の時刻は UTC の壁時計で記録します。
+	now := time.Now().UTC()
+	updateState(result.instanceName, func(s *instanceState) {
+		s.PendingPU = 0
+		s.TransientFailures = 0
+		s.NoShrinkFloorPU = result.noShrinkFloor
+		s.DisplayName = result.DisplayName
+		s.DriftInvocations = result.driftInvocations
+		if resized {
+			s.LastResized = now
+			s.LastChangePU = result.NewPU - result.CurrentPU
+			if s.LastChangePU > 0 {
+				s.LastScaledUp = now
 			}
-			lastResizedStore.Lock()
-			lastResizedStore.m[instanceName] = time.Now()
-			lastResizedStore.Unlock()
-			fmt.Fprintf(w, "Scaled down to %d PUs.", newPU)
+		}
+		s.appendHistory(historyEntry{
+			Time:               now,
+			CPUUsage:           result.CPUUsage,
+			CurrentPU:          result.CurrentPU,
+			NewPU:              result.NewPU,
+			PUMin:              int32(result.config.PUMin),
+			PUMax:              int32(result.config.PUMax),
+			ScaleUpThreshold:   result.config.ScaleUpThreshold,
+			ScaleDownThreshold: result.config.ScaleDownThreshold,
+			Action:             result.Action,
+			Reason:             result.Reason,
+			RequestID:          result.RequestID,
+		})
+	})
+	result.trace("final", result.Action, map[string]any{"currentPU": result.CurrentPU, "newPU": result.NewPU, "reason": result.Reason})
+	recordDecisionMetrics(ctx, result)
+	pushDecision(ctx, result)
+	return nil
+}
+
+// updateRetryBackoff は UpdateInstance を再試行するまでの待ち時間です。
+var updateRetryBackoff = 2 * time.Second
+
+// updateWithRetries は UpdateRetries 回まで再試行しながら result.NewPU にリサイズします。
+func updateWithRetries(ctx context.Context, result *ScaleResult) error {
+	var err error
+	for attempt := 0; attempt <= result.config.UpdateRetries; attempt++ {
+		if attempt > 0 {
+			logf(ctx, "Retrying update processing units (%d/%d): %v", attempt, result.config.UpdateRetries, err)
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(time.Duration(attempt) * updateRetryBackoff):
+			}
+		}
+		err = updateCapacity(ctx, result.instanceName, result.targetCapacity())
+		if err == nil || errors.Is(err, errNoChange) {
+			return err
+		}
+	}
+	return err
+}
+
+// roundUpProcessingUnits は pu を Spanner が受け付ける粒度に切り上げます。
+// 1000 PU 未満は 100 PU 単位、1000 PU 以上は 1000 PU 単位です。
+func roundUpProcessingUnits(pu int32) int32 {
+	if pu <= 0 {
+		return 0
+	}
+	unit := int32(100)
+	if pu > 1000 {
+		unit = 1000
+	}
+	return (pu + unit - 1) / unit * unit
+}
+
+// resizeInterval はスケールダウンを抑止する最終リサイズからの間隔を返します。
+func resizeInterval() time.Duration {
+	return durationFromEnv("RESIZE_INTERVAL_MINUTES", 30, time.Minute)
+}
+
+// minUpdateInterval は Spanner のインスタンスを続けてリサイズする際に空ける最小の間隔です。
+func minUpdateInterval() time.Duration {
+	return durationFromEnv("MIN_UPDATE_INTERVAL_SECONDS", 60, time.Second)
+}
+
+// defaultUpdateProgressInterval は UPDATE_PROGRESS_INTERVAL_SECONDS が正の値でない場合に使う間隔です。
+const defaultUpdateProgressInterval = 10 * time.Second
+
+// updateProgressInterval は UpdateInstance の完了を待つ間に poll して経過時間をログに出力する間隔です。
+// 0 以下の値では poll の間隔にできないため、ログに出力してデフォルト値を使います。
+func updateProgressInterval() time.Duration {
+	interval := durationFromEnv("UPDATE_PROGRESS_INTERVAL_SECONDS", int(defaultUpdateProgressInterval/time.Second), time.Second)
+	if interval <= 0 {
+		log.Printf("Invalid UPDATE_PROGRESS_INTERVAL_SECONDS %s; using %s", interval, defaultUpdateProgressInterval)
+		return defaultUpdateProgressInterval
+	}
+	return interval
+}
+
+// readTimeout は GetInstance, ListTimeSeries などの読み取りに使うタイムアウトを返します。
+func readTimeout() time.Duration {
+	return durationFromEnv("READ_TIMEOUT_SECONDS", 10, time.Second)
+}
+
+// updateTimeout は UpdateInstance の開始から op.Wait の完了までに使うタイムアウトを返します。
+func updateTimeout() time.Duration {
+	return durationFromEnv("UPDATE_TIMEOUT_SECONDS", 240, time.Second)
+}
+
+// durationFromEnv は環境変数 key の整数値を unit 単位の時間として返します。
+// 未設定または不正な値の場合は def を使います。
+func durationFromEnv(key string, def int, unit time.Duration) time.Duration {
+	v := def
+	if s := os.Getenv(key); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			log.Printf("Invalid %s: %v", key, err)
 		} else {
-			fmt.Fprintf(w, "CPU usage is low, but already at min PUs.")
+			v = n
 		}
-	} else {
-		log.Printf("CPU usage is within the normal range.")
-		fmt.Fprintf(w, "CPU usage is within the normal range.")
 	}
+	return time.Duration(v) * unit
+}
+
+// instanceInfo は GetInstance で取得したインスタンスの情報です。
+type instanceInfo struct {
+	Capacity    capacityTarget
+	DisplayName string
+	// CreateTime はインスタンスの作成時刻です。GetInstance が返さない場合はゼロ値です。
+	CreateTime time.Time
+	// Config はインスタンス構成の名前です。
+	Config string
 }
 
-func getCurrentProcessingUnits(ctx context.Context, instanceName string) (int32, error) {
-	instanceAdminClient, err := instanceadmin.NewInstanceAdminClient(ctx)
+// getCurrentCapacity はインスタンスの現在のサイズと表示名などの情報を返します。
+func getCurrentCapacity(ctx context.Context, instanceName string) (instanceInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout())
+	defer cancel()
+
+	instanceAdminClient, err := newInstanceAdminClient(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create spanner instance admin client: %w", err)
+		return instanceInfo{}, fmt.Errorf("failed to create spanner instance admin client: %w", err)
 	}
 	defer instanceAdminClient.Close()
 
 	instance, err := instanceAdminClient.GetInstance(ctx, &instancepb.GetInstanceRequest{Name: instanceName})
 	if err != nil {
-		return 0, fmt.Errorf("failed to get instance: %w", err)
+		return instanceInfo{}, fmt.Errorf("failed to get instance: %w", err)
+	}
+	info := instanceInfo{Capacity: capacityOf(instance), DisplayName: instance.GetDisplayName(), Config: instance.GetConfig()}
+	if instance.GetCreateTime() != nil {
+		info.CreateTime = instance.GetCreateTime().AsTime()
 	}
+	return info, nil
+}
 
-	return instance.GetProcessingUnits(), nil
+// metricReading は lookback window 内に取得できたメトリクスの値です。
+type metricReading struct {
+	// Usage は最新のデータポイントの値です。CPU 使用率などの割合は % に変換しています。
+	Usage float64
+	// Samples は取得できたデータポイントの数です。
+	Samples int
+	// SlopePerMinute は取得できたデータポイントの 1 分あたりの変化量です。
+	SlopePerMinute float64
+	// CoveredSeconds は lookback window のうちデータポイントがある期間の秒数です。metricQuery の場合は 0 です。
+	CoveredSeconds float64
 }
 
-func getSpannerCPUUsage(ctx context.Context, projectID, instanceID string) (float64, error) {
-	c, err := monitoringclient.NewMetricClient(ctx)
+const (
+	cpuUtilizationMetric     = "spanner.googleapis.com/instance/cpu/utilization"
+	storageUtilizationMetric = "spanner.googleapis.com/instance/storage/utilization"
+	requestLatencyMetric     = "spanner.googleapis.com/api/request_latencies"
+)
+
+// metricLookback は CPU 使用率などを読み取る期間です。
+const metricLookback = 5 * time.Minute
+
+func getSpannerCPUUsage(ctx context.Context, projectID, instanceID string) (*metricReading, error) {
+	reading, err := getSpannerUtilization(ctx, projectID, instanceID, cpuUtilizationMetric)
 	if err != nil {
-		return 0, err
+		return reading, err
+	}
+	if reading.Samples == 0 {
+		return nil, fmt.Errorf("no CPU usage data found for the last 5 minutes")
+	}
+	return reading, nil
+}
+
+func getSpannerStorageUtilization(ctx context.Context, projectID, instanceID string) (*metricReading, error) {
+	reading, err := getSpannerUtilization(ctx, projectID, instanceID, storageUtilizationMetric)
+	if err != nil {
+		return nil, err
+	}
+	if reading.Samples == 0 {
+		return nil, fmt.Errorf("no storage utilization data found for the last 5 minutes")
+	}
+	return reading, nil
+}
+
+// getSpannerUtilization は直近5分間の metricType の割合を % で返します。
+func getSpannerUtilization(ctx context.Context, projectID, instanceID, metricType string) (*metricReading, error) {
+	return listTimeSeriesReading(ctx, projectID, instanceID, metricType, nil, 100)
+}
+
+// getSpannerLatency は直近5分間の API リクエストの p99 レイテンシを ms で返します。
+// リクエストがなくデータポイントがない場合は Samples が 0 の reading を返します。
+func getSpannerLatency(ctx context.Context, projectID, instanceID string) (*metricReading, error) {
+	aggregation := &monitoringpb.Aggregation{
+		AlignmentPeriod:    durationpb.New(time.Minute),
+		PerSeriesAligner:   monitoringpb.Aggregation_ALIGN_DELTA,
+		CrossSeriesReducer: monitoringpb.Aggregation_REDUCE_PERCENTILE_99,
+	}
+	// request_latencies の単位は秒です。
+	return listTimeSeriesReading(ctx, projectID, instanceID, requestLatencyMetric, aggregation, 1000)
+}
+
+// listTimeSeriesReading は直近5分間の metricType のデータポイントを scale 倍した値で返します。
+// 読み取りの途中でエラーになった場合は、それまでに読み取った reading とエラーの両方を返します。
+func listTimeSeriesReading(ctx context.Context, projectID, instanceID, metricType string, aggregation *monitoringpb.Aggregation, scale float64) (*metricReading, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout())
+	defer cancel()
+
+	c, err := newMetricClient(ctx)
+	if err != nil {
+		return nil, err
 	}
 	defer c.Close()
 
 	now := time.Now()
-	startTime := now.Add(-5 * time.Minute)
+	startTime := now.Add(-metricLookback)
 
 	req := &monitoringpb.ListTimeSeriesRequest{
 		Name:   "projects/" + projectID,
-		Filter: fmt.Sprintf(`metric.type="spanner.googleapis.com/instance/cpu/utilization" resource.labels.instance_id="%s"`, instanceID),
+		Filter: fmt.Sprintf(`metric.type="%s" resource.labels.instance_id="%s"`, metricType, instanceID),
 		Interval: &monitoringpb.TimeInterval{
 			StartTime: timestamppb.New(startTime),
 			EndTime:   timestamppb.New(now),
 		},
-		View: monitoringpb.ListTimeSeriesRequest_FULL,
+		Aggregation: aggregation,
+		View:        monitoringpb.ListTimeSeriesRequest_FULL,
 	}
 
+	var reading metricReading
+	var latest time.Time
+	var points []trendPoint
+	var iterErr error
 	it := c.ListTimeSeries(ctx, req)
 	for {
 		resp, err := it.Next()
@@ -191,38 +1212,97 @@ func getSpannerCPUUsage(ctx context.Context, projectID, instanceID string) (floa
 			break
 		}
 		if err != nil {
-			return 0, fmt.Errorf("could not read time series value: %w", err)
+			iterErr = fmt.Errorf("could not read time series value: %w", err)
+			break
 		}
-		if len(resp.GetPoints()) > 0 {
-			return resp.GetPoints()[0].GetValue().GetDoubleValue() * 100, nil
+		for _, p := range resp.GetPoints() {
+			reading.Samples++
+			t, v := p.GetInterval().GetEndTime().AsTime(), p.GetValue().GetDoubleValue()*scale
+			points = append(points, trendPoint{t: t, v: v})
+			if reading.Samples == 1 || t.After(latest) {
+				latest = t
+				reading.Usage = v
+			}
 		}
 	}
-	return 0, fmt.Errorf("no CPU usage data found for the last 5 minutes")
+	sort.Slice(points, func(i, j int) bool { return points[i].t.Before(points[j].t) })
+	reading.SlopePerMinute = trendSlope(points)
+	reading.CoveredSeconds = coveredDuration(points, now, metricLookback).Seconds()
+	// 途中でエラーになった場合も、呼び出し元が判断できるようにそれまでに読み取った値を返します。
+	return &reading, iterErr
 }
 
-func updateProcessingUnits(ctx context.Context, instanceName string, pu int32) error {
-	instanceAdminClient, err := instanceadmin.NewInstanceAdminClient(ctx)
+// errNoChange は UpdateInstance がインスタンスを変更しなかったことを表します。
+// インスタンスが既に要求したサイズの場合に返し、失敗とは区別して扱います。
+var errNoChange = errors.New("instance already has the requested capacity")
+
+// updateCapacity はインスタンスを target にリサイズします。
+// UpdateInstance の Instance と field mask は target から作ります。
+func updateCapacity(ctx context.Context, instanceName string, target capacityTarget) error {
+	// op.Wait は読み取りよりも時間がかかるため、別のタイムアウトを使います。
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout())
+	defer cancel()
+
+	instanceAdminClient, err := newInstanceAdminClient(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to create spanner instance admin client: %w", err)
 	}
 	defer instanceAdminClient.Close()
 
-	op, err := instanceAdminClient.UpdateInstance(ctx, &instancepb.UpdateInstanceRequest{
-		Instance: &instancepb.Instance{
-			Name:            instanceName,
-			ProcessingUnits: pu,
-		},
-		FieldMask: &fieldmaskpb.FieldMask{
-			Paths: []string{"processing_units"},
-		},
-	})
+	req := target.updateRequest(instanceName)
+	if target.NodeCountConfigured && !target.usesNodeCount() {
+		logf(ctx, "%s cannot be expressed as node_count; updating processing_units of %s", target, instanceName)
+	}
+	// 同じインスタンスを同時に更新しないように、完了を待ち終えるまで lease を持ち続けます。
+	ttl := leaseTTL()
+	l, err := leaseStore().Acquire(ctx, instanceName, ttl)
+	if err != nil {
+		return fmt.Errorf("failed to acquire lease: %w", err)
+	}
+	defer func() {
+		if err := l.Release(context.WithoutCancel(ctx)); err != nil {
+			logf(ctx, "Failed to release lease of %s: %v", instanceName, err)
+		}
+	}()
+
+	op, err := instanceAdminClient.UpdateInstance(ctx, req)
+	if isNoChange(err) {
+		return fmt.Errorf("%w: %v", errNoChange, err)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to start update instance operation: %w", err)
 	}
 
-	if _, err := op.Wait(ctx); err != nil {
+	if err := waitHoldingLease(ctx, op, instanceName, l, ttl, updateProgressInterval()); isNoChange(err) {
+		return fmt.Errorf("%w: %v", errNoChange, err)
+	} else if err != nil {
 		return fmt.Errorf("failed to wait for update instance operation: %w", err)
 	}
 
 	return nil
 }
+
+// waitWithProgress は op が完了するまで interval ごとに poll し、待っている間は経過時間をログに出力します。
+func waitWithProgress(ctx context.Context, op updateInstanceOperation, instanceName string, interval time.Duration) error {
+	start := time.Now()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := op.Poll(ctx); err != nil {
+			if ctx.Err() != nil {
+				return context.Cause(ctx)
+			}
+			return err
+		}
+		if op.Done() {
+			logf(ctx, "Update of %s completed in %s", instanceName, time.Since(start).Round(time.Second))
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-ticker.C:
+			logf(ctx, "Waiting for update of %s: %s elapsed", instanceName, time.Since(start).Round(time.Second))
+		}
+	}
+}
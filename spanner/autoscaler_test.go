@@ -1,10 +1,20 @@
 package spanner
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
+
+	instancepb "cloud.google.com/go/spanner/admin/instance/apiv1/instancepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestHandler_Integration(t *testing.T) {
@@ -44,3 +54,521 @@ func TestHandler_Integration(t *testing.T) {
 	// レスポンスボディの内容をログに出力して確認
 	t.Logf("Response Body: %s", rr.Body.String())
 }
+
+func TestTimeouts(t *testing.T) {
+	t.Setenv("READ_TIMEOUT_SECONDS", "5")
+	t.Setenv("UPDATE_TIMEOUT_SECONDS", "600")
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 100})
+	metrics := &fakeMetricClient{cpu: map[string]float64{"a": 90}}
+	useFakes(t, admin, metrics)
+
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000}
+	config.applyDefaults()
+	ctx := context.Background()
+	start := time.Now()
+	result, err := evaluate(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := apply(ctx, result); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		deadline time.Time
+		want     time.Duration
+	}{
+		{"GetInstance", admin.getDeadline, 5 * time.Second},
+		{"ListTimeSeries", metrics.listDeadline, 5 * time.Second},
+		{"op.Wait", admin.waitDeadline, 600 * time.Second},
+	}
+	for _, tc := range cases {
+		if tc.deadline.IsZero() {
+			t.Errorf("%s: no deadline", tc.name)
+			continue
+		}
+		if got := tc.deadline.Sub(start); got < tc.want-time.Second || got > tc.want+time.Second {
+			t.Errorf("%s: timeout got %v want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestTimeouts_ParentCancellation(t *testing.T) {
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 100})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90}})
+
+	// 親 context の deadline がタイムアウトより短い場合は親の deadline が使われます。
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	parent, _ := ctx.Deadline()
+	if _, err := getCurrentCapacity(ctx, "projects/p/instances/a"); err != nil {
+		t.Fatal(err)
+	}
+	if !admin.getDeadline.Equal(parent) {
+		t.Errorf("GetInstance deadline got %v want %v", admin.getDeadline, parent)
+	}
+}
+
+func TestEvaluate_MinSampleCount(t *testing.T) {
+	cases := []struct {
+		name       string
+		samples    []float64
+		wantAction string
+		wantReason string
+	}{
+		{"below min sample count", []float64{90, 90}, actionNone, reasonInsufficientSamples},
+		{"sufficient samples", []float64{90, 90, 90}, actionScaleUp, reasonCPUAboveThreshold},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 100})
+			useFakes(t, admin, &fakeMetricClient{samples: map[string][]float64{"a": tc.samples}})
+
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000, MinSampleCount: 3}
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Action != tc.wantAction || result.Reason != tc.wantReason {
+				t.Errorf("got action=%s reason=%s want action=%s reason=%s", result.Action, result.Reason, tc.wantAction, tc.wantReason)
+			}
+			if result.Diagnostics.SampleCount != len(tc.samples) {
+				t.Errorf("sample count got %d want %d", result.Diagnostics.SampleCount, len(tc.samples))
+			}
+		})
+	}
+}
+
+func TestHandler_InsufficientSamples(t *testing.T) {
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 100})
+	useFakes(t, admin, &fakeMetricClient{samples: map[string][]float64{"a": {90}}})
+
+	body := `{"project":"p","instance":"a","puStep":100,"puMin":100,"puMax":1000,"minSampleCount":3}`
+	rr := httptest.NewRecorder()
+	Handler(rr, httptest.NewRequest(http.MethodPost, "/spanner/autoscaler", strings.NewReader(body)))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status got %d want %d: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var result ScaleResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Reason != reasonInsufficientSamples || result.Diagnostics.SampleCount != 1 {
+		t.Errorf("got reason=%s sampleCount=%d", result.Reason, result.Diagnostics.SampleCount)
+	}
+	if len(admin.updated()) != 0 {
+		t.Errorf("instance was resized")
+	}
+}
+
+func TestAutoscalerConfig_Cooldown(t *testing.T) {
+	t.Setenv("RESIZE_INTERVAL_MINUTES", "30")
+	cases := []struct {
+		name     string
+		config   AutoscalerConfig
+		changePU int32
+		want     time.Duration
+	}{
+		{"default", AutoscalerConfig{}, 1000, 30 * time.Minute},
+		{"small change", AutoscalerConfig{CooldownBaseMinutes: 5, CooldownSecondsPerPU: 3}, 100, 10 * time.Minute},
+		{"large change", AutoscalerConfig{CooldownBaseMinutes: 5, CooldownSecondsPerPU: 3}, 1000, 55 * time.Minute},
+		{"scale down change", AutoscalerConfig{CooldownBaseMinutes: 5, CooldownSecondsPerPU: 3}, -100, 10 * time.Minute},
+		{"capped", AutoscalerConfig{CooldownBaseMinutes: 5, CooldownSecondsPerPU: 3, CooldownMaxMinutes: 20}, 1000, 20 * time.Minute},
+		{"env base", AutoscalerConfig{CooldownSecondsPerPU: 6}, 100, 40 * time.Minute},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.config.cooldown(tc.changePU); got != tc.want {
+				t.Errorf("cooldown(%d) got %v want %v", tc.changePU, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEvaluate_CooldownByChangeSize(t *testing.T) {
+	cases := []struct {
+		name       string
+		lastChange int32
+		wantAction string
+	}{
+		{"small change recovers quickly", 100, actionScaleDown},
+		{"large change settles longer", 2000, actionNone},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 3000})
+			useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 10}})
+			updateState("projects/p/instances/a", func(s *instanceState) {
+				s.LastResized = time.Now().Add(-15 * time.Minute)
+				s.LastChangePU = tc.lastChange
+			})
+
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 1000, PUMin: 1000, PUMax: 5000,
+				CooldownBaseMinutes: 5, CooldownSecondsPerPU: 3, CooldownMaxMinutes: 60}
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Action != tc.wantAction {
+				t.Errorf("action got %s want %s (cooldown %vs)", result.Action, tc.wantAction, result.Diagnostics.CooldownSeconds)
+			}
+		})
+	}
+}
+
+func TestPendingRetry(t *testing.T) {
+	origBackoff := updateRetryBackoff
+	updateRetryBackoff = 0
+	t.Cleanup(func() { updateRetryBackoff = origBackoff })
+
+	const name = "projects/p/instances/a"
+	admin := newFakeInstanceAdmin(map[string]int32{name: 300})
+	metrics := &fakeMetricClient{cpu: map[string]float64{"a": 90}}
+	useFakes(t, admin, metrics)
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000, UpdateRetries: 1, RetryPendingUpdates: true}
+	config.applyDefaults()
+	run := func() (*ScaleResult, error) {
+		result, err := evaluate(context.Background(), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result, apply(context.Background(), result)
+	}
+
+	admin.updateErr[name] = errors.New("conflicting operation")
+	if _, err := run(); err == nil {
+		t.Fatal("expected update failure")
+	}
+	if got := len(admin.updated()); got != 2 {
+		t.Errorf("update attempts got %d want 2", got)
+	}
+	if got := loadState(name).PendingPU; got != 400 {
+		t.Fatalf("pending PU got %d want 400", got)
+	}
+
+	// CPU 使用率が正常に戻っても pending のリサイズを再試行します。
+	delete(admin.updateErr, name)
+	metrics.cpu["a"] = 40
+	result, err := run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Action != actionScaleUp || result.Reason != reasonPendingRetry || result.NewPU != 400 {
+		t.Errorf("got action=%s reason=%s newPU=%d", result.Action, result.Reason, result.NewPU)
+	}
+	if got := admin.processingUnits(name); got != 400 {
+		t.Errorf("processing units got %d want 400", got)
+	}
+	if got := loadState(name).PendingPU; got != 0 {
+		t.Errorf("pending PU was not cleared: %d", got)
+	}
+}
+
+func TestApply_NoChange(t *testing.T) {
+	const name = "projects/p/instances/a"
+	admin := newFakeInstanceAdmin(map[string]int32{name: 100})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90}})
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000, UpdateRetries: 2}
+	config.applyDefaults()
+	result, err := evaluate(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 判断した後に外部で同じサイズにリサイズされ、UpdateInstance は何も変更しません。
+	admin.instances[name].ProcessingUnits = 200
+	admin.updateErr[name] = status.Error(codes.AlreadyExists, "instance already has 200 processing units")
+	if err := apply(context.Background(), result); err != nil {
+		t.Fatalf("no-op update was treated as a failure: %v", err)
+	}
+	if result.Action != actionNoChange || result.Reason != reasonAlreadyAtTarget || result.NewPU != 200 {
+		t.Errorf("got action=%s reason=%s newPU=%d", result.Action, result.Reason, result.NewPU)
+	}
+	if got := len(admin.updated()); got != 1 {
+		t.Errorf("update attempts got %d want 1", got)
+	}
+	state := loadState(name)
+	if !state.LastResized.IsZero() {
+		t.Errorf("cooldown was updated: %v", state.LastResized)
+	}
+	if len(state.History) != 1 || state.History[0].Action != actionNoChange {
+		t.Errorf("history got %+v", state.History)
+	}
+}
+
+func TestPendingRetry_SupersededByNewDecision(t *testing.T) {
+	const name = "projects/p/instances/a"
+	admin := newFakeInstanceAdmin(map[string]int32{name: 300})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 10}})
+	updateState(name, func(s *instanceState) { s.PendingPU = 400 })
+
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000, RetryPendingUpdates: true}
+	config.applyDefaults()
+	result, err := evaluate(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := apply(context.Background(), result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Action != actionScaleDown || result.NewPU != 200 {
+		t.Errorf("got action=%s newPU=%d want scale_down to 200", result.Action, result.NewPU)
+	}
+	if got := loadState(name).PendingPU; got != 0 {
+		t.Errorf("pending PU was not cleared: %d", got)
+	}
+}
+
+func TestEvaluate_MinimizeCost(t *testing.T) {
+	t.Setenv("MIN_UPDATE_INTERVAL_SECONDS", "60")
+	const name = "projects/p/instances/a"
+	admin := newFakeInstanceAdmin(map[string]int32{name: 5000})
+	metrics := &fakeMetricClient{cpu: map[string]float64{"a": 5}}
+	useFakes(t, admin, metrics)
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 1000, PUMin: 100, PUMax: 5000, MinimizeCost: true}
+	config.applyDefaults()
+	run := func() *ScaleResult {
+		t.Helper()
+		result, err := evaluate(context.Background(), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := apply(context.Background(), result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	// 直前にスケールアップしていても、cooldown を無視して一度に PUMin まで縮めます。
+	updateState(name, func(s *instanceState) {
+		s.LastResized = time.Now().Add(-2 * time.Minute)
+		s.LastChangePU = 1000
+	})
+	if result := run(); result.Action != actionScaleDown || result.NewPU != 100 {
+		t.Errorf("got action=%s newPU=%d want scale_down to 100", result.Action, result.NewPU)
+	}
+	if result := run(); result.Reason != reasonAtMinPU {
+		t.Errorf("at floor: got reason=%s", result.Reason)
+	}
+
+	// 負荷が上がれば通常どおりスケールアップします。
+	metrics.cpu["a"] = 90
+	if result := run(); result.Action != actionScaleUp || result.NewPU != 1100 {
+		t.Errorf("got action=%s newPU=%d want scale_up to 1100", result.Action, result.NewPU)
+	}
+
+	// 更新の間隔の制限だけは守ります。
+	metrics.cpu["a"] = 5
+	if result := run(); result.Action != actionNone || result.Reason != reasonRateLimited {
+		t.Errorf("got action=%s reason=%s want rate_limited", result.Action, result.Reason)
+	}
+}
+
+func TestWaitWithProgress(t *testing.T) {
+	var buf strings.Builder
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	op := &fakeOperation{pollsUntilDone: 4}
+	if err := waitWithProgress(context.Background(), op, "projects/p/instances/a", time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if op.polls != 4 {
+		t.Errorf("polls got %d want 4", op.polls)
+	}
+	if got := strings.Count(buf.String(), "Waiting for update of projects/p/instances/a"); got != 3 {
+		t.Errorf("progress logs got %d want 3:\n%s", got, buf.String())
+	}
+	if !strings.Contains(buf.String(), "Update of projects/p/instances/a completed") {
+		t.Errorf("completion was not logged:\n%s", buf.String())
+	}
+}
+
+func TestUpdateProgressInterval(t *testing.T) {
+	cases := []struct {
+		env  string
+		want time.Duration
+	}{
+		{"", defaultUpdateProgressInterval},
+		{"5", 5 * time.Second},
+		{"0", defaultUpdateProgressInterval},
+		{"-1", defaultUpdateProgressInterval},
+	}
+	for _, tc := range cases {
+		t.Run(tc.env, func(t *testing.T) {
+			t.Setenv("UPDATE_PROGRESS_INTERVAL_SECONDS", tc.env)
+			if got := updateProgressInterval(); got != tc.want {
+				t.Errorf("got %s want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWaitWithProgress_ContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	op := &fakeOperation{pollsUntilDone: 1 << 30}
+	if err := waitWithProgress(ctx, op, "projects/p/instances/a", time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestEvaluate_NodeCountAndProcessingUnits(t *testing.T) {
+	const name = "projects/p/instances/a"
+	cases := []struct {
+		name      string
+		instance  *instancepb.Instance
+		cpu       float64
+		step      int
+		wantPU    int32
+		wantNewPU int32
+		wantMask  string
+	}{
+		{"processing_units configured", &instancepb.Instance{Name: name, ProcessingUnits: 2000, CreateTime: establishedCreateTime}, 90, 1000, 2000, 3000, "processing_units"},
+		{"node_count configured", &instancepb.Instance{Name: name, NodeCount: 2, CreateTime: establishedCreateTime}, 90, 1000, 2000, 3000, "node_count"},
+		{"node_count configured but not a whole node", &instancepb.Instance{Name: name, NodeCount: 1, CreateTime: establishedCreateTime}, 10, 100, 1000, 900, "processing_units"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := newFakeInstanceAdmin(nil)
+			admin.instances[name] = tc.instance
+			useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": tc.cpu}})
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: tc.step, PUMin: 100, PUMax: 5000}
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.CurrentPU != tc.wantPU {
+				t.Errorf("current PU got %d want %d", result.CurrentPU, tc.wantPU)
+			}
+			if err := apply(context.Background(), result); err != nil {
+				t.Fatal(err)
+			}
+			if got := admin.processingUnits(name); got != tc.wantNewPU {
+				t.Errorf("processing units got %d want %d", got, tc.wantNewPU)
+			}
+			if len(admin.fieldMasks) != 1 || len(admin.fieldMasks[0]) != 1 || admin.fieldMasks[0][0] != tc.wantMask {
+				t.Errorf("field masks got %v want [[%s]]", admin.fieldMasks, tc.wantMask)
+			}
+		})
+	}
+}
+
+func TestEvaluate_SafeMode(t *testing.T) {
+	const name = "projects/p/instances/a"
+	cases := []struct {
+		name        string
+		cpu         float64
+		pending     int32
+		wantAction  string
+		wantNewPU   int32
+		wantClamped bool
+	}{
+		{"minimizeCost scale down is limited to one step", 5, 0, actionScaleDown, 4000, true},
+		{"pending scale up is limited to one step", 40, 8000, actionScaleUp, 6000, true},
+		{"one step change is not clamped", 90, 0, actionScaleUp, 6000, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := newFakeInstanceAdmin(map[string]int32{name: 5000})
+			useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": tc.cpu}})
+			if tc.pending > 0 {
+				updateState(name, func(s *instanceState) { s.PendingPU = tc.pending })
+			}
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 1000, PUMin: 100, PUMax: 10000,
+				MinimizeCost: true, RetryPendingUpdates: true, SafeMode: true}
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Action != tc.wantAction || result.NewPU != tc.wantNewPU || result.SafeModeClamped != tc.wantClamped {
+				t.Errorf("got action=%s newPU=%d clamped=%v want action=%s newPU=%d clamped=%v",
+					result.Action, result.NewPU, result.SafeModeClamped, tc.wantAction, tc.wantNewPU, tc.wantClamped)
+			}
+		})
+	}
+}
+
+func TestHandler_DisplayName(t *testing.T) {
+	var buf strings.Builder
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 100, "projects/p/instances/b": 100})
+	admin.instances["projects/p/instances/a"].DisplayName = "Orders DB"
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90, "b": 90}})
+
+	for _, id := range []string{"a", "b"} {
+		body := `{"project": "p", "instance": "` + id + `", "puStep": 100, "puMin": 100, "puMax": 1000}`
+		rr := httptest.NewRecorder()
+		Handler(rr, httptest.NewRequest(http.MethodPost, "/spanner/autoscaler", strings.NewReader(body)))
+		var result ScaleResult
+		if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		if result.Instance != id {
+			t.Errorf("instance got %q want %q", result.Instance, id)
+		}
+		if want := map[string]string{"a": "Orders DB", "b": ""}[id]; result.DisplayName != want {
+			t.Errorf("displayName got %q want %q", result.DisplayName, want)
+		}
+	}
+	for _, line := range []string{"Scaling up Orders DB to 200 PUs", "Scaling up b to 200 PUs"} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("log does not contain %q:\n%s", line, buf.String())
+		}
+	}
+	if got := admin.updated(); len(got) != 2 {
+		t.Errorf("updated %v want both instances by name", got)
+	}
+
+	var text strings.Builder
+	writeDigestText(&text, buildDigest(time.Now().Add(time.Minute), time.Hour, "p", nil))
+	if !strings.Contains(text.String(), "Orders DB (projects/p/instances/a)") {
+		t.Errorf("digest does not label the instance with its display name:\n%s", text.String())
+	}
+}
+
+func TestEvaluate_PartialCPURead(t *testing.T) {
+	cases := []struct {
+		name           string
+		samples        []float64
+		acceptPartial  bool
+		minSampleCount int
+		wantErr        bool
+	}{
+		{"partial reads disabled", []float64{90, 90, 90}, false, 0, true},
+		{"enough samples before the error", []float64{90, 90, 90}, true, 3, false},
+		{"too few samples before the error", []float64{90, 90}, true, 3, true},
+		{"any sample without minSampleCount", []float64{90}, true, 0, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 100})
+			useFakes(t, admin, &fakeMetricClient{
+				samples: map[string][]float64{"a": tc.samples},
+				cpuErr:  map[string]error{"a": errors.New("stream reset")},
+			})
+
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000,
+				AcceptPartialReads: tc.acceptPartial, MinSampleCount: tc.minSampleCount}
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("evaluate() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if result.Action != actionScaleUp || !result.Diagnostics.PartialRead || result.Diagnostics.SampleCount != len(tc.samples) {
+				t.Errorf("got action=%s partialRead=%v sampleCount=%d", result.Action, result.Diagnostics.PartialRead, result.Diagnostics.SampleCount)
+			}
+		})
+	}
+}
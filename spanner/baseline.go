@@ -0,0 +1,109 @@
+package spanner
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const evaluatorCPUBaseline = "cpu_baseline"
+
+const reasonCPUAboveBaseline = "cpu_above_baseline"
+
+const (
+	// scaleDownModeAnd は scaleDownThreshold と baseline からの下げ幅の両方を満たした場合にスケールダウンします。
+	scaleDownModeAnd = "and"
+	// scaleDownModeOr はどちらか一方を満たした場合にスケールダウンします。
+	scaleDownModeOr = "or"
+)
+
+// RelativeThresholds adds thresholds relative to the trailing CPU baseline next to the absolute
+// scaleUpThreshold and scaleDownThreshold. Either rule can trigger a scale up; ScaleDownMode decides
+// whether a scale down needs both rules or just one.
+type RelativeThresholds struct {
+	// ScaleUpPoints を指定すると、CPU 使用率が baseline をそのポイント以上上回った場合にスケールアップします。
+	ScaleUpPoints float64 `json:"scaleUpPoints"`
+	// ScaleDownPoints を指定すると、CPU 使用率が baseline をそのポイント以上下回った場合にスケールダウンを求めます。
+	ScaleDownPoints float64 `json:"scaleDownPoints"`
+	// ScaleDownMode は and (デフォルト) か or です。
+	ScaleDownMode string `json:"scaleDownMode"`
+	// BaselineWindowMinutes は baseline にする CPU 使用率の平均をとる期間です。デフォルトは 60 分です。
+	BaselineWindowMinutes float64 `json:"baselineWindowMinutes"`
+	// MinBaselineSamples は baseline を使うのに必要な判断の記録の数です。デフォルトは 3 です。
+	MinBaselineSamples int `json:"minBaselineSamples"`
+}
+
+func (r *RelativeThresholds) applyDefaults() {
+	if r.ScaleDownMode == "" {
+		r.ScaleDownMode = scaleDownModeAnd
+	}
+	if r.BaselineWindowMinutes == 0 {
+		r.BaselineWindowMinutes = 60
+	}
+	if r.MinBaselineSamples == 0 {
+		r.MinBaselineSamples = 3
+	}
+}
+
+func (r *RelativeThresholds) validate() error {
+	if r.ScaleUpPoints < 0 || r.ScaleDownPoints < 0 || (r.ScaleUpPoints == 0 && r.ScaleDownPoints == 0) {
+		return errors.New("Invalid relativeThresholds. Set scaleUpPoints or scaleDownPoints.")
+	}
+	if r.BaselineWindowMinutes < 0 {
+		return errors.New("Invalid relativeThresholds.baselineWindowMinutes.")
+	}
+	if r.MinBaselineSamples < 0 {
+		return errors.New("Invalid relativeThresholds.minBaselineSamples.")
+	}
+	switch r.ScaleDownMode {
+	case "", scaleDownModeAnd, scaleDownModeOr:
+		return nil
+	}
+	return fmt.Errorf("Invalid relativeThresholds.scaleDownMode %q.", r.ScaleDownMode)
+}
+
+// cpuBaseline は now までの BaselineWindowMinutes の history の CPU 使用率の平均を返します。
+// 記録が MinBaselineSamples に満たない場合は false を返し、相対的な閾値は使いません。
+func cpuBaseline(r *RelativeThresholds, history []historyEntry, now time.Time) (float64, bool) {
+	since := now.Add(-time.Duration(r.BaselineWindowMinutes * float64(time.Minute)))
+	var sum float64
+	var n int
+	for _, e := range history {
+		if e.Time.Before(since) || e.Time.After(now) {
+			continue
+		}
+		sum += e.CPUUsage
+		n++
+	}
+	if n == 0 || n < r.MinBaselineSamples {
+		return 0, false
+	}
+	return sum / float64(n), true
+}
+
+// baselineEvaluation は CPU 使用率を baseline と比較します。Value は baseline からの差 (ポイント) です。
+// scaleDownPoints を指定しない場合は、baseline はスケールダウンを妨げません。
+func baselineEvaluation(r *RelativeThresholds, cpuUsage, baseline float64) Evaluation {
+	delta := cpuUsage - baseline
+	e := Evaluation{Name: evaluatorCPUBaseline, Value: delta, Direction: directionNone}
+	switch {
+	case r.ScaleUpPoints > 0 && delta >= r.ScaleUpPoints:
+		e.Direction = directionUp
+	case r.ScaleDownPoints > 0 && -delta >= r.ScaleDownPoints:
+		e.Direction = directionDown
+	}
+	e.PermitsDown = e.Direction == directionDown || (r.ScaleDownPoints == 0 && e.Direction != directionUp)
+	return e
+}
+
+// combineCPUEvaluations は scaleDownMode が or の場合に、絶対的な閾値と baseline のどちらかがスケールダウンを求めれば、
+// どちらもスケールアップを求めていない限りもう一方もスケールダウンを許可するようにします。
+// and の場合は、それぞれ自身がスケールダウンを求めた場合だけ許可するため、両方を満たす必要があります。
+func combineCPUEvaluations(r *RelativeThresholds, cpu, baseline *Evaluation) {
+	if r.ScaleDownMode != scaleDownModeOr {
+		return
+	}
+	permits := cpu.Direction != directionUp && baseline.Direction != directionUp
+	cpu.PermitsDown = permits
+	baseline.PermitsDown = permits
+}
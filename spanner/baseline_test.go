@@ -0,0 +1,93 @@
+package spanner
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEvaluate_RelativeThresholds(t *testing.T) {
+	cases := []struct {
+		name       string
+		history    []float64
+		cpu        float64
+		mode       string
+		wantAction string
+		wantReason string
+	}{
+		{"absolute scale up only", []float64{60, 60, 60}, 75, scaleDownModeAnd, actionScaleUp, reasonCPUAboveThreshold},
+		{"relative scale up only", []float64{30, 30, 30}, 55, scaleDownModeAnd, actionScaleUp, reasonCPUAboveBaseline},
+		{"neither", []float64{30, 30, 30}, 40, scaleDownModeAnd, actionNone, reasonWithinRange},
+		{"and: both scale down", []float64{30, 30, 30}, 10, scaleDownModeAnd, actionScaleDown, reasonCPUBelowThreshold},
+		{"and: absolute scale down only", []float64{15, 15, 15}, 10, scaleDownModeAnd, actionNone, reasonScaleDownVetoed},
+		{"and: relative scale down only", []float64{40, 40, 40}, 22, scaleDownModeAnd, actionNone, reasonScaleDownVetoed},
+		{"or: absolute scale down only", []float64{15, 15, 15}, 10, scaleDownModeOr, actionScaleDown, reasonCPUBelowThreshold},
+		{"or: relative scale down only", []float64{40, 40, 40}, 22, scaleDownModeOr, actionScaleDown, reasonCPUBelowThreshold},
+		// baseline を計算できるだけの記録がない場合は、絶対的な閾値だけで判断します。
+		{"too few samples", []float64{30}, 55, scaleDownModeAnd, actionNone, reasonWithinRange},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			const name = "projects/p/instances/a"
+			admin := newFakeInstanceAdmin(map[string]int32{name: 500})
+			useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": tc.cpu}})
+			updateState(name, func(s *instanceState) {
+				for i, cpu := range tc.history {
+					s.appendHistory(historyEntry{Time: time.Now().Add(-time.Duration(len(tc.history)-i) * 10 * time.Minute), CPUUsage: cpu, Action: actionNone})
+				}
+			})
+			config := AutoscalerConfig{
+				Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000,
+				ScaleUpThreshold: 70, ScaleDownThreshold: 20,
+				RelativeThresholds: &RelativeThresholds{ScaleUpPoints: 20, ScaleDownPoints: 15, ScaleDownMode: tc.mode},
+			}
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Action != tc.wantAction || result.Reason != tc.wantReason {
+				t.Errorf("got action=%s reason=%s want action=%s reason=%s", result.Action, result.Reason, tc.wantAction, tc.wantReason)
+			}
+		})
+	}
+}
+
+func TestCPUBaseline(t *testing.T) {
+	now := time.Now()
+	r := &RelativeThresholds{}
+	r.applyDefaults()
+	history := []historyEntry{
+		{Time: now.Add(-2 * time.Hour), CPUUsage: 90},
+		{Time: now.Add(-50 * time.Minute), CPUUsage: 20},
+		{Time: now.Add(-30 * time.Minute), CPUUsage: 30},
+		{Time: now.Add(-10 * time.Minute), CPUUsage: 40},
+	}
+	if got, ok := cpuBaseline(r, history, now); !ok || got != 30 {
+		t.Errorf("got %v, %v want 30 from the entries within the window", got, ok)
+	}
+	if _, ok := cpuBaseline(r, history[:2], now); ok {
+		t.Error("got a baseline from a single entry within the window")
+	}
+}
+
+func TestRelativeThresholds_Validate(t *testing.T) {
+	cases := []struct {
+		name    string
+		r       RelativeThresholds
+		wantErr bool
+	}{
+		{"scale up only", RelativeThresholds{ScaleUpPoints: 20}, false},
+		{"or", RelativeThresholds{ScaleDownPoints: 10, ScaleDownMode: scaleDownModeOr}, false},
+		{"unset", RelativeThresholds{}, true},
+		{"negative", RelativeThresholds{ScaleUpPoints: -1}, true},
+		{"unknown mode", RelativeThresholds{ScaleUpPoints: 20, ScaleDownMode: "xor"}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.r.validate(); (err != nil) != tc.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
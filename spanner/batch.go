@@ -0,0 +1,347 @@
+package spanner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	actionError   = "error"
+	actionAborted = "aborted"
+)
+
+const reasonBlastRadiusLimit = "blast_radius_limit"
+
+// BatchConfig is the configuration for autoscaling multiple instances in one request.
+type BatchConfig struct {
+	Instances        []AutoscalerConfig `json:"instances"`
+	DependencyGroups []DependencyGroup  `json:"dependencyGroups"`
+	Discovery        *DiscoveryConfig   `json:"discovery"`
+	// MaxInstancesChangedPerRun を指定すると、1回の batch でリサイズするインスタンスをその数までに制限します。
+	// 上限に達した後のインスタンスは評価だけ行い、reason に blast_radius_limit を返します。
+	MaxInstancesChangedPerRun int `json:"maxInstancesChangedPerRun"`
+	// TimeoutSeconds は batch 全体のタイムアウトです。instances の各要素の timeoutSeconds は使いません。
+	TimeoutSeconds float64 `json:"timeoutSeconds"`
+}
+
+// DependencyGroup is a set of instances that must be resized in a fixed order.
+// Scale-ups are applied in Order and scale-downs in reverse Order, one at a time.
+type DependencyGroup struct {
+	Name string `json:"name"`
+	// Order は Instances に含まれるインスタンスをスケールアップする順に並べたものです。
+	// 各要素は "project/instance" か、instance ID が batch の中で一意であれば instance ID だけで指定します。
+	Order []string `json:"order"`
+}
+
+// BatchResult is the outcome of a batch autoscaling request.
+type BatchResult struct {
+	RequestID           string         `json:"requestId,omitempty"`
+	Results             []*ScaleResult `json:"results"`
+	BlastRadiusLimitHit bool           `json:"blastRadiusLimitHit"`
+}
+
+func (b *BatchConfig) validate() error {
+	if len(b.Instances) == 0 {
+		return errors.New("No instances in JSON.")
+	}
+	configs := make(map[string]bool, len(b.Instances))
+	for i := range b.Instances {
+		if err := b.Instances[i].validate(); err != nil {
+			return err
+		}
+		name := b.Instances[i].instanceName()
+		if configs[name] {
+			return fmt.Errorf("Duplicate instance %s/%s in JSON.", b.Instances[i].Project, b.Instances[i].Instance)
+		}
+		configs[name] = true
+	}
+	grouped := make(map[int]bool)
+	for _, g := range b.DependencyGroups {
+		if g.Name == "" || len(g.Order) == 0 {
+			return errors.New("Dependency group requires name and order.")
+		}
+		for _, member := range g.Order {
+			i, err := b.memberIndex(member)
+			if err != nil {
+				return fmt.Errorf("Dependency group %s %s", g.Name, err)
+			}
+			if grouped[i] {
+				return fmt.Errorf("Instance %s belongs to more than one dependency group.", member)
+			}
+			grouped[i] = true
+		}
+	}
+	return nil
+}
+
+// memberIndex は依存グループの member が指す Instances の index を返します。
+// member は "project/instance" か instance ID で、instance ID が複数の project にある場合はエラーです。
+func (b *BatchConfig) memberIndex(member string) (int, error) {
+	project, instance, qualified := strings.Cut(member, "/")
+	if !qualified {
+		project, instance = "", member
+	}
+	found := -1
+	for i, c := range b.Instances {
+		if c.Instance != instance || (qualified && c.Project != project) {
+			continue
+		}
+		if found >= 0 {
+			return -1, fmt.Errorf("refers to instance %s in more than one project. Use project/instance.", member)
+		}
+		found = i
+	}
+	if found < 0 {
+		return -1, fmt.Errorf("refers to unknown instance %s.", member)
+	}
+	return found, nil
+}
+
+// projects は batch が対象にする project を返します。discovery の project も含みます。
+func (b *BatchConfig) projects() []string {
+	var projects []string
+	seen := make(map[string]bool)
+	add := func(p string) {
+		if p != "" && !seen[p] {
+			seen[p] = true
+			projects = append(projects, p)
+		}
+	}
+	for _, c := range b.Instances {
+		for _, p := range c.projects() {
+			add(p)
+		}
+	}
+	if b.Discovery != nil {
+		add(b.Discovery.Project)
+		template := b.Discovery.Template
+		template.Project = b.Discovery.Project
+		for _, p := range template.projects() {
+			add(p)
+		}
+	}
+	return projects
+}
+
+func BatchHandler(w http.ResponseWriter, r *http.Request) {
+	r = withRequestID(w, r)
+	var config BatchConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		http.Error(w, "Invalid JSON request body.", http.StatusBadRequest)
+		return
+	}
+	if err := authorizeCaller(r, config.projects()...); err != nil {
+		http.Error(w, err.message, err.status)
+		return
+	}
+	if rejected, err := disallowedInstances(r.Context(), config.Instances...); err != nil {
+		logf(r.Context(), "Failed to load the instance allowlist: %v", err)
+		http.Error(w, "Invalid allowlist configuration.", http.StatusInternalServerError)
+		return
+	} else if len(rejected) > 0 {
+		writeJSON(w, http.StatusForbidden, &BatchResult{RequestID: requestID(r.Context()), Results: rejected})
+		return
+	}
+	ctx, cancel := requestContext(r, config.TimeoutSeconds)
+	defer cancel()
+	if err := config.discover(ctx); err != nil {
+		var ae *autoscaleError
+		if errors.As(err, &ae) {
+			logf(ctx, "Failed to discover instances: %v", err)
+			writeError(w, err, 0)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := config.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for i := range config.Instances {
+		config.Instances[i].applyDefaults()
+	}
+
+	result := processBatch(ctx, config)
+
+	// 失敗がすべて一時的な障害であれば 503 と Retry-After を返し、呼び出し元の再試行に任せます。
+	status := http.StatusOK
+	var wait time.Duration
+	for _, res := range result.Results {
+		if res.Action != actionError {
+			continue
+		}
+		d := retryAfter(res.instanceName, res.err)
+		if d == 0 {
+			status = http.StatusInternalServerError
+			continue
+		}
+		if status == http.StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+		if d > wait {
+			wait = d
+		}
+	}
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())))
+	}
+	writeJSON(w, status, result)
+}
+
+// batchRun は1回の batch の処理中の状態です。
+type batchRun struct {
+	config  BatchConfig
+	result  *BatchResult
+	changed int
+}
+
+// processBatch は依存グループを順に処理し、その後どのグループにも属さないインスタンスを処理します。
+func processBatch(ctx context.Context, config BatchConfig) *BatchResult {
+	run := &batchRun{config: config, result: &BatchResult{RequestID: requestID(ctx)}}
+	// validate で確認済みのため、memberIndex はエラーを返しません。
+	grouped := make(map[int]bool)
+	for _, g := range config.DependencyGroups {
+		members := make([]AutoscalerConfig, 0, len(g.Order))
+		for _, member := range g.Order {
+			i, _ := config.memberIndex(member)
+			members = append(members, config.Instances[i])
+			grouped[i] = true
+		}
+		run.result.Results = append(run.result.Results, run.processDependencyGroup(ctx, g.Name, members)...)
+	}
+
+	for i, c := range config.Instances {
+		if grouped[i] {
+			continue
+		}
+		res, err := evaluate(ctx, c)
+		if err == nil {
+			err = run.apply(ctx, res)
+		}
+		if err != nil {
+			res = errorResult(c, res, err)
+		}
+		run.result.Results = append(run.result.Results, res)
+	}
+	for _, res := range run.result.Results {
+		res.RequestID = run.result.RequestID
+	}
+	return run.result
+}
+
+// apply は MaxInstancesChangedPerRun の上限に達していなければ res を適用します。
+// 上限に達している場合はリサイズせず、判断の結果だけを記録します。
+func (run *batchRun) apply(ctx context.Context, res *ScaleResult) error {
+	resize := res.Action == actionScaleUp || res.Action == actionScaleDown
+	if resize && run.config.MaxInstancesChangedPerRun > 0 && run.changed >= run.config.MaxInstancesChangedPerRun {
+		logf(ctx, "Skipping %s resize to %d PUs due to blast radius limit.", res.Instance, res.NewPU)
+		run.result.BlastRadiusLimitHit = true
+		res.Action = actionNone
+		res.NewPU = res.CurrentPU
+		res.Reason = reasonBlastRadiusLimit
+		res.Message = fmt.Sprintf("Skipping resize because %d instances were already changed in this run.", run.changed)
+	}
+	if err := apply(ctx, res); err != nil {
+		return err
+	}
+	// apply は deadline が近い場合にリサイズを取りやめるため、適用後の action で数えます。
+	if res.Action == actionScaleUp || res.Action == actionScaleDown {
+		run.changed++
+	}
+	return nil
+}
+
+// processDependencyGroup は members をすべて評価してから、
+// スケールアップを members の順に、スケールダウンを逆順に1つずつ適用します。
+// 途中で失敗した場合、残りのリサイズは行わず aborted として報告します。
+func (run *batchRun) processDependencyGroup(ctx context.Context, group string, members []AutoscalerConfig) []*ScaleResult {
+	results := make([]*ScaleResult, len(members))
+	for i, c := range members {
+		res, err := evaluate(ctx, c)
+		if err != nil {
+			// 判断材料が揃わないため、グループ内のリサイズは一切行いません。
+			results[i] = errorResult(c, nil, err)
+			for j, other := range members {
+				if j == i {
+					continue
+				}
+				results[j] = abortedResult(other, results[j], group, c.Instance)
+			}
+			for _, res := range results {
+				res.Group = group
+			}
+			return results
+		}
+		res.Group = group
+		results[i] = res
+	}
+
+	var steps []int
+	for i, res := range results {
+		if res.Action == actionScaleUp {
+			steps = append(steps, i)
+		}
+	}
+	for i := len(results) - 1; i >= 0; i-- {
+		if results[i].Action == actionScaleDown {
+			steps = append(steps, i)
+		}
+	}
+
+	// applied は run.apply を通したインスタンスです。blast_radius_limit などで action が none になっても記録済みです。
+	applied := make(map[int]bool, len(steps))
+	for n, i := range steps {
+		applied[i] = true
+		if err := run.apply(ctx, results[i]); err != nil {
+			results[i] = errorResult(members[i], results[i], err)
+			for _, j := range steps[n+1:] {
+				results[j] = abortedResult(members[j], results[j], group, members[i].Instance)
+			}
+			logf(ctx, "Aborted dependency group %s: scaling %s failed", group, members[i].Instance)
+			break
+		}
+	}
+	// リサイズしないインスタンスも判断の結果を記録します。
+	for i, res := range results {
+		if res.Action == actionNone && !applied[i] {
+			if err := apply(ctx, res); err != nil {
+				logf(ctx, "Failed to record %s: %v", res.Instance, err)
+			}
+		}
+	}
+	return results
+}
+
+func errorResult(config AutoscalerConfig, res *ScaleResult, err error) *ScaleResult {
+	if res == nil {
+		res = &ScaleResult{Project: config.Project, Instance: config.Instance, EstimatedSecondsToPUMax: noPUMaxEstimate, instanceName: config.instanceName(), config: config}
+	}
+	res.err = err
+	res.Action = actionError
+	res.NewPU = res.CurrentPU
+	res.Error = err.Error()
+	res.Message = "Internal server error."
+	var ae *autoscaleError
+	if errors.As(err, &ae) {
+		res.Message = ae.message
+	}
+	return res
+}
+
+func abortedResult(config AutoscalerConfig, res *ScaleResult, group, failed string) *ScaleResult {
+	if res == nil {
+		res = &ScaleResult{Project: config.Project, Instance: config.Instance, EstimatedSecondsToPUMax: noPUMaxEstimate}
+	}
+	res.Group = group
+	res.Action = actionAborted
+	res.NewPU = res.CurrentPU
+	res.Message = fmt.Sprintf("Aborted because scaling instance %s in dependency group %s failed.", failed, group)
+	return res
+}
@@ -0,0 +1,246 @@
+package spanner
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func batchInstance(id string) AutoscalerConfig {
+	c := AutoscalerConfig{Project: "p", Instance: id, PUStep: 100, PUMin: 100, PUMax: 1000}
+	c.applyDefaults()
+	return c
+}
+
+func projectInstance(project, id string) AutoscalerConfig {
+	c := batchInstance(id)
+	c.Project = project
+	return c
+}
+
+// 同じ instance ID のインスタンスが複数の project にあっても、project/instance で区別して依存グループに含められます。
+func TestProcessBatch_SameInstanceIDInTwoProjects(t *testing.T) {
+	admin := newFakeInstanceAdmin(map[string]int32{
+		"projects/p1/instances/prod": 500,
+		"projects/p2/instances/prod": 500,
+	})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"prod": 90}})
+	config := BatchConfig{
+		Instances:        []AutoscalerConfig{projectInstance("p1", "prod"), projectInstance("p2", "prod")},
+		DependencyGroups: []DependencyGroup{{Name: "g", Order: []string{"p2/prod", "p1/prod"}}},
+	}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+	processBatch(context.Background(), config)
+	want := []string{"projects/p2/instances/prod", "projects/p1/instances/prod"}
+	if got := admin.updated(); !reflect.DeepEqual(got, want) {
+		t.Errorf("updates: got %v want %v", got, want)
+	}
+}
+
+func TestProcessBatch_DependencyGroupOrder(t *testing.T) {
+	admin := newFakeInstanceAdmin(map[string]int32{
+		"projects/p/instances/a": 500,
+		"projects/p/instances/b": 500,
+		"projects/p/instances/c": 500,
+	})
+	cases := []struct {
+		name string
+		cpu  float64
+		want []string
+	}{
+		{"scale up in order", 90, []string{"projects/p/instances/a", "projects/p/instances/b", "projects/p/instances/c"}},
+		{"scale down in reverse order", 10, []string{"projects/p/instances/c", "projects/p/instances/b", "projects/p/instances/a"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			admin.updates = nil
+			useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": tc.cpu, "b": tc.cpu, "c": tc.cpu}})
+
+			result := processBatch(context.Background(), BatchConfig{
+				Instances:        []AutoscalerConfig{batchInstance("a"), batchInstance("b"), batchInstance("c")},
+				DependencyGroups: []DependencyGroup{{Name: "g", Order: []string{"a", "b", "c"}}},
+			})
+			if got := admin.updated(); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("update order: got %v want %v", got, tc.want)
+			}
+			for _, res := range result.Results {
+				if res.Group != "g" {
+					t.Errorf("%s: group got %q want %q", res.Instance, res.Group, "g")
+				}
+			}
+		})
+	}
+}
+
+func TestProcessBatch_DependencyGroupMixedDirections(t *testing.T) {
+	admin := newFakeInstanceAdmin(map[string]int32{
+		"projects/p/instances/a": 500,
+		"projects/p/instances/b": 500,
+		"projects/p/instances/c": 500,
+	})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 10, "b": 90, "c": 10}})
+
+	processBatch(context.Background(), BatchConfig{
+		Instances:        []AutoscalerConfig{batchInstance("a"), batchInstance("b"), batchInstance("c")},
+		DependencyGroups: []DependencyGroup{{Name: "g", Order: []string{"a", "b", "c"}}},
+	})
+	want := []string{"projects/p/instances/b", "projects/p/instances/c", "projects/p/instances/a"}
+	if got := admin.updated(); !reflect.DeepEqual(got, want) {
+		t.Errorf("update order: got %v want %v", got, want)
+	}
+}
+
+func TestProcessBatch_DependencyGroupAbortOnFailure(t *testing.T) {
+	admin := newFakeInstanceAdmin(map[string]int32{
+		"projects/p/instances/a": 500,
+		"projects/p/instances/b": 500,
+		"projects/p/instances/c": 500,
+		"projects/p/instances/d": 500,
+	})
+	admin.updateErr["projects/p/instances/b"] = errors.New("conflicting operation")
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90, "b": 90, "c": 90, "d": 90}})
+
+	result := processBatch(context.Background(), BatchConfig{
+		Instances:        []AutoscalerConfig{batchInstance("a"), batchInstance("b"), batchInstance("c"), batchInstance("d")},
+		DependencyGroups: []DependencyGroup{{Name: "g", Order: []string{"a", "b", "c"}}},
+	})
+
+	wantUpdates := []string{"projects/p/instances/a", "projects/p/instances/b", "projects/p/instances/d"}
+	if got := admin.updated(); !reflect.DeepEqual(got, wantUpdates) {
+		t.Errorf("updates: got %v want %v", got, wantUpdates)
+	}
+	wantActions := map[string]string{"a": actionScaleUp, "b": actionError, "c": actionAborted, "d": actionScaleUp}
+	for _, res := range result.Results {
+		if res.Action != wantActions[res.Instance] {
+			t.Errorf("%s: action got %q want %q", res.Instance, res.Action, wantActions[res.Instance])
+		}
+	}
+	if got := admin.processingUnits("projects/p/instances/c"); got != 500 {
+		t.Errorf("aborted instance was resized to %d", got)
+	}
+}
+
+func TestProcessBatch_DependencyGroupEvaluationFailure(t *testing.T) {
+	admin := newFakeInstanceAdmin(map[string]int32{
+		"projects/p/instances/a": 500,
+		"projects/p/instances/b": 500,
+	})
+	// b の CPU 使用率が取得できないため、グループ全体を変更しません。
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90}})
+
+	result := processBatch(context.Background(), BatchConfig{
+		Instances:        []AutoscalerConfig{batchInstance("a"), batchInstance("b")},
+		DependencyGroups: []DependencyGroup{{Name: "g", Order: []string{"a", "b"}}},
+	})
+	if got := admin.updated(); len(got) != 0 {
+		t.Errorf("updates: got %v want none", got)
+	}
+	wantActions := map[string]string{"a": actionAborted, "b": actionError}
+	for _, res := range result.Results {
+		if res.Action != wantActions[res.Instance] {
+			t.Errorf("%s: action got %q want %q", res.Instance, res.Action, wantActions[res.Instance])
+		}
+	}
+}
+
+func TestBatchConfig_Validate(t *testing.T) {
+	cases := []struct {
+		name    string
+		config  BatchConfig
+		wantErr bool
+	}{
+		{"ok", BatchConfig{Instances: []AutoscalerConfig{batchInstance("a")}, DependencyGroups: []DependencyGroup{{Name: "g", Order: []string{"a"}}}}, false},
+		{"unknown instance", BatchConfig{Instances: []AutoscalerConfig{batchInstance("a")}, DependencyGroups: []DependencyGroup{{Name: "g", Order: []string{"x"}}}}, true},
+		{"instance in two groups", BatchConfig{Instances: []AutoscalerConfig{batchInstance("a")}, DependencyGroups: []DependencyGroup{{Name: "g1", Order: []string{"a"}}, {Name: "g2", Order: []string{"a"}}}}, true},
+		{"no instances", BatchConfig{}, true},
+		{"same instance ID in two projects", BatchConfig{Instances: []AutoscalerConfig{batchInstance("a"), projectInstance("q", "a")}}, false},
+		{"duplicate instance", BatchConfig{Instances: []AutoscalerConfig{batchInstance("a"), batchInstance("a")}}, true},
+		{"qualified group member", BatchConfig{Instances: []AutoscalerConfig{batchInstance("a"), projectInstance("q", "a")}, DependencyGroups: []DependencyGroup{{Name: "g", Order: []string{"p/a", "q/a"}}}}, false},
+		{"ambiguous group member", BatchConfig{Instances: []AutoscalerConfig{batchInstance("a"), projectInstance("q", "a")}, DependencyGroups: []DependencyGroup{{Name: "g", Order: []string{"a"}}}}, true},
+		{"unknown qualified group member", BatchConfig{Instances: []AutoscalerConfig{batchInstance("a")}, DependencyGroups: []DependencyGroup{{Name: "g", Order: []string{"q/a"}}}}, true},
+		{"same instance in a group twice", BatchConfig{Instances: []AutoscalerConfig{batchInstance("a")}, DependencyGroups: []DependencyGroup{{Name: "g", Order: []string{"a", "p/a"}}}}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.config.validate(); (err != nil) != tc.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestProcessBatch_BlastRadiusLimit(t *testing.T) {
+	admin := newFakeInstanceAdmin(map[string]int32{
+		"projects/p/instances/a": 500,
+		"projects/p/instances/b": 500,
+		"projects/p/instances/c": 500,
+		"projects/p/instances/d": 500,
+	})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90, "b": 40, "c": 90, "d": 90}})
+
+	result := processBatch(context.Background(), BatchConfig{
+		Instances:                 []AutoscalerConfig{batchInstance("a"), batchInstance("b"), batchInstance("c"), batchInstance("d")},
+		MaxInstancesChangedPerRun: 2,
+	})
+
+	wantUpdates := []string{"projects/p/instances/a", "projects/p/instances/c"}
+	if got := admin.updated(); !reflect.DeepEqual(got, wantUpdates) {
+		t.Errorf("updates: got %v want %v", got, wantUpdates)
+	}
+	if !result.BlastRadiusLimitHit {
+		t.Error("blast radius limit was not reported")
+	}
+	d := result.Results[3]
+	if d.Instance != "d" || d.Action != actionNone || d.Reason != reasonBlastRadiusLimit || d.NewPU != 500 {
+		t.Errorf("d: got instance=%s action=%s reason=%s newPU=%d", d.Instance, d.Action, d.Reason, d.NewPU)
+	}
+	if got := admin.processingUnits("projects/p/instances/d"); got != 500 {
+		t.Errorf("d was resized to %d", got)
+	}
+}
+
+func TestProcessBatch_BlastRadiusLimitNotHit(t *testing.T) {
+	admin := newFakeInstanceAdmin(map[string]int32{
+		"projects/p/instances/a": 500,
+		"projects/p/instances/b": 500,
+	})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90, "b": 90}})
+
+	result := processBatch(context.Background(), BatchConfig{
+		Instances:                 []AutoscalerConfig{batchInstance("a"), batchInstance("b")},
+		MaxInstancesChangedPerRun: 2,
+	})
+	if result.BlastRadiusLimitHit {
+		t.Error("blast radius limit should not be hit")
+	}
+	if got := len(admin.updated()); got != 2 {
+		t.Errorf("updates: got %d want 2", got)
+	}
+}
+
+func TestProcessBatch_DependencyGroupRecordsOnce(t *testing.T) {
+	admin := newFakeInstanceAdmin(map[string]int32{
+		"projects/p/instances/a": 500,
+		"projects/p/instances/b": 500,
+		"projects/p/instances/c": 500,
+	})
+	// c は正常範囲のためリサイズせず、b は blast radius limit でリサイズしません。
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90, "b": 90, "c": 40}})
+
+	result := processBatch(context.Background(), BatchConfig{
+		Instances:                 []AutoscalerConfig{batchInstance("a"), batchInstance("b"), batchInstance("c")},
+		DependencyGroups:          []DependencyGroup{{Name: "g", Order: []string{"a", "b", "c"}}},
+		MaxInstancesChangedPerRun: 1,
+	})
+	if b := result.Results[1]; b.Reason != reasonBlastRadiusLimit {
+		t.Fatalf("b: reason got %s want %s", b.Reason, reasonBlastRadiusLimit)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if got := len(loadState("projects/p/instances/" + id).History); got != 1 {
+			t.Errorf("%s: got %d history entries want 1", id, got)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package spanner
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	boundMin = "min"
+	boundMax = "max"
+)
+
+// BoundsAdvisory warns when recent decisions keep the instance near puMin or puMax,
+// which usually means the bounds are mis-set.
+type BoundsAdvisory struct {
+	// WindowMinutes は集計する history の期間です。デフォルトは 1440 (1日) です。
+	WindowMinutes float64 `json:"windowMinutes"`
+	// MarginPercent は puMin, puMax からこの割合以内の PU を境界の近くとみなします。デフォルトは 10 です。
+	MarginPercent float64 `json:"marginPercent"`
+	// Ratio は境界の近くにいた判断の割合がこれ以上の場合に警告します。デフォルトは 0.8 です。
+	Ratio float64 `json:"ratio"`
+	// MinDecisions は警告するために必要な期間内の判断の数です。デフォルトは 10 です。
+	MinDecisions int `json:"minDecisions"`
+}
+
+func (b *BoundsAdvisory) applyDefaults() {
+	if b.WindowMinutes == 0 {
+		b.WindowMinutes = 1440
+	}
+	if b.MarginPercent == 0 {
+		b.MarginPercent = 10
+	}
+	if b.Ratio == 0 {
+		b.Ratio = 0.8
+	}
+	if b.MinDecisions == 0 {
+		b.MinDecisions = 10
+	}
+}
+
+// NearBound reports that the instance spent most recent decisions near one of its bounds.
+type NearBound struct {
+	// Bound は min か max です。
+	Bound string `json:"bound"`
+	// Ratio は期間内の判断のうち境界の近くにいた割合です。
+	Ratio          float64 `json:"ratio"`
+	Recommendation string  `json:"recommendation"`
+}
+
+// nearBounds は since 以降の history のうち、判断後の PU が puMin, puMax の近くにあった割合が Ratio 以上の境界を返します。
+func nearBounds(config AutoscalerConfig, history []historyEntry, now time.Time) []NearBound {
+	a := config.BoundsAdvisory
+	if a == nil {
+		return nil
+	}
+	since := now.Add(-time.Duration(a.WindowMinutes * float64(time.Minute)))
+	margin := a.MarginPercent / 100
+	var total, nearMin, nearMax int
+	for _, e := range history {
+		if e.Time.Before(since) {
+			continue
+		}
+		total++
+		if float64(e.NewPU) <= float64(config.PUMin)*(1+margin) {
+			nearMin++
+		}
+		if float64(e.NewPU) >= float64(config.PUMax)*(1-margin) {
+			nearMax++
+		}
+	}
+	if total == 0 || total < a.MinDecisions {
+		return nil
+	}
+	var bounds []NearBound
+	if r := float64(nearMax) / float64(total); r >= a.Ratio {
+		bounds = append(bounds, NearBound{Bound: boundMax, Ratio: r,
+			Recommendation: fmt.Sprintf("Frequently near puMax (%.0f%% of recent decisions); consider raising puMax above %d.", r*100, config.PUMax)})
+	}
+	if r := float64(nearMin) / float64(total); r >= a.Ratio {
+		bounds = append(bounds, NearBound{Bound: boundMin, Ratio: r,
+			Recommendation: fmt.Sprintf("Frequently near puMin (%.0f%% of recent decisions); consider lowering puMin below %d.", r*100, config.PUMin)})
+	}
+	return bounds
+}
+
+// adviseBounds は nearBounds の結果を result に記録し、ログに警告を出力します。
+func adviseBounds(ctx context.Context, config AutoscalerConfig, state instanceState, now time.Time, result *ScaleResult) {
+	result.NearBounds = nearBounds(config, state.History, now)
+	for _, b := range result.NearBounds {
+		logf(ctx, "Warning: %s", b.Recommendation)
+	}
+}
@@ -0,0 +1,78 @@
+package spanner
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNearBounds(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	history := func(pus ...int32) []historyEntry {
+		entries := make([]historyEntry, 0, len(pus))
+		for i, pu := range pus {
+			entries = append(entries, historyEntry{Time: now.Add(-time.Duration(len(pus)-i) * time.Minute), NewPU: pu})
+		}
+		return entries
+	}
+	repeat := func(pu int32, n int) []int32 {
+		pus := make([]int32, n)
+		for i := range pus {
+			pus[i] = pu
+		}
+		return pus
+	}
+	// stale は集計する期間より前の history です。
+	stale := history(repeat(1000, 10)...)
+	for i := range stale {
+		stale[i].Time = stale[i].Time.Add(-2 * time.Hour)
+	}
+	cases := []struct {
+		name    string
+		history []historyEntry
+		want    []string
+	}{
+		{"frequently near max", history(append(repeat(1000, 8), 500, 500)...), []string{boundMax}},
+		{"within margin of max", history(append(repeat(900, 9), 500)...), []string{boundMax}},
+		{"frequently near min", history(append(repeat(100, 9), 500)...), []string{boundMin}},
+		{"spread out", history(100, 200, 300, 400, 500, 600, 700, 800, 900, 1000), nil},
+		{"below ratio", history(append(repeat(1000, 7), 500, 500, 500)...), nil},
+		{"too few decisions", history(1000, 1000, 1000), nil},
+		{"outside the window", stale, nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := AutoscalerConfig{PUMin: 100, PUMax: 1000, BoundsAdvisory: &BoundsAdvisory{WindowMinutes: 60}}
+			config.applyDefaults()
+			got := nearBounds(config, tc.history, now)
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %+v want %v", got, tc.want)
+			}
+			for i, b := range got {
+				if b.Bound != tc.want[i] || b.Recommendation == "" {
+					t.Errorf("got %+v want bound %s", b, tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluate_BoundsAdvisory(t *testing.T) {
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 1000})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90}})
+	updateState("projects/p/instances/a", func(s *instanceState) {
+		for i := 0; i < 10; i++ {
+			s.History = append(s.History, historyEntry{Time: time.Now().Add(-time.Duration(10-i) * time.Minute), NewPU: 1000, Action: actionNone})
+		}
+	})
+
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000, BoundsAdvisory: &BoundsAdvisory{}}
+	config.applyDefaults()
+	result, err := evaluate(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.NearBounds) != 1 || result.NearBounds[0].Bound != boundMax || result.NearBounds[0].Ratio != 1 {
+		t.Errorf("nearBounds got %+v", result.NearBounds)
+	}
+}
@@ -0,0 +1,57 @@
+package spanner
+
+import (
+	"fmt"
+
+	instancepb "cloud.google.com/go/spanner/admin/instance/apiv1/instancepb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb" // For FieldMask in UpdateInstanceRequest
+)
+
+// capacityTarget はインスタンスのサイズです。
+// 現在は Processing Unit だけを持ちます。Spanner にワークロードごとのサイズなどが追加された場合は、
+// ここに項目を追加して updateRequest の Instance と field mask に含めます。
+type capacityTarget struct {
+	ProcessingUnits int32
+	// NodeCountConfigured はインスタンスが processing_units ではなく node_count で構成されているかどうかです。
+	// その場合は更新するときも node_count を指定します。
+	NodeCountConfigured bool
+}
+
+// withProcessingUnits は Processing Unit だけを pu に変えた capacityTarget を返します。
+func (t capacityTarget) withProcessingUnits(pu int32) capacityTarget {
+	t.ProcessingUnits = pu
+	return t
+}
+
+func (t capacityTarget) String() string {
+	return fmt.Sprintf("%d PUs", t.ProcessingUnits)
+}
+
+// usesNodeCount は node_count で更新するかどうかです。
+// node_count で構成されていても、1000 の倍数でなければ node_count では表せないため processing_units を更新します。
+func (t capacityTarget) usesNodeCount() bool {
+	return t.NodeCountConfigured && t.ProcessingUnits%1000 == 0
+}
+
+// updateRequest は instanceName を t にリサイズする UpdateInstanceRequest を返します。
+func (t capacityTarget) updateRequest(instanceName string) *instancepb.UpdateInstanceRequest {
+	if t.usesNodeCount() {
+		return &instancepb.UpdateInstanceRequest{
+			Instance:  &instancepb.Instance{Name: instanceName, NodeCount: t.ProcessingUnits / 1000},
+			FieldMask: &fieldmaskpb.FieldMask{Paths: []string{"node_count"}},
+		}
+	}
+	return &instancepb.UpdateInstanceRequest{
+		Instance:  &instancepb.Instance{Name: instanceName, ProcessingUnits: t.ProcessingUnits},
+		FieldMask: &fieldmaskpb.FieldMask{Paths: []string{"processing_units"}},
+	}
+}
+
+// capacityOf は instance の現在のサイズを返します。
+// processing_units が 0 で node_count だけが設定されている場合は、node_count * 1000 PU として扱います。
+func capacityOf(instance *instancepb.Instance) capacityTarget {
+	if instance.GetProcessingUnits() == 0 && instance.GetNodeCount() > 0 {
+		return capacityTarget{ProcessingUnits: instance.GetNodeCount() * 1000, NodeCountConfigured: true}
+	}
+	return capacityTarget{ProcessingUnits: instance.GetProcessingUnits()}
+}
@@ -0,0 +1,79 @@
+package spanner
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	instancepb "cloud.google.com/go/spanner/admin/instance/apiv1/instancepb"
+)
+
+func TestCapacityOf(t *testing.T) {
+	cases := []struct {
+		name     string
+		instance *instancepb.Instance
+		want     capacityTarget
+	}{
+		{"processing units", &instancepb.Instance{ProcessingUnits: 300}, capacityTarget{ProcessingUnits: 300}},
+		{"node count", &instancepb.Instance{NodeCount: 2}, capacityTarget{ProcessingUnits: 2000, NodeCountConfigured: true}},
+		{"both", &instancepb.Instance{ProcessingUnits: 2000, NodeCount: 2}, capacityTarget{ProcessingUnits: 2000}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := capacityOf(tc.instance); got != tc.want {
+				t.Errorf("got %+v want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCapacityTarget_UpdateRequest(t *testing.T) {
+	const name = "projects/p/instances/a"
+	cases := []struct {
+		name      string
+		target    capacityTarget
+		wantPaths []string
+		wantPU    int32
+		wantNodes int32
+	}{
+		{"processing units", capacityTarget{ProcessingUnits: 300}, []string{"processing_units"}, 300, 0},
+		{"node count", capacityTarget{ProcessingUnits: 3000, NodeCountConfigured: true}, []string{"node_count"}, 0, 3},
+		{"node count with partial node", capacityTarget{ProcessingUnits: 500, NodeCountConfigured: true}, []string{"processing_units"}, 500, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := tc.target.updateRequest(name)
+			if !reflect.DeepEqual(req.GetFieldMask().GetPaths(), tc.wantPaths) {
+				t.Errorf("paths got %v want %v", req.GetFieldMask().GetPaths(), tc.wantPaths)
+			}
+			i := req.GetInstance()
+			if i.GetName() != name || i.GetProcessingUnits() != tc.wantPU || i.GetNodeCount() != tc.wantNodes {
+				t.Errorf("instance got %v", i)
+			}
+		})
+	}
+}
+
+func TestApply_CapacityTargetPreservesProcessingUnits(t *testing.T) {
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 100})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90}})
+
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000}
+	config.applyDefaults()
+	result, err := evaluate(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (capacityTarget{ProcessingUnits: 200}); result.targetCapacity() != want {
+		t.Errorf("target got %+v want %+v", result.targetCapacity(), want)
+	}
+	if err := apply(context.Background(), result); err != nil {
+		t.Fatal(err)
+	}
+	if got := admin.processingUnits("projects/p/instances/a"); got != 200 {
+		t.Errorf("processing units got %d want 200", got)
+	}
+	if !reflect.DeepEqual(admin.fieldMasks, [][]string{{"processing_units"}}) {
+		t.Errorf("field masks got %v", admin.fieldMasks)
+	}
+}
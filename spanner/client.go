@@ -0,0 +1,140 @@
+package spanner
+
+import (
+	"context"
+
+	instanceadmin "cloud.google.com/go/spanner/admin/instance/apiv1"
+	instancepb "cloud.google.com/go/spanner/admin/instance/apiv1/instancepb"
+
+	monitoringclient "cloud.google.com/go/monitoring/apiv3/v2"
+	monitoringpb "cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
+)
+
+// instanceAdminClient は autoscaler が利用する Spanner Instance Admin API の操作です。
+type instanceAdminClient interface {
+	ListInstances(ctx context.Context, req *instancepb.ListInstancesRequest) instanceIterator
+	GetInstance(ctx context.Context, req *instancepb.GetInstanceRequest) (*instancepb.Instance, error)
+	UpdateInstance(ctx context.Context, req *instancepb.UpdateInstanceRequest) (updateInstanceOperation, error)
+	Close() error
+}
+
+// instanceIterator は ListInstances の結果を順に返します。
+type instanceIterator interface {
+	Next() (*instancepb.Instance, error)
+}
+
+// updateInstanceOperation は UpdateInstance の Long Running Operation です。
+type updateInstanceOperation interface {
+	// Poll は operation の状態を1回取得します。完了していなければ nil を返します。
+	Poll(ctx context.Context) (*instancepb.Instance, error)
+	Done() bool
+}
+
+// metricClient は autoscaler が利用する Cloud Monitoring API の操作です。
+type metricClient interface {
+	ListTimeSeries(ctx context.Context, req *monitoringpb.ListTimeSeriesRequest) timeSeriesIterator
+	Close() error
+}
+
+// timeSeriesIterator は ListTimeSeries の結果を順に返します。
+type timeSeriesIterator interface {
+	Next() (*monitoringpb.TimeSeries, error)
+}
+
+// queryClient は Monitoring Query Language (MQL) のクエリを実行する Cloud Monitoring API の操作です。
+type queryClient interface {
+	QueryTimeSeries(ctx context.Context, req *monitoringpb.QueryTimeSeriesRequest) timeSeriesDataIterator
+	Close() error
+}
+
+// timeSeriesDataIterator は QueryTimeSeries の結果を順に返します。
+type timeSeriesDataIterator interface {
+	Next() (*monitoringpb.TimeSeriesData, error)
+}
+
+// API クライアントの生成はテストで fake に差し替えられるように変数にしています。
+var (
+	newInstanceAdminClient = func(ctx context.Context) (instanceAdminClient, error) {
+		c, err := instanceadmin.NewInstanceAdminClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &gcpInstanceAdminClient{c: c}, nil
+	}
+
+	newMetricClient = func(ctx context.Context) (metricClient, error) {
+		c, err := monitoringclient.NewMetricClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &gcpMetricClient{c: c}, nil
+	}
+
+	newQueryClient = func(ctx context.Context) (queryClient, error) {
+		c, err := monitoringclient.NewQueryClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &gcpQueryClient{c: c}, nil
+	}
+)
+
+type gcpInstanceAdminClient struct {
+	c *instanceadmin.InstanceAdminClient
+}
+
+func (c *gcpInstanceAdminClient) ListInstances(ctx context.Context, req *instancepb.ListInstancesRequest) instanceIterator {
+	return c.c.ListInstances(ctx, req)
+}
+
+func (c *gcpInstanceAdminClient) GetInstance(ctx context.Context, req *instancepb.GetInstanceRequest) (*instancepb.Instance, error) {
+	return c.c.GetInstance(ctx, req)
+}
+
+func (c *gcpInstanceAdminClient) UpdateInstance(ctx context.Context, req *instancepb.UpdateInstanceRequest) (updateInstanceOperation, error) {
+	op, err := c.c.UpdateInstance(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &gcpUpdateInstanceOperation{op: op}, nil
+}
+
+func (c *gcpInstanceAdminClient) Close() error {
+	return c.c.Close()
+}
+
+type gcpUpdateInstanceOperation struct {
+	op *instanceadmin.UpdateInstanceOperation
+}
+
+func (o *gcpUpdateInstanceOperation) Poll(ctx context.Context) (*instancepb.Instance, error) {
+	return o.op.Poll(ctx)
+}
+
+func (o *gcpUpdateInstanceOperation) Done() bool {
+	return o.op.Done()
+}
+
+type gcpMetricClient struct {
+	c *monitoringclient.MetricClient
+}
+
+func (c *gcpMetricClient) ListTimeSeries(ctx context.Context, req *monitoringpb.ListTimeSeriesRequest) timeSeriesIterator {
+	return c.c.ListTimeSeries(ctx, req)
+}
+
+func (c *gcpMetricClient) Close() error {
+	return c.c.Close()
+}
+
+type gcpQueryClient struct {
+	c *monitoringclient.QueryClient
+}
+
+func (c *gcpQueryClient) QueryTimeSeries(ctx context.Context, req *monitoringpb.QueryTimeSeriesRequest) timeSeriesDataIterator {
+	return c.c.QueryTimeSeries(ctx, req)
+}
+
+func (c *gcpQueryClient) Close() error {
+	return c.c.Close()
+}
@@ -0,0 +1,43 @@
+package spanner
+
+import (
+	"context"
+	"time"
+)
+
+// clockSkewTolerance は state の時刻が現在時刻より未来になっていても、時計のずれとして許容する幅です。
+// 許容する幅の中であれば現在時刻として扱い、それを超えた場合は cooldown などを終了したものとして扱います。
+func clockSkewTolerance() time.Duration {
+	return durationFromEnv("CLOCK_SKEW_TOLERANCE_SECONDS", 5, time.Second)
+}
+
+// correctClockSkew は state の LastResized と LastScaledUp が now より未来の時刻になっている場合に補正した state を返します。
+// state は別のプロセスで記録された時刻を含む場合があるため、時計のずれで cooldown や quiet period が終わらなくなるのを防ぎます。
+// 許容する幅を超えた時刻はログに出力して記録がないものとし、diagnostics.clockSkewSeconds に未来へのずれの最大値を含めます。
+func correctClockSkew(ctx context.Context, state instanceState, now time.Time, result *ScaleResult) instanceState {
+	tolerance := clockSkewTolerance()
+	correct := func(field string, t *time.Time) {
+		skew := t.Sub(now)
+		if t.IsZero() || skew <= 0 {
+			return
+		}
+		if skew.Seconds() > result.Diagnostics.ClockSkewSeconds {
+			result.Diagnostics.ClockSkewSeconds = skew.Seconds()
+		}
+		if skew <= tolerance {
+			*t = now
+			return
+		}
+		logf(ctx, "%s of %s is %s in the future (%s); treating it as expired.", field, result.label(), skew.Round(time.Second), t.UTC().Format(time.RFC3339))
+		*t = time.Time{}
+	}
+	correct("LastResized", &state.LastResized)
+	correct("LastScaledUp", &state.LastScaledUp)
+	if result.Diagnostics.ClockSkewSeconds > 0 {
+		result.trace("clock_skew", tracePass, map[string]any{
+			"skewSeconds":      result.Diagnostics.ClockSkewSeconds,
+			"toleranceSeconds": tolerance.Seconds(),
+		})
+	}
+	return state
+}
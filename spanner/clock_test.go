@@ -0,0 +1,71 @@
+package spanner
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEvaluate_ClockSkew(t *testing.T) {
+	cases := []struct {
+		name         string
+		lastResized  time.Duration
+		lastScaledUp time.Duration
+		wantAction   string
+		wantReason   string
+		wantSkew     bool
+	}{
+		{"future beyond tolerance", time.Hour, 0, actionScaleDown, reasonCPUBelowThreshold, true},
+		{"future within tolerance", 2 * time.Second, 0, actionNone, reasonCooldown, true},
+		{"recent past", -5 * time.Minute, 0, actionNone, reasonCooldown, false},
+		{"old past", -2 * time.Hour, 0, actionScaleDown, reasonCPUBelowThreshold, false},
+		{"future scale up", -2 * time.Hour, time.Hour, actionScaleDown, reasonCPUBelowThreshold, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			const name = "projects/p/instances/a"
+			admin := newFakeInstanceAdmin(map[string]int32{name: 500})
+			useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 10}})
+			updateState(name, func(s *instanceState) {
+				s.LastResized = time.Now().Add(tc.lastResized).UTC()
+				s.LastChangePU = 100
+				if tc.lastScaledUp != 0 {
+					s.LastScaledUp = time.Now().Add(tc.lastScaledUp).UTC()
+				}
+			})
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000, CooldownBaseMinutes: 30, QuietPeriodMinutes: 30}
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Action != tc.wantAction || result.Reason != tc.wantReason {
+				t.Errorf("got action=%s reason=%s want action=%s reason=%s", result.Action, result.Reason, tc.wantAction, tc.wantReason)
+			}
+			if (result.Diagnostics.ClockSkewSeconds > 0) != tc.wantSkew {
+				t.Errorf("clockSkewSeconds got %v", result.Diagnostics.ClockSkewSeconds)
+			}
+		})
+	}
+}
+
+func TestApply_RecordsUTC(t *testing.T) {
+	const name = "projects/p/instances/a"
+	admin := newFakeInstanceAdmin(map[string]int32{name: 100})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90}})
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000}
+	config.applyDefaults()
+	result, err := evaluate(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := apply(context.Background(), result); err != nil {
+		t.Fatal(err)
+	}
+	state := loadState(name)
+	for field, ts := range map[string]time.Time{"LastResized": state.LastResized, "LastScaledUp": state.LastScaledUp, "History": state.History[0].Time} {
+		if ts.IsZero() || ts.Location() != time.UTC {
+			t.Errorf("%s got %v want a UTC time", field, ts)
+		}
+	}
+}
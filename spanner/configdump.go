@@ -0,0 +1,95 @@
+package spanner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// ConfigDump is the effective configuration of every instance in a batch request, resolved without scaling.
+type ConfigDump struct {
+	RequestID string            `json:"requestId,omitempty"`
+	Instances []EffectiveConfig `json:"instances"`
+}
+
+// EffectiveConfig is the configuration an instance would be scaled with after every layer is applied.
+type EffectiveConfig struct {
+	Project  string           `json:"project"`
+	Instance string           `json:"instance"`
+	Config   AutoscalerConfig `json:"config"`
+	// CostTier は costTiers を選ぶために使ったインスタンスの cost tier です。costTierPolicy はその tier に適用する重みです。
+	CostTier       string          `json:"costTier,omitempty"`
+	CostTierPolicy *CostTierPolicy `json:"costTierPolicy,omitempty"`
+	// CooldownSeconds は RESIZE_INTERVAL_MINUTES と costTiers を反映した、変化量に比例する分を除いた cooldown の秒数です。
+	CooldownSeconds float64       `json:"cooldownSeconds"`
+	ConfigSource    *ConfigSource `json:"configSource,omitempty"`
+	// Error はインスタンスを取得できず、cost tier を反映できなかった場合のエラーです。
+	Error string `json:"error,omitempty"`
+}
+
+// ConfigHandler resolves the effective configuration of the instances in a batch request body,
+// including discovered instances, and returns it without reading metrics or resizing anything.
+func ConfigHandler(w http.ResponseWriter, r *http.Request) {
+	r = withRequestID(w, r)
+	var config BatchConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		http.Error(w, "Invalid JSON request body.", http.StatusBadRequest)
+		return
+	}
+	if err := authorizeCaller(r, config.projects()...); err != nil {
+		http.Error(w, err.message, err.status)
+		return
+	}
+	if rejected, err := disallowedInstances(r.Context(), config.Instances...); err != nil {
+		logf(r.Context(), "Failed to load the instance allowlist: %v", err)
+		http.Error(w, "Invalid allowlist configuration.", http.StatusInternalServerError)
+		return
+	} else if len(rejected) > 0 {
+		writeJSON(w, http.StatusForbidden, &BatchResult{RequestID: requestID(r.Context()), Results: rejected})
+		return
+	}
+	ctx, cancel := requestContext(r, config.TimeoutSeconds)
+	defer cancel()
+	if err := config.discover(ctx); err != nil {
+		var ae *autoscaleError
+		if errors.As(err, &ae) {
+			logf(ctx, "Failed to discover instances: %v", err)
+			writeError(w, err, 0)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := config.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dump := &ConfigDump{RequestID: requestID(ctx), Instances: make([]EffectiveConfig, 0, len(config.Instances))}
+	for _, c := range config.Instances {
+		c.applyDefaults()
+		dump.Instances = append(dump.Instances, resolveConfig(ctx, c))
+	}
+	writeJSON(w, http.StatusOK, dump)
+}
+
+// resolveConfig は evaluate と同じ順に remote config と cost tier を config に反映します。
+// Request Body と DEPLOY_ENV などの環境変数によるデフォルト値は、呼び出し元で applyDefaults により反映済みです。
+func resolveConfig(ctx context.Context, config AutoscalerConfig) EffectiveConfig {
+	result := &ScaleResult{Project: config.Project, Instance: config.Instance, instanceName: config.instanceName()}
+	config = applyRemoteConfig(ctx, config, result)
+	ec := EffectiveConfig{Project: config.Project, Instance: config.Instance, ConfigSource: result.ConfigSource}
+	info, err := getCurrentCapacity(ctx, config.instanceName())
+	if err != nil {
+		logf(ctx, "Failed to get instance %s to resolve its cost tier: %v", result.label(), err)
+		ec.Error = err.Error()
+	} else {
+		config = withCostTier(config, info.Config, result)
+		ec.CostTier = result.CostTier
+		ec.CostTierPolicy = config.costTier
+	}
+	ec.Config = config
+	ec.CooldownSeconds = config.cooldown(0).Seconds()
+	return ec
+}
@@ -0,0 +1,83 @@
+package spanner
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConfigHandler(t *testing.T) {
+	t.Setenv("DEPLOY_ENV", "prod")
+	useFakeConfigSource(t, &fakeConfigSource{active: "v1", versions: map[string]string{
+		"v1": `{"version": "v1", "thresholds": {"p/a": {"scaleUpThreshold": 80}}}`,
+	}})
+	admin := newFakeInstanceAdmin(map[string]int32{
+		"projects/p/instances/a": 500,
+		"projects/p/instances/b": 500,
+	})
+	admin.instances["projects/p/instances/a"].Config = "projects/p/instanceConfigs/nam3"
+	admin.instances["projects/p/instances/b"].Config = "projects/p/instanceConfigs/regional-asia-northeast1"
+	metrics := &fakeMetricClient{cpu: map[string]float64{"a": 90, "b": 90}}
+	useFakes(t, admin, metrics)
+	orig := instanceDiscovery
+	instanceDiscovery = newDiscoveryCache()
+	t.Cleanup(func() { instanceDiscovery = orig })
+
+	tiers := `{"multi_region": {"cooldownMultiplier": 0.5}}`
+	body := `{
+		"instances": [{"project": "p", "instance": "a", "puStep": 100, "puMin": 100, "puMax": 1000, "scaleDownThreshold": 10, "costTiers": ` + tiers + `}],
+		"discovery": {"project": "p", "template": {"puStep": 100, "puMin": 100, "puMax": 2000, "costTiers": ` + tiers + `}}
+	}`
+	rr := httptest.NewRecorder()
+	ConfigHandler(rr, httptest.NewRequest(http.MethodPost, "/spanner/autoscaler/config", strings.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status got %d: %s", rr.Code, rr.Body.String())
+	}
+	var dump ConfigDump
+	if err := json.NewDecoder(rr.Body).Decode(&dump); err != nil {
+		t.Fatal(err)
+	}
+	if len(dump.Instances) != 2 {
+		t.Fatalf("instances got %d want 2", len(dump.Instances))
+	}
+
+	a, b := dump.Instances[0], dump.Instances[1]
+	// a: scaleUpThreshold は remote config、scaleDownThreshold は Request Body、cooldown は DEPLOY_ENV と cost tier の値です。
+	if a.Instance != "a" || a.Config.ScaleUpThreshold != 80 || a.Config.ScaleDownThreshold != 10 || a.Config.CooldownBaseMinutes != 60 {
+		t.Errorf("a got %+v", a.Config)
+	}
+	if a.CostTier != costTierMultiRegion || a.CooldownSeconds != 1800 || a.ConfigSource == nil || a.ConfigSource.Version != "v1" {
+		t.Errorf("a got costTier=%s cooldownSeconds=%v configSource=%+v", a.CostTier, a.CooldownSeconds, a.ConfigSource)
+	}
+	// b: discovery の template に DEPLOY_ENV のデフォルト値を反映しています。
+	if b.Instance != "b" || b.Config.PUMax != 2000 || b.Config.ScaleUpThreshold != 45 || b.Config.ScaleDownThreshold != 20 {
+		t.Errorf("b got %+v", b.Config)
+	}
+	if b.CostTier != costTierRegional || b.CooldownSeconds != 3600 {
+		t.Errorf("b got costTier=%s cooldownSeconds=%v", b.CostTier, b.CooldownSeconds)
+	}
+
+	if len(admin.updated()) != 0 || metrics.listCalls != 0 {
+		t.Errorf("updated %v and read metrics %d times, want neither", admin.updated(), metrics.listCalls)
+	}
+}
+
+func TestConfigHandler_InstanceUnavailable(t *testing.T) {
+	admin := newFakeInstanceAdmin(nil)
+	useFakes(t, admin, &fakeMetricClient{})
+	body := `{"instances": [{"project": "p", "instance": "a", "puStep": 100, "puMin": 100, "puMax": 1000}]}`
+	rr := httptest.NewRecorder()
+	ConfigHandler(rr, httptest.NewRequest(http.MethodPost, "/spanner/autoscaler/config", strings.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status got %d: %s", rr.Code, rr.Body.String())
+	}
+	var dump ConfigDump
+	if err := json.NewDecoder(rr.Body).Decode(&dump); err != nil {
+		t.Fatal(err)
+	}
+	if len(dump.Instances) != 1 || dump.Instances[0].Error == "" || dump.Instances[0].Config.ScaleUpThreshold != 50 {
+		t.Errorf("got %+v want the defaults with an error", dump.Instances)
+	}
+}
@@ -0,0 +1,91 @@
+package spanner
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	costTierRegional    = "regional"
+	costTierMultiRegion = "multi_region"
+)
+
+// CostTierPolicy weights scale-down aggressiveness for instances in a cost tier.
+type CostTierPolicy struct {
+	// ScaleDownStepMultiplier はスケールダウンの1ステップ (puStep、proportionalStep の場合はその割合) に掛ける値です。デフォルトは 1 です。
+	ScaleDownStepMultiplier float64 `json:"scaleDownStepMultiplier"`
+	// CooldownMultiplier は cooldown に掛ける値です。デフォルトは 1 です。
+	CooldownMultiplier float64 `json:"cooldownMultiplier"`
+}
+
+func (p *CostTierPolicy) applyDefaults() {
+	if p.ScaleDownStepMultiplier == 0 {
+		p.ScaleDownStepMultiplier = 1
+	}
+	if p.CooldownMultiplier == 0 {
+		p.CooldownMultiplier = 1
+	}
+}
+
+func validateCostTiers(tiers map[string]*CostTierPolicy) error {
+	for tier, p := range tiers {
+		if tier != costTierRegional && tier != costTierMultiRegion {
+			return fmt.Errorf("Invalid costTiers. Unknown tier %s.", tier)
+		}
+		if p == nil || p.ScaleDownStepMultiplier < 0 || p.CooldownMultiplier < 0 {
+			return errors.New("Invalid costTiers.")
+		}
+	}
+	return nil
+}
+
+// costTierOf はインスタンス構成の名前からコストの区分を返します。
+// regional- で始まる構成は regional、それ以外の Google が提供する構成は multi_region です。
+// custom- で始まるユーザー管理の構成など、区分が分からない場合は空文字列を返します。
+func costTierOf(instanceConfig string) string {
+	name := instanceConfig[strings.LastIndex(instanceConfig, "/")+1:]
+	switch {
+	case name == "" || strings.HasPrefix(name, "custom-"):
+		return ""
+	case strings.HasPrefix(name, "regional-"):
+		return costTierRegional
+	}
+	return costTierMultiRegion
+}
+
+// withCostTier はインスタンスのコストの区分を result に記録し、CostTiers にその区分の設定があれば適用した config を返します。
+func withCostTier(config AutoscalerConfig, instanceConfig string, result *ScaleResult) AutoscalerConfig {
+	result.CostTier = costTierOf(instanceConfig)
+	if p := config.CostTiers[result.CostTier]; p != nil {
+		config.costTier = p
+	}
+	return config
+}
+
+// scaleDownStepMultiplier は costTiers によるスケールダウンのステップの重みです。
+func (c *AutoscalerConfig) scaleDownStepMultiplier() float64 {
+	if c.costTier == nil {
+		return 1
+	}
+	return c.costTier.ScaleDownStepMultiplier
+}
+
+// cooldownMultiplier は costTiers による cooldown の重みです。
+func (c *AutoscalerConfig) cooldownMultiplier() float64 {
+	if c.costTier == nil {
+		return 1
+	}
+	return c.costTier.CooldownMultiplier
+}
+
+// weightedStepDown は currentPU から step PU だけ小さい PU を有効な PU に切り上げて返します。
+// 切り上げると currentPU から変化しない場合は currentPU より1つ小さい有効な PU にします。
+func weightedStepDown(currentPU int32, step float64) int32 {
+	pu := roundUpProcessingUnits(int32(math.Ceil(float64(currentPU) - step)))
+	if pu >= currentPU {
+		pu = roundDownProcessingUnits(currentPU - 1)
+	}
+	return pu
+}
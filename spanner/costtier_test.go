@@ -0,0 +1,68 @@
+package spanner
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCostTierOf(t *testing.T) {
+	cases := []struct {
+		config string
+		want   string
+	}{
+		{"projects/p/instanceConfigs/regional-asia-northeast1", costTierRegional},
+		{"projects/p/instanceConfigs/nam3", costTierMultiRegion},
+		{"projects/p/instanceConfigs/nam-eur-asia1", costTierMultiRegion},
+		{"projects/p/instanceConfigs/custom-nam11-read-only", ""},
+		{"", ""},
+	}
+	for _, tc := range cases {
+		if got := costTierOf(tc.config); got != tc.want {
+			t.Errorf("costTierOf(%q) got %q want %q", tc.config, got, tc.want)
+		}
+	}
+}
+
+func TestEvaluate_CostTier(t *testing.T) {
+	tiers := map[string]*CostTierPolicy{
+		costTierMultiRegion: {ScaleDownStepMultiplier: 3, CooldownMultiplier: 0.5},
+		costTierRegional:    {},
+	}
+	cases := []struct {
+		name        string
+		config      string
+		lastResized time.Duration
+		wantTier    string
+		wantAction  string
+		wantNewPU   int32
+	}{
+		{"multi-region steps down further", "nam3", 0, costTierMultiRegion, actionScaleDown, 700},
+		{"regional steps down gently", "regional-asia-northeast1", 0, costTierRegional, actionScaleDown, 900},
+		{"multi-region has a shorter cooldown", "nam3", 20 * time.Minute, costTierMultiRegion, actionScaleDown, 700},
+		{"regional keeps the cooldown", "regional-asia-northeast1", 20 * time.Minute, costTierRegional, actionNone, 1000},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			const name = "projects/p/instances/a"
+			admin := newFakeInstanceAdmin(map[string]int32{name: 1000})
+			admin.instances[name].Config = "projects/p/instanceConfigs/" + tc.config
+			useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 10}})
+			if tc.lastResized > 0 {
+				updateState(name, func(s *instanceState) { s.LastResized = time.Now().Add(-tc.lastResized) })
+			}
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 5000, CostTiers: tiers}
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.CostTier != tc.wantTier {
+				t.Errorf("cost tier got %q want %q", result.CostTier, tc.wantTier)
+			}
+			if result.Action != tc.wantAction || result.NewPU != tc.wantNewPU {
+				t.Errorf("got action=%s reason=%s newPU=%d want action=%s newPU=%d", result.Action, result.Reason, result.NewPU, tc.wantAction, tc.wantNewPU)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package spanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const reasonInsufficientCoverage = "insufficient_coverage"
+
+const (
+	coverageActionWarn = "warn"
+	coverageActionSkip = "skip"
+)
+
+// metricSampleInterval は Spanner のメトリクスのデータポイントの間隔です。
+const metricSampleInterval = time.Minute
+
+// MetricCoverage configures how to handle CPU readings whose points cover only part of the lookback window.
+type MetricCoverage struct {
+	// MinRatio は lookback window のうちデータポイントがある範囲の割合の下限です。デフォルトは 0.8 です。
+	MinRatio float64 `json:"minRatio"`
+	// Action は MinRatio を下回った場合の扱いです。
+	// warn (デフォルト) はログに出力して、データポイントがある範囲だけで判断します。skip はスケーリングしません。
+	Action string `json:"action"`
+}
+
+func (m *MetricCoverage) applyDefaults() {
+	if m.MinRatio == 0 {
+		m.MinRatio = 0.8
+	}
+	if m.Action == "" {
+		m.Action = coverageActionWarn
+	}
+}
+
+func (m *MetricCoverage) validate() error {
+	if m.MinRatio < 0 || m.MinRatio > 1 {
+		return errors.New("Invalid metricCoverage.minRatio.")
+	}
+	switch m.Action {
+	case "", coverageActionWarn, coverageActionSkip:
+		return nil
+	}
+	return fmt.Errorf("Invalid metricCoverage.action %q.", m.Action)
+}
+
+// coveredDuration は昇順に並んだ points が window の終わりの end から遡って覆っている期間を返します。
+// 最も古いデータポイントはその前の metricSampleInterval を集計した値のため、その分を含めます。
+func coveredDuration(points []trendPoint, end time.Time, window time.Duration) time.Duration {
+	if len(points) == 0 {
+		return 0
+	}
+	d := end.Sub(points[0].t) + metricSampleInterval
+	return min(max(d, 0), window)
+}
+
+// skipLowCoverage は CPU 使用率のデータポイントが lookback window の一部しか覆っていない場合の扱いを決めます。
+// MetricCoverage の Action が skip の場合は、スケーリングしない理由を result に設定して true を返します。
+// データポイントが古い期間に欠けていても、判断にはある範囲のデータポイントだけを使います。
+func skipLowCoverage(ctx context.Context, config AutoscalerConfig, result *ScaleResult) bool {
+	m := config.MetricCoverage
+	ratio := result.Diagnostics.MetricCoverageRatio
+	if m == nil || result.Diagnostics.MetricSource != metricSourceCPU || ratio >= m.MinRatio {
+		return false
+	}
+	result.Diagnostics.LowCoverage = true
+	covered := time.Duration(result.Diagnostics.MetricCoverageSeconds * float64(time.Second))
+	if m.Action != coverageActionSkip {
+		logf(ctx, "CPU usage points cover only %s of the %s lookback window; deciding on the covered range.", covered, metricLookback)
+		return false
+	}
+	logf(ctx, "Skipping scaling because CPU usage points cover only %s of the %s lookback window.", covered, metricLookback)
+	result.Reason = reasonInsufficientCoverage
+	result.Message = fmt.Sprintf("Skipping scaling because CPU usage points cover only %.0f%% of the lookback window.", ratio*100)
+	return true
+}
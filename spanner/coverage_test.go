@@ -0,0 +1,71 @@
+package spanner
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestEvaluate_MetricCoverage(t *testing.T) {
+	full := []float64{90, 90, 90, 90, 90}
+	partial := []float64{90, 90}
+	cases := []struct {
+		name       string
+		samples    []float64
+		coverage   *MetricCoverage
+		wantRatio  float64
+		wantLow    bool
+		wantAction string
+		wantReason string
+	}{
+		{"full window", full, &MetricCoverage{Action: coverageActionSkip}, 1, false, actionScaleUp, reasonCPUAboveThreshold},
+		{"partial window warns", partial, &MetricCoverage{}, 0.4, true, actionScaleUp, reasonCPUAboveThreshold},
+		{"partial window skips", partial, &MetricCoverage{Action: coverageActionSkip}, 0.4, true, actionNone, reasonInsufficientCoverage},
+		{"partial window above min ratio", partial, &MetricCoverage{MinRatio: 0.3, Action: coverageActionSkip}, 0.4, false, actionScaleUp, reasonCPUAboveThreshold},
+		{"reported without metricCoverage", partial, nil, 0.4, false, actionScaleUp, reasonCPUAboveThreshold},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 100})
+			useFakes(t, admin, &fakeMetricClient{samples: map[string][]float64{"a": tc.samples}})
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000, MetricCoverage: tc.coverage}
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := result.Diagnostics.MetricCoverageRatio; math.Abs(got-tc.wantRatio) > 0.01 {
+				t.Errorf("coverage ratio got %v want %v", got, tc.wantRatio)
+			}
+			if got := result.Diagnostics.MetricCoverageSeconds; math.Abs(got-tc.wantRatio*metricLookback.Seconds()) > 1 {
+				t.Errorf("coverage seconds got %v", got)
+			}
+			if result.Diagnostics.LowCoverage != tc.wantLow {
+				t.Errorf("lowCoverage got %v want %v", result.Diagnostics.LowCoverage, tc.wantLow)
+			}
+			if result.Action != tc.wantAction || result.Reason != tc.wantReason {
+				t.Errorf("got action=%s reason=%s want action=%s reason=%s", result.Action, result.Reason, tc.wantAction, tc.wantReason)
+			}
+		})
+	}
+}
+
+func TestMetricCoverage_Validate(t *testing.T) {
+	cases := []struct {
+		name     string
+		coverage MetricCoverage
+		wantErr  bool
+	}{
+		{"defaults", MetricCoverage{}, false},
+		{"skip", MetricCoverage{MinRatio: 0.5, Action: coverageActionSkip}, false},
+		{"ratio above 1", MetricCoverage{MinRatio: 1.5}, true},
+		{"unknown action", MetricCoverage{Action: "shorten"}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.coverage.validate(); (err != nil) != tc.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package spanner
+
+import (
+	"math"
+	"time"
+)
+
+// scaleUpSuppression は最後のスケールアップから t 経過した時点のスケールダウンの抑止の強さを 0 から 1 で返します。
+// 抑止の強さはスケールアップで増えた割合 (最大 1) から始まり、halfLife ごとに半分になります。
+func scaleUpSuppression(changePU, currentPU int32, t, halfLife time.Duration) float64 {
+	if changePU <= 0 || halfLife <= 0 {
+		return 0
+	}
+	strength := 1.0
+	if before := currentPU - changePU; before > 0 {
+		strength = math.Min(float64(changePU)/float64(before), 1)
+	}
+	return strength * math.Pow(0.5, t.Seconds()/halfLife.Seconds())
+}
+
+// decaysAfterScaleUp は最後のリサイズがスケールアップで、cooldown の代わりに減衰する抑止を使うかどうかです。
+func (c *AutoscalerConfig) decaysAfterScaleUp(state instanceState) bool {
+	return c.ScaleUpDecayHalfLifeMinutes > 0 && state.LastChangePU > 0 && !state.LastResized.IsZero()
+}
+
+// decayScaleDownThreshold は最後のスケールアップからの経過時間に応じて scaleDownThreshold を下げた config を返します。
+// 抑止の強さが s の場合、scaleDownThreshold は (1 - s) 倍になり、時間とともに元の値に戻ります。
+func decayScaleDownThreshold(config AutoscalerConfig, state instanceState, now time.Time, result *ScaleResult) AutoscalerConfig {
+	if !config.decaysAfterScaleUp(state) {
+		return config
+	}
+	halfLife := time.Duration(config.ScaleUpDecayHalfLifeMinutes * float64(time.Minute))
+	s := scaleUpSuppression(state.LastChangePU, result.CurrentPU, now.Sub(state.LastResized), halfLife)
+	result.Diagnostics.ScaleDownSuppression = s
+	config.ScaleDownThreshold *= 1 - s
+	return config
+}
@@ -0,0 +1,114 @@
+package spanner
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestScaleUpSuppression(t *testing.T) {
+	halfLife := 30 * time.Minute
+	cases := []struct {
+		name      string
+		changePU  int32
+		currentPU int32
+		t         time.Duration
+		want      float64
+	}{
+		{"right after doubling", 500, 1000, 0, 1},
+		{"one half-life after doubling", 500, 1000, 30 * time.Minute, 0.5},
+		{"two half-lives after doubling", 500, 1000, 60 * time.Minute, 0.25},
+		{"right after a small step", 100, 500, 0, 0.25},
+		{"one half-life after a small step", 100, 500, 30 * time.Minute, 0.125},
+		{"after a scale down", -100, 900, 0, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := scaleUpSuppression(tc.changePU, tc.currentPU, tc.t, halfLife); math.Abs(got-tc.want) > 1e-9 {
+				t.Errorf("got %v want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEvaluate_ScaleUpDecay(t *testing.T) {
+	cases := []struct {
+		name       string
+		since      time.Duration
+		wantAction string
+	}{
+		// 500 PU から 1000 PU に倍増した直後は scaleDownThreshold が 0 まで下がります。
+		{"right after the scale up", time.Minute, actionNone},
+		// 1 半減期後は scaleDownThreshold が 30 の半分の 15 になり、CPU 使用率 20% ではまだスケールダウンしません。
+		{"one half-life later", 30 * time.Minute, actionNone},
+		// 3 半減期後は 30 * (1 - 0.125) = 26.25 となり、スケールダウンします。
+		{"three half-lives later", 90 * time.Minute, actionScaleDown},
+	}
+	last := 2.0
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 1000})
+			useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 20}})
+			updateState("projects/p/instances/a", func(s *instanceState) {
+				s.LastResized = time.Now().Add(-tc.since)
+				s.LastChangePU = 500
+			})
+
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 2000,
+				CooldownBaseMinutes: 600, ScaleUpDecayHalfLifeMinutes: 30}
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Action != tc.wantAction {
+				t.Errorf("got action=%s reason=%s want %s", result.Action, result.Reason, tc.wantAction)
+			}
+			if s := result.Diagnostics.ScaleDownSuppression; s >= last {
+				t.Errorf("suppression %v did not decrease from %v", s, last)
+			} else {
+				last = s
+			}
+		})
+	}
+}
+
+func TestEvaluate_ScaleUpDecayKeepsCooldownAfterScaleDown(t *testing.T) {
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 1000})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 10}})
+	updateState("projects/p/instances/a", func(s *instanceState) {
+		s.LastResized = time.Now().Add(-time.Minute)
+		s.LastChangePU = -100
+	})
+
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 2000, ScaleUpDecayHalfLifeMinutes: 30}
+	config.applyDefaults()
+	result, err := evaluate(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Reason != reasonCooldown {
+		t.Errorf("got reason=%s want %s", result.Reason, reasonCooldown)
+	}
+}
+
+func TestEvaluate_ScaleUpDecayKeepsUpdateRateLimit(t *testing.T) {
+	// 5000 PU への小さなスケールアップの直後は抑止が 0.25 しかなく、scaleDownThreshold は 22.5 までしか下がりません。
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 5000})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 20}})
+	updateState("projects/p/instances/a", func(s *instanceState) {
+		s.LastResized = time.Now().Add(-5 * time.Second)
+		s.LastChangePU = 1000
+	})
+
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 10000, ScaleUpDecayHalfLifeMinutes: 30}
+	config.applyDefaults()
+	result, err := evaluate(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Action != actionNone || result.Reason != reasonRateLimited {
+		t.Errorf("got action=%s reason=%s want %s", result.Action, result.Reason, reasonRateLimited)
+	}
+}
@@ -0,0 +1,48 @@
+package spanner
+
+import (
+	"os"
+	"strings"
+)
+
+// environmentDefaults は DEPLOY_ENV ごとに同梱しているデフォルト値です。
+// Request Body で指定した値が常に優先され、0 の項目は通常のデフォルト値を使います。
+type environmentDefaults struct {
+	ScaleUpThreshold    float64
+	ScaleDownThreshold  float64
+	CooldownBaseMinutes float64
+}
+
+// bundledDefaults は同梱しているデフォルト値です。README の表と合わせて変更してください。
+var bundledDefaults = map[string]environmentDefaults{
+	// prod は早めにスケールアップし、スケールダウンは慎重に行います。
+	"prod":    {ScaleUpThreshold: 45, ScaleDownThreshold: 20, CooldownBaseMinutes: 60},
+	"staging": {ScaleUpThreshold: 50, ScaleDownThreshold: 30, CooldownBaseMinutes: 30},
+	// dev はコストを優先し、積極的にスケールダウンします。
+	"dev": {ScaleUpThreshold: 70, ScaleDownThreshold: 45, CooldownBaseMinutes: 5},
+}
+
+// deployEnvironmentDefaults は DEPLOY_ENV に対応するデフォルト値を返します。
+// DEPLOY_ENV が設定されていないか、同梱していない値の場合は false を返します。
+func deployEnvironmentDefaults() (environmentDefaults, bool) {
+	d, ok := bundledDefaults[strings.ToLower(os.Getenv("DEPLOY_ENV"))]
+	return d, ok
+}
+
+// applyEnvironmentDefaults は指定されていない項目に DEPLOY_ENV のデフォルト値を設定します。
+// RESIZE_INTERVAL_MINUTES を設定している場合は、cooldown はそちらを優先します。
+func (c *AutoscalerConfig) applyEnvironmentDefaults() {
+	d, ok := deployEnvironmentDefaults()
+	if !ok {
+		return
+	}
+	if c.ScaleUpThreshold == 0 {
+		c.ScaleUpThreshold = d.ScaleUpThreshold
+	}
+	if c.ScaleDownThreshold == 0 {
+		c.ScaleDownThreshold = d.ScaleDownThreshold
+	}
+	if c.CooldownBaseMinutes == 0 && os.Getenv("RESIZE_INTERVAL_MINUTES") == "" {
+		c.CooldownBaseMinutes = d.CooldownBaseMinutes
+	}
+}
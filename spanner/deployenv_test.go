@@ -0,0 +1,51 @@
+package spanner
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAutoscalerConfig_ApplyDefaultsByDeployEnv(t *testing.T) {
+	cases := []struct {
+		env          string
+		wantUp       float64
+		wantDown     float64
+		wantCooldown time.Duration
+	}{
+		{"", 50, 30, 30 * time.Minute},
+		{"prod", 45, 20, 60 * time.Minute},
+		{"staging", 50, 30, 30 * time.Minute},
+		{"dev", 70, 45, 5 * time.Minute},
+		{"DEV", 70, 45, 5 * time.Minute},
+		{"unknown", 50, 30, 30 * time.Minute},
+	}
+	for _, tc := range cases {
+		t.Run(tc.env, func(t *testing.T) {
+			t.Setenv("DEPLOY_ENV", tc.env)
+			config := AutoscalerConfig{}
+			config.applyDefaults()
+			if config.ScaleUpThreshold != tc.wantUp || config.ScaleDownThreshold != tc.wantDown {
+				t.Errorf("thresholds got %v/%v want %v/%v", config.ScaleUpThreshold, config.ScaleDownThreshold, tc.wantUp, tc.wantDown)
+			}
+			if got := config.cooldown(0); got != tc.wantCooldown {
+				t.Errorf("cooldown got %v want %v", got, tc.wantCooldown)
+			}
+		})
+	}
+}
+
+func TestAutoscalerConfig_RequestOverridesDeployEnv(t *testing.T) {
+	t.Setenv("DEPLOY_ENV", "prod")
+	config := AutoscalerConfig{ScaleUpThreshold: 80, CooldownBaseMinutes: 15}
+	config.applyDefaults()
+	if config.ScaleUpThreshold != 80 || config.ScaleDownThreshold != 20 || config.CooldownBaseMinutes != 15 {
+		t.Errorf("got up=%v down=%v cooldown=%v", config.ScaleUpThreshold, config.ScaleDownThreshold, config.CooldownBaseMinutes)
+	}
+
+	t.Setenv("RESIZE_INTERVAL_MINUTES", "10")
+	config = AutoscalerConfig{}
+	config.applyDefaults()
+	if got := config.cooldown(0); got != 10*time.Minute {
+		t.Errorf("cooldown got %v want RESIZE_INTERVAL_MINUTES", got)
+	}
+}
@@ -0,0 +1,207 @@
+package spanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// digestPinnedRatio 以上の割合で PUMax に張り付いていた場合、PUMax の引き上げを提案します。
+	digestPinnedRatio = 0.5
+	// digestFlappingPerDay 以上の頻度でスケールの向きが反転していた場合、flapping と見なします。
+	digestFlappingPerDay = 4.0
+)
+
+// Digest is a periodic summary of the autoscaling history of the instances in a project.
+type Digest struct {
+	RequestID string `json:"requestId,omitempty"`
+	// From は実際に history がある期間の始まりです。history はプロセス内だけに保持するため、
+	// プロセスが起動した時刻より前は集計できず、requestedFrom より後になることがあります。
+	From          time.Time `json:"from"`
+	RequestedFrom time.Time `json:"requestedFrom"`
+	To            time.Time `json:"to"`
+	// Partial は From が requestedFrom より後で、window の一部だけを集計したことを表します。
+	Partial   bool             `json:"partial,omitempty"`
+	Instances []InstanceDigest `json:"instances"`
+}
+
+// InstanceDigest summarizes the autoscaling history of an instance over the digest window.
+type InstanceDigest struct {
+	Instance         string   `json:"instance"`
+	DisplayName      string   `json:"displayName,omitempty"`
+	Decisions        int      `json:"decisions"`
+	ScaleUps         int      `json:"scaleUps"`
+	ScaleDowns       int      `json:"scaleDowns"`
+	Reversals        int      `json:"reversals"`
+	ReversalsPerDay  float64  `json:"reversalsPerDay"`
+	AverageCPUUsage  float64  `json:"averageCPUUsage"`
+	MaxCPUUsage      float64  `json:"maxCPUUsage"`
+	AveragePU        float64  `json:"averagePU"`
+	TimeAtMaxSeconds float64  `json:"timeAtMaxSeconds"`
+	TimeAtMaxRatio   float64  `json:"timeAtMaxRatio"`
+	TimeAtMinRatio   float64  `json:"timeAtMinRatio"`
+	RecommendedPU    int32    `json:"recommendedPU"`
+	Suggestions      []string `json:"suggestions"`
+}
+
+// DigestHandler renders the digest of the last window (default 7 days) of the instances in a project as JSON,
+// or as plain text for email/Slack when format=text is given. project is required.
+func DigestHandler(w http.ResponseWriter, r *http.Request) {
+	r = withRequestID(w, r)
+	window := 7 * 24 * time.Hour
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid window.", http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+	project, allowlist, ok := authorizeProjectQuery(w, r)
+	if !ok {
+		return
+	}
+
+	digest := buildDigest(time.Now(), window, project, allowlist)
+	digest.RequestID = requestID(r.Context())
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		writeDigestText(w, digest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(digest); err != nil {
+		logf(r.Context(), "Failed to write digest response: %v", err)
+	}
+}
+
+// buildDigest は project のインスタンスのうち allowlist にあるものについて、now から window だけ遡った期間の history を集計します。
+// history はプロセス内に historyRetention の間だけ保持するため、From はそれを反映した実際に集計した期間の始まりです。
+func buildDigest(now time.Time, window time.Duration, project string, allowlist *instanceAllowlist) *Digest {
+	digest := &Digest{From: now.Add(-window), RequestedFrom: now.Add(-window), To: now, Instances: []InstanceDigest{}}
+	for _, since := range []time.Time{historyStarted, now.Add(-historyRetention)} {
+		if since.After(digest.From) {
+			digest.From = since
+		}
+	}
+	digest.Partial = digest.From.After(digest.RequestedFrom)
+	names := stateInstanceNames()
+	sort.Strings(names)
+	for _, name := range names {
+		if !matchesInstance(name, project, "") || !allowedName(allowlist, name) {
+			continue
+		}
+		state := loadState(name)
+		var entries []historyEntry
+		for _, e := range state.History {
+			if !e.Time.Before(digest.From) && !e.Time.After(now) {
+				entries = append(entries, e)
+			}
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		d := summarize(name, entries)
+		d.DisplayName = state.DisplayName
+		digest.Instances = append(digest.Instances, d)
+	}
+	return digest
+}
+
+// summarize は時刻順に並んだ entries を集計します。
+// 各 entry の PU は次の entry までの間続いていたものとして時間を数えます。
+func summarize(name string, entries []historyEntry) InstanceDigest {
+	d := InstanceDigest{Instance: name, Decisions: len(entries), Suggestions: []string{}}
+
+	var sumCPU, sumPU, atMax, atMin, total float64
+	var lastDirection string
+	for i, e := range entries {
+		sumCPU += e.CPUUsage
+		sumPU += float64(e.NewPU)
+		d.MaxCPUUsage = math.Max(d.MaxCPUUsage, e.CPUUsage)
+
+		switch e.Action {
+		case actionScaleUp, actionScaleDown:
+			if e.Action == actionScaleUp {
+				d.ScaleUps++
+			} else {
+				d.ScaleDowns++
+			}
+			if lastDirection != "" && lastDirection != e.Action {
+				d.Reversals++
+			}
+			lastDirection = e.Action
+		}
+
+		if i+1 < len(entries) {
+			span := entries[i+1].Time.Sub(e.Time).Seconds()
+			total += span
+			if e.NewPU >= e.PUMax {
+				atMax += span
+			}
+			if e.NewPU <= e.PUMin {
+				atMin += span
+			}
+		}
+	}
+	n := float64(len(entries))
+	d.AverageCPUUsage = sumCPU / n
+	d.AveragePU = sumPU / n
+	d.TimeAtMaxSeconds = atMax
+	if total > 0 {
+		d.TimeAtMaxRatio = atMax / total
+		d.TimeAtMinRatio = atMin / total
+		d.ReversalsPerDay = float64(d.Reversals) / (total / (24 * time.Hour).Seconds())
+	}
+
+	// 平均 CPU 使用率が最新の閾値の中間になる PU を推奨値とします。
+	latest := entries[len(entries)-1]
+	target := (latest.ScaleUpThreshold + latest.ScaleDownThreshold) / 2
+	if target > 0 {
+		d.RecommendedPU = roundUpProcessingUnits(int32(math.Ceil(d.AveragePU * d.AverageCPUUsage / target)))
+	}
+
+	if d.TimeAtMaxRatio >= digestPinnedRatio {
+		d.Suggestions = append(d.Suggestions, fmt.Sprintf("Pinned at puMax (%d) for %.0f%% of the window; consider raising puMax.", latest.PUMax, d.TimeAtMaxRatio*100))
+	}
+	if d.TimeAtMinRatio >= digestPinnedRatio && d.AverageCPUUsage < latest.ScaleDownThreshold {
+		d.Suggestions = append(d.Suggestions, fmt.Sprintf("Idle at puMin (%d) for %.0f%% of the window; consider lowering puMin.", latest.PUMin, d.TimeAtMinRatio*100))
+	}
+	if d.ReversalsPerDay >= digestFlappingPerDay {
+		d.Suggestions = append(d.Suggestions, fmt.Sprintf("Flapping %.1f times per day; consider widening the threshold gap or lengthening RESIZE_INTERVAL_MINUTES.", d.ReversalsPerDay))
+	}
+	if d.RecommendedPU > 0 && d.RecommendedPU != roundUpProcessingUnits(int32(math.Round(d.AveragePU))) {
+		d.Suggestions = append(d.Suggestions, fmt.Sprintf("Average load fits %d PUs (currently averaging %.0f PUs).", d.RecommendedPU, d.AveragePU))
+	}
+	return d
+}
+
+func writeDigestText(w io.Writer, digest *Digest) {
+	fmt.Fprintf(w, "Spanner autoscaler digest %s - %s\n", digest.From.Format(time.RFC3339), digest.To.Format(time.RFC3339))
+	if digest.Partial {
+		fmt.Fprintf(w, "History is kept in this autoscaler process only and covers just part of the window requested from %s.\n", digest.RequestedFrom.Format(time.RFC3339))
+	}
+	if len(digest.Instances) == 0 {
+		fmt.Fprintln(w, "No autoscaling history in this window.")
+		return
+	}
+	for _, d := range digest.Instances {
+		if d.DisplayName != "" {
+			fmt.Fprintf(w, "\n%s (%s)\n", d.DisplayName, d.Instance)
+		} else {
+			fmt.Fprintf(w, "\n%s\n", d.Instance)
+		}
+		fmt.Fprintf(w, "  decisions: %d (scale up %d, scale down %d, reversals %d)\n", d.Decisions, d.ScaleUps, d.ScaleDowns, d.Reversals)
+		fmt.Fprintf(w, "  cpu: avg %.1f%%, max %.1f%%\n", d.AverageCPUUsage, d.MaxCPUUsage)
+		fmt.Fprintf(w, "  pu: avg %.0f, at max %.0f%% of the time, recommended %d\n", d.AveragePU, d.TimeAtMaxRatio*100, d.RecommendedPU)
+		if len(d.Suggestions) > 0 {
+			fmt.Fprintf(w, "  suggestions:\n    - %s\n", strings.Join(d.Suggestions, "\n    - "))
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package spanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useHistoryStarted は history を記録し始めた時刻を started に差し替えます。
+func useHistoryStarted(t *testing.T, started time.Time) {
+	t.Helper()
+	orig := historyStarted
+	historyStarted = started
+	t.Cleanup(func() { historyStarted = orig })
+}
+
+func TestBuildDigest(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+
+	now := time.Date(2026, 1, 8, 0, 0, 0, 0, time.UTC)
+	useHistoryStarted(t, now.Add(-30*24*time.Hour))
+	entry := func(hoursAgo int, cpu float64, pu int32, action string) historyEntry {
+		return historyEntry{
+			Time: now.Add(-time.Duration(hoursAgo) * time.Hour), CPUUsage: cpu, NewPU: pu,
+			PUMin: 100, PUMax: 1000, ScaleUpThreshold: 60, ScaleDownThreshold: 20, Action: action,
+		}
+	}
+	// pinned: 最後の 30 時間を除いて PUMax に張り付いています。
+	pinned := []historyEntry{entry(200, 95, 1000, actionNone)}
+	for h := 100; h >= 0; h -= 10 {
+		pu, action := int32(1000), actionNone
+		if h <= 30 {
+			pu = 900
+		}
+		pinned = append(pinned, entry(h, 80, pu, action))
+	}
+	// flapping: 1時間ごとにスケールアップとスケールダウンを繰り返しています。
+	var flapping []historyEntry
+	for h := 24; h >= 0; h-- {
+		action, pu := actionScaleUp, int32(300)
+		if h%2 == 0 {
+			action, pu = actionScaleDown, 200
+		}
+		flapping = append(flapping, entry(h, 40, pu, action))
+	}
+	updateState("projects/p/instances/pinned", func(s *instanceState) { s.History = pinned })
+	updateState("projects/p/instances/flapping", func(s *instanceState) { s.History = flapping })
+	// 他の project のインスタンスは集計しません。
+	updateState("projects/q/instances/other", func(s *instanceState) { s.History = flapping })
+
+	digest := buildDigest(now, 7*24*time.Hour, "p", nil)
+	if digest.Partial || !digest.From.Equal(now.Add(-7*24*time.Hour)) {
+		t.Errorf("got from=%s partial=%v want the whole window", digest.From, digest.Partial)
+	}
+	if len(digest.Instances) != 2 {
+		t.Fatalf("instances: got %d want 2", len(digest.Instances))
+	}
+
+	f := digest.Instances[0]
+	if f.Instance != "projects/p/instances/flapping" {
+		t.Fatalf("instance order: got %s", f.Instance)
+	}
+	if f.Reversals != 24 || f.ScaleUps != 12 || f.ScaleDowns != 13 {
+		t.Errorf("flapping: got reversals=%d ups=%d downs=%d", f.Reversals, f.ScaleUps, f.ScaleDowns)
+	}
+	if f.ReversalsPerDay != 24 {
+		t.Errorf("flapping: reversals per day got %v want 24", f.ReversalsPerDay)
+	}
+	if !containsSuggestion(f.Suggestions, "Flapping") {
+		t.Errorf("flapping: suggestions %v", f.Suggestions)
+	}
+
+	p := digest.Instances[1]
+	// 200h 前の記録は 7 日の window の外です。
+	if p.Decisions != 11 {
+		t.Errorf("pinned: decisions got %d want 11", p.Decisions)
+	}
+	if p.AverageCPUUsage != 80 {
+		t.Errorf("pinned: average cpu got %v want 80", p.AverageCPUUsage)
+	}
+	if p.TimeAtMaxSeconds != (70 * time.Hour).Seconds() {
+		t.Errorf("pinned: time at max got %v want %v", p.TimeAtMaxSeconds, (70 * time.Hour).Seconds())
+	}
+	if p.TimeAtMaxRatio != 0.7 {
+		t.Errorf("pinned: time at max ratio got %v want 0.7", p.TimeAtMaxRatio)
+	}
+	// 平均 PU 963.6 * 80% / 40% = 1927.3 -> 2000
+	if p.RecommendedPU != 2000 {
+		t.Errorf("pinned: recommended pu got %d want 2000", p.RecommendedPU)
+	}
+	if !containsSuggestion(p.Suggestions, "consider raising puMax") {
+		t.Errorf("pinned: suggestions %v", p.Suggestions)
+	}
+
+	var buf bytes.Buffer
+	writeDigestText(&buf, digest)
+	if !strings.Contains(buf.String(), "projects/p/instances/pinned") || !strings.Contains(buf.String(), "consider raising puMax") {
+		t.Errorf("text digest: %s", buf.String())
+	}
+}
+
+func TestBuildDigest_CoveredRange(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+	now := time.Date(2026, 1, 8, 0, 0, 0, 0, time.UTC)
+
+	// プロセスが 2 日前に起動した場合は、その時刻からの history しかありません。
+	useHistoryStarted(t, now.Add(-48*time.Hour))
+	digest := buildDigest(now, 7*24*time.Hour, "p", nil)
+	if !digest.Partial || !digest.From.Equal(now.Add(-48*time.Hour)) || !digest.RequestedFrom.Equal(now.Add(-7*24*time.Hour)) {
+		t.Errorf("got from=%s requestedFrom=%s partial=%v", digest.From, digest.RequestedFrom, digest.Partial)
+	}
+	var buf bytes.Buffer
+	writeDigestText(&buf, digest)
+	if !strings.Contains(buf.String(), "covers just part of the window") {
+		t.Errorf("text digest: %s", buf.String())
+	}
+
+	// historyRetention より長い window も、保持している期間だけを集計します。
+	useHistoryStarted(t, now.Add(-30*24*time.Hour))
+	digest = buildDigest(now, 30*24*time.Hour, "p", nil)
+	if !digest.Partial || !digest.From.Equal(now.Add(-historyRetention)) {
+		t.Errorf("got from=%s partial=%v want %s", digest.From, digest.Partial, now.Add(-historyRetention))
+	}
+}
+
+func TestDigestHandler_AuthorizeCaller(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+	t.Setenv("AUTHORIZED_CALLERS", `{"p": ["ops"]}`)
+	t.Setenv("ALLOWED_INSTANCES", "p/a,q/b")
+	useFakeIDTokens(t, map[string]string{"ops-token": "scaler@ops.iam.gserviceaccount.com"})
+	for _, name := range []string{"projects/p/instances/a", "projects/p/instances/hidden", "projects/q/instances/b"} {
+		updateState(name, func(s *instanceState) {
+			s.History = []historyEntry{{Time: time.Now(), CPUUsage: 40, NewPU: 100, Action: actionNone}}
+		})
+	}
+
+	cases := []struct {
+		name  string
+		query string
+		token string
+		want  int
+	}{
+		{"authorized project", "?project=p", "ops-token", http.StatusOK},
+		{"other project", "?project=q", "ops-token", http.StatusForbidden},
+		{"missing project", "", "ops-token", http.StatusBadRequest},
+		{"missing token", "?project=p", "", http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/spanner/autoscaler/digest"+tc.query, nil)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			rr := httptest.NewRecorder()
+			DigestHandler(rr, req)
+			if rr.Code != tc.want {
+				t.Fatalf("status got %d want %d: %s", rr.Code, tc.want, rr.Body.String())
+			}
+			if tc.want != http.StatusOK {
+				return
+			}
+			var digest Digest
+			if err := json.Unmarshal(rr.Body.Bytes(), &digest); err != nil {
+				t.Fatal(err)
+			}
+			// allowlist にないインスタンスと他の project のインスタンスは含めません。
+			if len(digest.Instances) != 1 || digest.Instances[0].Instance != "projects/p/instances/a" {
+				t.Errorf("instances got %+v want only projects/p/instances/a", digest.Instances)
+			}
+		})
+	}
+}
+
+func containsSuggestion(suggestions []string, substr string) bool {
+	for _, s := range suggestions {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
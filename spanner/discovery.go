@@ -0,0 +1,244 @@
+package spanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	instancepb "cloud.google.com/go/spanner/admin/instance/apiv1/instancepb"
+	"google.golang.org/api/iterator"
+)
+
+// DiscoveryConfig discovers the instances to autoscale with ListInstances instead of listing them one by one.
+type DiscoveryConfig struct {
+	Project string `json:"project"`
+	// LabelSelector に一致するラベルをすべて持つインスタンスを対象にします。
+	LabelSelector map[string]string `json:"labelSelector"`
+	// InstanceConfig を指定すると、その instance config (例: regional-asia-northeast1) のインスタンスだけを対象にします。
+	InstanceConfig string `json:"instanceConfig"`
+	// Template は見つかったすべてのインスタンスに適用する設定です。project と instance は無視されます。
+	Template AutoscalerConfig `json:"template"`
+	// MaxDiscoveredInstances を指定すると、見つかったインスタンスがその数を超えた場合は batch 全体を処理しません。
+	// 条件の指定を誤って大量のインスタンスをリサイズしてしまうのを防ぎます。
+	MaxDiscoveredInstances int `json:"maxDiscoveredInstances"`
+	// ConfirmOverMaxInstances を有効にすると、MaxDiscoveredInstances を超えた場合も処理します。
+	ConfirmOverMaxInstances bool `json:"confirmOverMaxInstances"`
+}
+
+func (d *DiscoveryConfig) validate() error {
+	if d.Project == "" {
+		return errors.New("Discovery requires project.")
+	}
+	if d.MaxDiscoveredInstances < 0 {
+		return errors.New("Invalid maxDiscoveredInstances.")
+	}
+	return nil
+}
+
+// selector は discovery の条件を人が読める形で返します。
+func (d *DiscoveryConfig) selector() string {
+	keys := make([]string, 0, len(d.LabelSelector))
+	for k := range d.LabelSelector {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	terms := make([]string, 0, len(keys)+1)
+	for _, k := range keys {
+		terms = append(terms, fmt.Sprintf("labels.%s:%s", k, d.LabelSelector[k]))
+	}
+	if d.InstanceConfig != "" {
+		terms = append(terms, "config:"+d.InstanceConfig)
+	}
+	return strings.Join(terms, " ")
+}
+
+// matches は ListInstances の filter が部分一致のため、ラベルと instance config が完全に一致するかを確認します。
+func (d *DiscoveryConfig) matches(instance *instancepb.Instance) bool {
+	for k, v := range d.LabelSelector {
+		if instance.GetLabels()[k] != v {
+			return false
+		}
+	}
+	if d.InstanceConfig != "" && !strings.HasSuffix(instance.GetConfig(), "/instanceConfigs/"+d.InstanceConfig) {
+		return false
+	}
+	return true
+}
+
+// discoveryCacheTTL は discovery の結果をキャッシュする期間です。
+func discoveryCacheTTL() time.Duration {
+	return durationFromEnv("DISCOVERY_CACHE_TTL_SECONDS", 300, time.Second)
+}
+
+// discoveryEvictTTLs は TTL の何倍の間更新されなかったエントリをキャッシュから削除するかです。
+// キーは呼び出し元が指定する project と selector のため、使われなくなったエントリを残し続けないようにします。
+// 使われているエントリは TTL ごとに更新されるため削除されません。更新に失敗し続けた場合は削除し、次の呼び出しで同期的に取得し直します。
+const discoveryEvictTTLs = 3
+
+// instanceDiscovery は discovery の結果をプロセス内にキャッシュします。
+var instanceDiscovery = newDiscoveryCache()
+
+// discoveryCache は discovery の結果を TTL の間キャッシュします。
+// TTL を過ぎたエントリはそのまま返しつつバックグラウンドで更新するため、リクエストが ListInstances を待つのは初回だけです。
+type discoveryCache struct {
+	mu      sync.Mutex
+	entries map[string]*discoveryEntry
+	now     func() time.Time
+	// refreshing はバックグラウンドの更新を待つためにテストで使います。
+	refreshing sync.WaitGroup
+}
+
+type discoveryEntry struct {
+	instances  []string
+	fetched    time.Time
+	refreshing bool
+}
+
+func newDiscoveryCache() *discoveryCache {
+	return &discoveryCache{entries: make(map[string]*discoveryEntry), now: time.Now}
+}
+
+// instances は d に一致する instance ID を返します。
+func (c *discoveryCache) instances(ctx context.Context, d *DiscoveryConfig) ([]string, error) {
+	key := d.Project + "\x00" + d.selector()
+
+	c.mu.Lock()
+	c.evict()
+	e, ok := c.entries[key]
+	if ok {
+		if !e.refreshing && c.now().Sub(e.fetched) >= discoveryCacheTTL() {
+			e.refreshing = true
+			c.refreshing.Add(1)
+			// リクエストの context はレスポンスを返すとキャンセルされるため、correlation ID だけを引き継ぎます。
+			go c.refresh(context.WithoutCancel(ctx), key, d)
+		}
+		instances := e.instances
+		c.mu.Unlock()
+		return instances, nil
+	}
+	c.mu.Unlock()
+
+	// キャッシュが空の場合だけ同期的に取得します。
+	instances, err := discoverInstances(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.entries[key] = &discoveryEntry{instances: instances, fetched: c.now()}
+	c.mu.Unlock()
+	return instances, nil
+}
+
+func (c *discoveryCache) refresh(ctx context.Context, key string, d *DiscoveryConfig) {
+	defer c.refreshing.Done()
+
+	instances, err := discoverInstances(ctx, d)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.entries[key]
+	e.refreshing = false
+	if err != nil {
+		logf(ctx, "Failed to refresh discovered instances for %s: %v", d.selector(), err)
+		return
+	}
+	e.instances = instances
+	e.fetched = c.now()
+}
+
+// evict は TTL の discoveryEvictTTLs 倍の間更新されなかったエントリを削除します。c.mu を持って呼び出します。
+// 更新中のエントリは refresh が書き戻すため削除しません。
+func (c *discoveryCache) evict() {
+	limit := discoveryEvictTTLs * discoveryCacheTTL()
+	for key, e := range c.entries {
+		if !e.refreshing && c.now().Sub(e.fetched) > limit {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// discoverInstances は ListInstances で d に一致する instance ID を取得します。
+func discoverInstances(ctx context.Context, d *DiscoveryConfig) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout())
+	defer cancel()
+
+	instanceAdminClient, err := newInstanceAdminClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spanner instance admin client: %w", err)
+	}
+	defer instanceAdminClient.Close()
+
+	filter := make([]string, 0, len(d.LabelSelector))
+	for k, v := range d.LabelSelector {
+		filter = append(filter, fmt.Sprintf("labels.%s:%s", k, v))
+	}
+	sort.Strings(filter)
+
+	var instances []string
+	it := instanceAdminClient.ListInstances(ctx, &instancepb.ListInstancesRequest{
+		Parent: "projects/" + d.Project,
+		Filter: strings.Join(filter, " "),
+	})
+	for {
+		instance, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list instances: %w", err)
+		}
+		if !d.matches(instance) {
+			continue
+		}
+		instances = append(instances, instance.GetName()[strings.LastIndex(instance.GetName(), "/")+1:])
+	}
+	return instances, nil
+}
+
+// discover は b.Discovery で見つかったインスタンスを b.Instances に追加します。
+// 既に b.Instances に含まれているインスタンスは個別の設定を優先します。
+func (b *BatchConfig) discover(ctx context.Context) error {
+	if b.Discovery == nil {
+		return nil
+	}
+	if err := b.Discovery.validate(); err != nil {
+		return err
+	}
+	ids, err := instanceDiscovery.instances(ctx, b.Discovery)
+	if err != nil {
+		return &autoscaleError{message: "Failed to discover instances.", err: err}
+	}
+	if d := b.Discovery; d.MaxDiscoveredInstances > 0 && len(ids) > d.MaxDiscoveredInstances {
+		if !d.ConfirmOverMaxInstances {
+			return fmt.Errorf("Discovered %d instances for %q, more than maxDiscoveredInstances %d. Set confirmOverMaxInstances to proceed.", len(ids), d.selector(), d.MaxDiscoveredInstances)
+		}
+		logf(ctx, "Proceeding with %d discovered instances for %q over maxDiscoveredInstances %d", len(ids), d.selector(), d.MaxDiscoveredInstances)
+	}
+	allowlist, err := loadInstanceAllowlist()
+	if err != nil {
+		return &autoscaleError{message: "Invalid allowlist configuration.", err: err}
+	}
+	listed := make(map[string]bool, len(b.Instances))
+	for _, c := range b.Instances {
+		listed[c.instanceName()] = true
+	}
+	for _, id := range ids {
+		if listed[fmt.Sprintf("projects/%s/instances/%s", b.Discovery.Project, id)] {
+			continue
+		}
+		if !allowlist.allows(b.Discovery.Project, id) {
+			logf(ctx, "Skipping discovered instance %s/%s outside the allowlist", b.Discovery.Project, id)
+			continue
+		}
+		c := b.Discovery.Template
+		c.Project = b.Discovery.Project
+		c.Instance = id
+		b.Instances = append(b.Instances, c)
+	}
+	logf(ctx, "Discovered %d instances for %s", len(ids), b.Discovery.selector())
+	return nil
+}
@@ -0,0 +1,226 @@
+package spanner
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiscoveryCache(t *testing.T) {
+	t.Setenv("DISCOVERY_CACHE_TTL_SECONDS", "60")
+	admin := newFakeInstanceAdmin(map[string]int32{
+		"projects/p/instances/a": 100,
+		"projects/p/instances/b": 100,
+		"projects/p/instances/c": 100,
+	})
+	admin.instances["projects/p/instances/a"].Labels = map[string]string{"autoscaler": "enabled"}
+	admin.instances["projects/p/instances/b"].Labels = map[string]string{"autoscaler": "enabled"}
+	admin.instances["projects/p/instances/b"].Config = "projects/p/instanceConfigs/nam3"
+	admin.instances["projects/p/instances/c"].Labels = map[string]string{"autoscaler": "enabled-later"}
+	useFakes(t, admin, &fakeMetricClient{})
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := newDiscoveryCache()
+	cache.now = func() time.Time { return now }
+	d := &DiscoveryConfig{Project: "p", LabelSelector: map[string]string{"autoscaler": "enabled"}}
+	ctx := context.Background()
+
+	// 初回は同期的に取得します。
+	got, err := cache.instances(ctx, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cold: got %v want %v", got, want)
+	}
+
+	// TTL 内はキャッシュから返します。
+	admin.instances["projects/p/instances/c"].Labels["autoscaler"] = "enabled"
+	now = now.Add(30 * time.Second)
+	if got, _ := cache.instances(ctx, d); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("within TTL: got %v", got)
+	}
+	if admin.listCalls != 1 {
+		t.Errorf("within TTL: ListInstances called %d times want 1", admin.listCalls)
+	}
+
+	// TTL を過ぎると古い結果を返しつつバックグラウンドで更新します。
+	now = now.Add(31 * time.Second)
+	if got, _ := cache.instances(ctx, d); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("stale: got %v", got)
+	}
+	cache.refreshing.Wait()
+	if admin.listCalls != 2 {
+		t.Errorf("after TTL: ListInstances called %d times want 2", admin.listCalls)
+	}
+	if got, _ := cache.instances(ctx, d); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("refreshed: got %v", got)
+	}
+	if admin.listCalls != 2 {
+		t.Errorf("refreshed: ListInstances called %d times want 2", admin.listCalls)
+	}
+}
+
+func TestDiscoveryCache_Evict(t *testing.T) {
+	t.Setenv("DISCOVERY_CACHE_TTL_SECONDS", "60")
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 100, "projects/q/instances/b": 100})
+	useFakes(t, admin, &fakeMetricClient{})
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := newDiscoveryCache()
+	cache.now = func() time.Time { return now }
+	ctx := context.Background()
+	p, q := &DiscoveryConfig{Project: "p"}, &DiscoveryConfig{Project: "q"}
+
+	if _, err := cache.instances(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	// q は使われ続けて TTL ごとに更新されますが、p は使われなくなります。
+	for i := 0; i < 4; i++ {
+		now = now.Add(61 * time.Second)
+		if _, err := cache.instances(ctx, q); err != nil {
+			t.Fatal(err)
+		}
+		cache.refreshing.Wait()
+	}
+	cache.mu.Lock()
+	_, keptP := cache.entries["p\x00"+p.selector()]
+	_, keptQ := cache.entries["q\x00"+q.selector()]
+	cache.mu.Unlock()
+	if keptP || !keptQ {
+		t.Errorf("entries got p=%v q=%v want only q", keptP, keptQ)
+	}
+}
+
+func TestDiscoveryCache_RefreshKeepsRequestID(t *testing.T) {
+	t.Setenv("DISCOVERY_CACHE_TTL_SECONDS", "60")
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 100})
+	useFakes(t, admin, &fakeMetricClient{})
+	var buf strings.Builder
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := newDiscoveryCache()
+	cache.now = func() time.Time { return now }
+	d := &DiscoveryConfig{Project: "p"}
+	if _, err := cache.instances(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+
+	// リクエストの context がキャンセルされても、バックグラウンドの更新は correlation ID を付けてログに出力します。
+	admin.listErr = errors.New("list failed")
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), requestIDKey{}, "req-1"))
+	now = now.Add(61 * time.Second)
+	if _, err := cache.instances(ctx, d); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	cache.refreshing.Wait()
+	if !strings.Contains(buf.String(), "[request_id=req-1] Failed to refresh discovered instances") {
+		t.Errorf("refresh log does not carry the request ID:\n%s", buf.String())
+	}
+}
+
+func TestBatchConfig_Discover(t *testing.T) {
+	admin := newFakeInstanceAdmin(map[string]int32{
+		"projects/p/instances/a": 100,
+		"projects/p/instances/b": 100,
+	})
+	admin.instances["projects/p/instances/a"].Config = "projects/p/instanceConfigs/regional-asia-northeast1"
+	admin.instances["projects/p/instances/b"].Config = "projects/p/instanceConfigs/nam3"
+	useFakes(t, admin, &fakeMetricClient{})
+	orig := instanceDiscovery
+	instanceDiscovery = newDiscoveryCache()
+	t.Cleanup(func() { instanceDiscovery = orig })
+
+	b := BatchConfig{Discovery: &DiscoveryConfig{
+		Project:        "p",
+		InstanceConfig: "regional-asia-northeast1",
+		Template:       AutoscalerConfig{PUStep: 100, PUMin: 100, PUMax: 500},
+	}}
+	if err := b.discover(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []AutoscalerConfig{{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 500}}
+	if !reflect.DeepEqual(b.Instances, want) {
+		t.Errorf("got %+v want %+v", b.Instances, want)
+	}
+}
+
+func TestBatchConfig_DiscoverMaxInstances(t *testing.T) {
+	cases := []struct {
+		name      string
+		max       int
+		confirm   bool
+		wantErr   bool
+		wantCount int
+	}{
+		{"no limit", 0, false, false, 3},
+		{"within limit", 3, false, false, 3},
+		{"over limit", 2, false, true, 0},
+		{"over limit confirmed", 2, true, false, 3},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := newFakeInstanceAdmin(map[string]int32{
+				"projects/p/instances/a": 100,
+				"projects/p/instances/b": 100,
+				"projects/p/instances/c": 100,
+			})
+			for _, i := range admin.instances {
+				i.Labels = map[string]string{"env": "prod"}
+			}
+			useFakes(t, admin, &fakeMetricClient{})
+			orig := instanceDiscovery
+			instanceDiscovery = newDiscoveryCache()
+			t.Cleanup(func() { instanceDiscovery = orig })
+
+			b := BatchConfig{Discovery: &DiscoveryConfig{
+				Project:                 "p",
+				LabelSelector:           map[string]string{"env": "prod"},
+				Template:                AutoscalerConfig{PUStep: 100, PUMin: 100, PUMax: 500},
+				MaxDiscoveredInstances:  tc.max,
+				ConfirmOverMaxInstances: tc.confirm,
+			}}
+			err := b.discover(context.Background())
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("discover() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if err != nil && (!strings.Contains(err.Error(), "Discovered 3 instances") || !strings.Contains(err.Error(), "labels.env:prod")) {
+				t.Errorf("error %q does not include the count and selector", err)
+			}
+			if len(b.Instances) != tc.wantCount {
+				t.Errorf("instances got %d want %d", len(b.Instances), tc.wantCount)
+			}
+		})
+	}
+}
+
+func TestBatchHandler_DiscoverOverMaxInstances(t *testing.T) {
+	admin := newFakeInstanceAdmin(map[string]int32{
+		"projects/p/instances/a": 100,
+		"projects/p/instances/b": 100,
+	})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90, "b": 90}})
+	orig := instanceDiscovery
+	instanceDiscovery = newDiscoveryCache()
+	t.Cleanup(func() { instanceDiscovery = orig })
+
+	body := `{"discovery": {"project": "p", "maxDiscoveredInstances": 1, "template": {"puStep": 100, "puMin": 100, "puMax": 1000}}}`
+	rr := httptest.NewRecorder()
+	BatchHandler(rr, httptest.NewRequest(http.MethodPost, "/spanner/autoscaler/batch", strings.NewReader(body)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status got %d want %d: %s", rr.Code, http.StatusBadRequest, rr.Body.String())
+	}
+	if len(admin.updated()) != 0 {
+		t.Errorf("updated %v want none", admin.updated())
+	}
+}
@@ -0,0 +1,77 @@
+package spanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const reasonDriftDown = "drift_down"
+
+// DriftZone slowly shrinks an instance whose CPU usage stays just above scaleDownThreshold,
+// drifting toward the size where CPU usage sits at the top of the zone.
+type DriftZone struct {
+	// WidthPercent は scaleDownThreshold から drift zone の上端までの幅 (ポイント) です。
+	WidthPercent float64 `json:"widthPercent"`
+	// Invocations は drift zone 内の呼び出しが何回続くごとに1単位スケールダウンするかです。デフォルトは 6 です。
+	Invocations int `json:"invocations"`
+}
+
+func (z *DriftZone) applyDefaults() {
+	if z.Invocations == 0 {
+		z.Invocations = 6
+	}
+}
+
+func (z *DriftZone) validate() error {
+	if z.WidthPercent <= 0 || z.Invocations < 0 {
+		return errors.New("Invalid driftZone.")
+	}
+	return nil
+}
+
+// driftDown は CPU 使用率が drift zone 内の呼び出しが Invocations 回続いた場合に、
+// 1単位 (1000 PU 以下は 100 PU、それより大きい場合は 1000 PU) のスケールダウンを result に設定して true を返します。
+// スケールダウンした後の CPU 使用率の見込みが drift zone の上端に達する場合は、既に効率のよいサイズとみなして何もしません。
+// cooldown と quietPeriodMinutes の間や、CPU 使用率以外のメトリクスがスケールダウンを許可しない場合は通常のスケールダウンと同じく待ちます。
+func driftDown(ctx context.Context, config AutoscalerConfig, state instanceState, evals []Evaluation, result *ScaleResult) bool {
+	z := config.DriftZone
+	if z == nil {
+		return false
+	}
+	top := config.ScaleDownThreshold + z.WidthPercent
+	if result.CPUUsage < config.ScaleDownThreshold || result.CPUUsage >= top {
+		return false
+	}
+	result.driftInvocations = state.DriftInvocations + 1
+	result.Diagnostics.DriftInvocations = result.driftInvocations
+	if result.driftInvocations < z.Invocations {
+		return false
+	}
+	for _, e := range evals {
+		if e.Name != evaluatorCPU && e.Name != evaluatorCPUBaseline && !e.PermitsDown {
+			return false
+		}
+	}
+	newPU := roundDownProcessingUnits(result.CurrentPU - 1)
+	if newPU < scaleDownFloor(config, result) {
+		return false
+	}
+	if projected := result.CPUUsage * float64(result.CurrentPU) / float64(newPU); projected >= top {
+		return false
+	}
+	if !state.LastResized.IsZero() && time.Since(state.LastResized) < config.cooldown(state.LastChangePU) {
+		return false
+	}
+	if config.awaitsQuietPeriod(state, time.Now()) {
+		return false
+	}
+	logf(ctx, "CPU usage has been in the drift zone for %d invocations; drifting down to %d PUs.", result.driftInvocations, newPU)
+	result.driftInvocations = 0
+	result.Action = actionScaleDown
+	result.NewPU = newPU
+	result.Reason = reasonDriftDown
+	result.Message = fmt.Sprintf("CPU usage is in the drift zone; drifted down to %d PUs.", newPU)
+	return true
+}
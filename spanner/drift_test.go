@@ -0,0 +1,73 @@
+package spanner
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEvaluate_DriftZone(t *testing.T) {
+	cases := []struct {
+		name        string
+		cpu         []float64
+		wantActions []string
+		wantNewPU   int32
+	}{
+		{"drift after consecutive invocations in the zone", []float64{32, 32, 32}, []string{actionNone, actionNone, actionScaleDown}, 900},
+		{"upper part of the band stays no-op", []float64{45, 45, 45, 45}, []string{actionNone, actionNone, actionNone, actionNone}, 1000},
+		{"already at an efficient size", []float64{38, 38, 38}, []string{actionNone, actionNone, actionNone}, 1000},
+		{"leaving the zone resets the count", []float64{32, 32, 45, 32, 32}, []string{actionNone, actionNone, actionNone, actionNone, actionNone}, 1000},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 1000})
+			metrics := &fakeMetricClient{cpu: map[string]float64{}}
+			useFakes(t, admin, metrics)
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 5000,
+				DriftZone: &DriftZone{WidthPercent: 10, Invocations: 3}}
+			config.applyDefaults()
+
+			var result *ScaleResult
+			for i, cpu := range tc.cpu {
+				metrics.cpu["a"] = cpu
+				var err error
+				result, err = evaluate(context.Background(), config)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := apply(context.Background(), result); err != nil {
+					t.Fatal(err)
+				}
+				if result.Action != tc.wantActions[i] {
+					t.Errorf("invocation %d with cpu %v got action=%s reason=%s want %s", i, cpu, result.Action, result.Reason, tc.wantActions[i])
+				}
+			}
+			if result.Action == actionScaleDown && result.Reason != reasonDriftDown {
+				t.Errorf("reason got %s want %s", result.Reason, reasonDriftDown)
+			}
+			if got := admin.processingUnits("projects/p/instances/a"); got != tc.wantNewPU {
+				t.Errorf("processing units got %d want %d", got, tc.wantNewPU)
+			}
+		})
+	}
+}
+
+func TestEvaluate_DriftZoneRespectsCooldown(t *testing.T) {
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 1000})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 32}})
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 5000,
+		DriftZone: &DriftZone{WidthPercent: 10, Invocations: 1}}
+	config.applyDefaults()
+
+	for i, want := range []string{actionScaleDown, actionNone} {
+		result, err := evaluate(context.Background(), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := apply(context.Background(), result); err != nil {
+			t.Fatal(err)
+		}
+		if result.Action != want {
+			t.Errorf("invocation %d got action=%s reason=%s want %s", i, result.Action, result.Reason, want)
+		}
+	}
+}
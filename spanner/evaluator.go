@@ -0,0 +1,130 @@
+package spanner
+
+const (
+	directionUp   = "up"
+	directionDown = "down"
+	directionNone = "none"
+)
+
+const (
+	evaluatorCPU     = "cpu"
+	evaluatorStorage = "storage"
+)
+
+const (
+	reasonStorageAboveThreshold = "storage_above_threshold"
+	reasonScaleDownVetoed       = "scale_down_vetoed"
+)
+
+// Evaluation is the scaling direction a single metric asks for.
+type Evaluation struct {
+	Name      string  `json:"name"`
+	Value     float64 `json:"value"`
+	Direction string  `json:"direction"`
+	// PermitsDown はこのメトリクスがスケールダウンしても問題ないと判断したかどうかです。
+	PermitsDown bool `json:"permitsDown"`
+}
+
+// evaluateMetrics は有効なメトリクスごとにスケーリングの向きを判断します。
+// どれかのメトリクスが正常範囲でも他のメトリクスの評価は省略せず、常に CPU、CPU の baseline、storage、latency の順にすべて評価します。
+// CPU の baseline は relativeThresholds を指定し、baseline を計算できた場合だけ評価します。
+func evaluateMetrics(config AutoscalerConfig, result *ScaleResult) []Evaluation {
+	evals := []Evaluation{cpuEvaluation(config, result.CPUUsage)}
+	if r := config.RelativeThresholds; r != nil && result.Diagnostics.CPUBaseline != nil {
+		b := baselineEvaluation(r, result.CPUUsage, *result.Diagnostics.CPUBaseline)
+		combineCPUEvaluations(r, &evals[0], &b)
+		evals = append(evals, b)
+	}
+	if config.readsStorage() {
+		evals = append(evals, storageEvaluation(config, result.StorageUtilization, result.CurrentPU, scaleDownTarget(config, result)))
+	}
+	if config.readsLatency() {
+		evals = append(evals, latencyEvaluation(config, result.LatencyMs))
+	}
+	return evals
+}
+
+// scaleDownTarget はスケールダウンする場合の PU の見込みです。
+func scaleDownTarget(config AutoscalerConfig, result *ScaleResult) int32 {
+	floor := scaleDownFloor(config, result)
+	if config.MinimizeCost {
+		return floor
+	}
+	target := config.stepDown(result.CurrentPU)
+	if target < floor {
+		target = floor
+	}
+	return target
+}
+
+// cpuEvaluation は CPU 使用率を閾値と比較します。
+// DeadBandPercent を指定した場合は、閾値から DeadBandPercent ポイント以上離れるまでスケーリングを求めません。
+func cpuEvaluation(config AutoscalerConfig, cpuUsage float64) Evaluation {
+	e := Evaluation{Name: evaluatorCPU, Value: cpuUsage, Direction: directionNone}
+	switch {
+	case cpuUsage > config.ScaleUpThreshold+config.DeadBandPercent:
+		e.Direction = directionUp
+	case cpuUsage < config.ScaleDownThreshold-config.DeadBandPercent:
+		e.Direction = directionDown
+	}
+	e.PermitsDown = e.Direction == directionDown
+	return e
+}
+
+// storageEvaluation は storage の使用率が上限に近づいていればスケールアップを求めます。
+// storage の使用率が低いことはスケールダウンの理由にしません。
+// storage の上限は PU に比例するため、targetPU に縮めると閾値を超える場合はスケールダウンを許可しません。
+// ScaleDownGate の StorageSafeThreshold 以上の場合もスケールダウンを許可しません。
+func storageEvaluation(config AutoscalerConfig, utilization float64, currentPU, targetPU int32) Evaluation {
+	e := Evaluation{Name: evaluatorStorage, Value: utilization, Direction: directionNone, PermitsDown: true}
+	if config.StorageScaleUpThreshold > 0 {
+		if utilization > config.StorageScaleUpThreshold {
+			e.Direction = directionUp
+			e.PermitsDown = false
+			return e
+		}
+		e.PermitsDown = targetPU > 0 && utilization*float64(currentPU)/float64(targetPU) <= config.StorageScaleUpThreshold
+	}
+	if g := config.ScaleDownGate; g != nil && g.StorageSafeThreshold > 0 && utilization >= g.StorageSafeThreshold {
+		e.PermitsDown = false
+	}
+	return e
+}
+
+// scaleDownVetoes は、スケールダウンを求めるメトリクスがあるかどうかと、スケールダウンを許可しなかったメトリクスの名前を返します。
+// スケールダウンはすべてのメトリクスが許可した場合だけ行います。
+func scaleDownVetoes(evals []Evaluation) (bool, []string) {
+	var wantsDown bool
+	var vetoes []string
+	for _, e := range evals {
+		if e.Direction == directionDown {
+			wantsDown = true
+		}
+		if !e.PermitsDown {
+			vetoes = append(vetoes, e.Name)
+		}
+	}
+	if !wantsDown {
+		return false, nil
+	}
+	return true, vetoes
+}
+
+// scaleUpReason はスケールアップを求めた最初のメトリクスに対応する reason を返します。
+// どのメトリクスもスケールアップを求めていなければ空文字を返します。
+func scaleUpReason(evals []Evaluation) string {
+	for _, e := range evals {
+		if e.Direction != directionUp {
+			continue
+		}
+		switch e.Name {
+		case evaluatorCPU:
+			return reasonCPUAboveThreshold
+		case evaluatorCPUBaseline:
+			return reasonCPUAboveBaseline
+		case evaluatorStorage:
+			return reasonStorageAboveThreshold
+		}
+	}
+	return ""
+}
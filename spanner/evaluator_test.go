@@ -0,0 +1,131 @@
+package spanner
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEvaluate_StoragePressure(t *testing.T) {
+	cases := []struct {
+		name       string
+		cpu        float64
+		storage    float64
+		wantAction string
+		wantReason string
+	}{
+		{"normal cpu and high storage", 40, 90, actionScaleUp, reasonStorageAboveThreshold},
+		{"low cpu and high storage", 10, 90, actionScaleUp, reasonStorageAboveThreshold},
+		{"high cpu and high storage", 90, 90, actionScaleUp, reasonCPUAboveThreshold},
+		{"normal cpu and normal storage", 40, 50, actionNone, reasonWithinRange},
+		{"low cpu and normal storage", 10, 50, actionScaleDown, reasonCPUBelowThreshold},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 300})
+			useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": tc.cpu}, storage: map[string]float64{"a": tc.storage}})
+
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000, StorageScaleUpThreshold: 80}
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Action != tc.wantAction || result.Reason != tc.wantReason {
+				t.Errorf("got action=%s reason=%s want action=%s reason=%s", result.Action, result.Reason, tc.wantAction, tc.wantReason)
+			}
+			if result.StorageUtilization != tc.storage {
+				t.Errorf("storage utilization got %v want %v", result.StorageUtilization, tc.storage)
+			}
+			evals := result.Diagnostics.Evaluations
+			if len(evals) != 2 || evals[0].Name != evaluatorCPU || evals[1].Name != evaluatorStorage {
+				t.Errorf("evaluations got %+v", evals)
+			}
+		})
+	}
+}
+
+func TestCPUEvaluation_DeadBand(t *testing.T) {
+	config := AutoscalerConfig{ScaleUpThreshold: 60, ScaleDownThreshold: 30, DeadBandPercent: 5}
+	cases := []struct {
+		name string
+		cpu  float64
+		want string
+	}{
+		{"just above scale up threshold", 61, directionNone},
+		{"at the edge of the scale up dead-band", 65, directionNone},
+		{"just outside the scale up dead-band", 65.5, directionUp},
+		{"just below scale down threshold", 29, directionNone},
+		{"at the edge of the scale down dead-band", 25, directionNone},
+		{"just outside the scale down dead-band", 24.5, directionDown},
+		{"between thresholds", 45, directionNone},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := cpuEvaluation(config, tc.cpu).Direction; got != tc.want {
+				t.Errorf("direction got %s want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEvaluate_DeadBandWithAdaptiveThresholds(t *testing.T) {
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 300})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 68}})
+	updateState("projects/p/instances/a", func(s *instanceState) {
+		now := time.Now()
+		for i, action := range []string{actionScaleUp, actionScaleDown, actionScaleUp} {
+			s.History = append(s.History, historyEntry{Time: now.Add(time.Duration(i-3) * time.Minute), Action: action})
+		}
+	})
+
+	// 反転が2回あるため scaleUpThreshold は 60 + 5 に広がり、dead-band はその外側に 5 ポイント取ります。
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000,
+		ScaleUpThreshold: 60, ScaleDownThreshold: 30, DeadBandPercent: 5,
+		AdaptiveThresholds: &AdaptiveThresholds{MaxReversals: 1}}
+	config.applyDefaults()
+	result, err := evaluate(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Action != actionNone || result.ThresholdAdjustment == nil {
+		t.Errorf("got action=%s adjustment=%+v want none inside the widened dead-band", result.Action, result.ThresholdAdjustment)
+	}
+}
+
+func TestEvaluate_ScaleDownRequiresEveryEvaluator(t *testing.T) {
+	cases := []struct {
+		name       string
+		cpu        float64
+		storage    float64
+		wantAction string
+		wantReason string
+		wantVetoes []string
+	}{
+		{"cpu down and storage permits", 10, 50, actionScaleDown, reasonCPUBelowThreshold, nil},
+		// 300 PU から 200 PU に縮めると storage の使用率が 60% から 90% になります。
+		{"cpu down and storage vetoes", 10, 60, actionNone, reasonScaleDownVetoed, []string{evaluatorStorage}},
+		{"cpu down and storage up", 10, 90, actionScaleUp, reasonStorageAboveThreshold, nil},
+		{"cpu normal and storage permits", 40, 10, actionNone, reasonWithinRange, nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 300})
+			useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": tc.cpu}, storage: map[string]float64{"a": tc.storage}})
+
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000, StorageScaleUpThreshold: 80}
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Action != tc.wantAction || result.Reason != tc.wantReason {
+				t.Errorf("got action=%s reason=%s want action=%s reason=%s", result.Action, result.Reason, tc.wantAction, tc.wantReason)
+			}
+			if !reflect.DeepEqual(result.ScaleDownVetoedBy, tc.wantVetoes) {
+				t.Errorf("vetoes got %v want %v", result.ScaleDownVetoedBy, tc.wantVetoes)
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+package spanner
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	instancepb "cloud.google.com/go/spanner/admin/instance/apiv1/instancepb"
+
+	monitoringpb "cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
+	"google.golang.org/api/iterator"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// fakeInstanceAdmin は Spanner Instance Admin API の fake です。
+type fakeInstanceAdmin struct {
+	mu        sync.Mutex
+	instances map[string]*instancepb.Instance
+	getErr    error
+	// listErr を設定すると、ListInstances はインスタンスを返した後にそのエラーを返します。
+	listErr   error
+	updateErr map[string]error
+	updates   []string
+	listCalls int
+	// fieldMasks は UpdateInstance に渡された field mask を順に記録します。
+	fieldMasks [][]string
+
+	// 各呼び出しに渡された context の deadline を記録します。
+	getDeadline  time.Time
+	waitDeadline time.Time
+}
+
+// establishedCreateTime は newInstanceGracePeriod を過ぎたインスタンスの作成時刻です。
+var establishedCreateTime = timestamppb.New(time.Now().Add(-30 * 24 * time.Hour))
+
+func newFakeInstanceAdmin(pus map[string]int32) *fakeInstanceAdmin {
+	f := &fakeInstanceAdmin{
+		instances: make(map[string]*instancepb.Instance),
+		updateErr: make(map[string]error),
+	}
+	for name, pu := range pus {
+		f.instances[name] = &instancepb.Instance{Name: name, ProcessingUnits: pu, CreateTime: establishedCreateTime}
+	}
+	return f
+}
+
+func (f *fakeInstanceAdmin) ListInstances(ctx context.Context, req *instancepb.ListInstancesRequest) instanceIterator {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.listCalls++
+	var names []string
+	for name := range f.instances {
+		if strings.HasPrefix(name, req.GetParent()+"/instances/") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	it := &fakeInstanceIterator{err: f.listErr}
+	for _, name := range names {
+		it.instances = append(it.instances, f.instances[name])
+	}
+	return it
+}
+
+func (f *fakeInstanceAdmin) GetInstance(ctx context.Context, req *instancepb.GetInstanceRequest) (*instancepb.Instance, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.getDeadline, _ = ctx.Deadline()
+	if f.getErr != nil {
+		return nil, f.getErr
+	}
+	instance, ok := f.instances[req.GetName()]
+	if !ok {
+		return nil, fmt.Errorf("instance %s not found", req.GetName())
+	}
+	return instance, nil
+}
+
+func (f *fakeInstanceAdmin) UpdateInstance(ctx context.Context, req *instancepb.UpdateInstanceRequest) (updateInstanceOperation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name := req.GetInstance().GetName()
+	f.updates = append(f.updates, name)
+	f.fieldMasks = append(f.fieldMasks, req.GetFieldMask().GetPaths())
+	if err := f.updateErr[name]; err != nil {
+		return nil, err
+	}
+	instance := f.instances[name]
+	for _, path := range req.GetFieldMask().GetPaths() {
+		switch path {
+		case "processing_units":
+			instance.ProcessingUnits = req.GetInstance().GetProcessingUnits()
+			instance.NodeCount = 0
+		case "node_count":
+			instance.NodeCount = req.GetInstance().GetNodeCount()
+			instance.ProcessingUnits = 0
+		}
+	}
+	return &fakeOperation{admin: f, instance: f.instances[name]}, nil
+}
+
+func (f *fakeInstanceAdmin) Close() error {
+	return nil
+}
+
+func (f *fakeInstanceAdmin) updated() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.updates...)
+}
+
+func (f *fakeInstanceAdmin) processingUnits(name string) int32 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	instance := f.instances[name]
+	if instance.GetProcessingUnits() == 0 {
+		return instance.GetNodeCount() * 1000
+	}
+	return instance.GetProcessingUnits()
+}
+
+type fakeInstanceIterator struct {
+	instances []*instancepb.Instance
+	err       error
+}
+
+func (it *fakeInstanceIterator) Next() (*instancepb.Instance, error) {
+	if len(it.instances) == 0 {
+		if it.err != nil {
+			return nil, it.err
+		}
+		return nil, iterator.Done
+	}
+	instance := it.instances[0]
+	it.instances = it.instances[1:]
+	return instance, nil
+}
+
+// fakeOperation は pollsUntilDone 回目の Poll で完了する UpdateInstance の operation です。
+type fakeOperation struct {
+	admin          *fakeInstanceAdmin
+	instance       *instancepb.Instance
+	pollsUntilDone int
+	polls          int
+}
+
+func (o *fakeOperation) Poll(ctx context.Context) (*instancepb.Instance, error) {
+	if o.admin != nil {
+		o.admin.mu.Lock()
+		o.admin.waitDeadline, _ = ctx.Deadline()
+		o.admin.mu.Unlock()
+	}
+	o.polls++
+	if !o.Done() {
+		return nil, nil
+	}
+	return o.instance, nil
+}
+
+func (o *fakeOperation) Done() bool {
+	return o.polls >= o.pollsUntilDone
+}
+
+// fakeMetricClient は instance ID ごとに固定の CPU 使用率 (%) を返す Cloud Monitoring API の fake です。
+// samples を設定したインスタンスは、新しい順に1分間隔のデータポイントを返します。
+type fakeMetricClient struct {
+	mu      sync.Mutex
+	cpu     map[string]float64
+	samples map[string][]float64
+	// storage は instance ID ごとの storage の使用率 (%) です。
+	storage map[string]float64
+	// latency は instance ID ごとの p99 レイテンシ (ms) です。
+	latency map[string]float64
+	// reads を設定したインスタンスは、CPU 使用率を読み取るたびに先頭から順に1つずつ値を返します。
+	reads map[string][]float64
+	// cpuErr を設定したインスタンスは、CPU 使用率のデータポイントを返した後にそのエラーを返します。
+	cpuErr map[string]error
+
+	listDeadline time.Time
+	// listCalls は ListTimeSeries を呼び出した回数です。
+	listCalls int
+}
+
+var instanceIDFilter = regexp.MustCompile(`resource.labels.instance_id="([^"]*)"`)
+
+func (f *fakeMetricClient) ListTimeSeries(ctx context.Context, req *monitoringpb.ListTimeSeriesRequest) timeSeriesIterator {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.listDeadline, _ = ctx.Deadline()
+	f.listCalls++
+	m := instanceIDFilter.FindStringSubmatch(req.GetFilter())
+	if strings.Contains(req.GetFilter(), storageUtilizationMetric) {
+		storage, ok := f.storage[m[1]]
+		if !ok {
+			return &fakeTimeSeriesIterator{}
+		}
+		return &fakeTimeSeriesIterator{series: []*monitoringpb.TimeSeries{{Points: cpuPoints(time.Now(), []float64{storage})}}}
+	}
+	if strings.Contains(req.GetFilter(), requestLatencyMetric) {
+		latency, ok := f.latency[m[1]]
+		if !ok {
+			return &fakeTimeSeriesIterator{}
+		}
+		// cpuPoints は % を割合に変換するため、秒になるように 10 で割ります。
+		return &fakeTimeSeriesIterator{series: []*monitoringpb.TimeSeries{{Points: cpuPoints(time.Now(), []float64{latency / 10})}}}
+	}
+	if reads := f.reads[m[1]]; len(reads) > 0 {
+		f.reads[m[1]] = reads[1:]
+		return &fakeTimeSeriesIterator{series: []*monitoringpb.TimeSeries{{Points: cpuPoints(time.Now(), reads[:1])}}}
+	}
+	samples, ok := f.samples[m[1]]
+	if !ok {
+		cpu, ok := f.cpu[m[1]]
+		if !ok {
+			return &fakeTimeSeriesIterator{}
+		}
+		samples = []float64{cpu}
+	}
+	return &fakeTimeSeriesIterator{series: []*monitoringpb.TimeSeries{{Points: cpuPoints(time.Now(), samples)}}, err: f.cpuErr[m[1]]}
+}
+
+// cpuPoints は now から1分間隔で遡る CPU 使用率 (%) のデータポイントを返します。
+func cpuPoints(now time.Time, samples []float64) []*monitoringpb.Point {
+	points := make([]*monitoringpb.Point, 0, len(samples))
+	for i, cpu := range samples {
+		points = append(points, &monitoringpb.Point{
+			Interval: &monitoringpb.TimeInterval{EndTime: timestamppb.New(now.Add(-time.Duration(i) * time.Minute))},
+			Value:    &monitoringpb.TypedValue{Value: &monitoringpb.TypedValue_DoubleValue{DoubleValue: cpu / 100}},
+		})
+	}
+	return points
+}
+
+func (f *fakeMetricClient) Close() error {
+	return nil
+}
+
+type fakeTimeSeriesIterator struct {
+	series []*monitoringpb.TimeSeries
+	err    error
+}
+
+func (it *fakeTimeSeriesIterator) Next() (*monitoringpb.TimeSeries, error) {
+	if len(it.series) == 0 {
+		if it.err != nil {
+			return nil, it.err
+		}
+		return nil, iterator.Done
+	}
+	ts := it.series[0]
+	it.series = it.series[1:]
+	return ts, nil
+}
+
+// useFakes は API クライアントを fake に差し替え、テスト終了時にパッケージの状態を元に戻します。
+func useFakes(t *testing.T, admin *fakeInstanceAdmin, metrics *fakeMetricClient) {
+	t.Helper()
+	origAdmin, origMetric := newInstanceAdminClient, newMetricClient
+	newInstanceAdminClient = func(ctx context.Context) (instanceAdminClient, error) { return admin, nil }
+	newMetricClient = func(ctx context.Context) (metricClient, error) { return metrics, nil }
+	resetState()
+	t.Cleanup(func() {
+		newInstanceAdminClient, newMetricClient = origAdmin, origMetric
+		resetState()
+	})
+}
+
+func resetState() {
+	stateStore.Lock()
+	stateStore.m = make(map[string]*instanceState)
+	stateStore.Unlock()
+}
+
+// fakeQueryClient は固定の結果を返す MQL クエリの fake です。
+type fakeQueryClient struct {
+	series []*monitoringpb.TimeSeriesData
+	query  string
+}
+
+func (f *fakeQueryClient) QueryTimeSeries(ctx context.Context, req *monitoringpb.QueryTimeSeriesRequest) timeSeriesDataIterator {
+	f.query = req.GetQuery()
+	return &fakeTimeSeriesDataIterator{series: append([]*monitoringpb.TimeSeriesData(nil), f.series...)}
+}
+
+func (f *fakeQueryClient) Close() error {
+	return nil
+}
+
+type fakeTimeSeriesDataIterator struct {
+	series []*monitoringpb.TimeSeriesData
+}
+
+func (it *fakeTimeSeriesDataIterator) Next() (*monitoringpb.TimeSeriesData, error) {
+	if len(it.series) == 0 {
+		return nil, iterator.Done
+	}
+	ts := it.series[0]
+	it.series = it.series[1:]
+	return ts, nil
+}
+
+func useFakeQuery(t *testing.T, q *fakeQueryClient) {
+	t.Helper()
+	orig := newQueryClient
+	newQueryClient = func(ctx context.Context) (queryClient, error) { return q, nil }
+	t.Cleanup(func() { newQueryClient = orig })
+}
@@ -0,0 +1,181 @@
+package spanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	instancepb "cloud.google.com/go/spanner/admin/instance/apiv1/instancepb"
+	"google.golang.org/api/iterator"
+)
+
+const reasonFleetCapReached = "fleet_cap_reached"
+
+// FleetCap limits the total processing units of every instance the autoscaler manages,
+// e.g. to stay within a Spanner PU quota or budget shared by the fleet.
+type FleetCap struct {
+	// MaxPU はすべてのインスタンスの PU の合計の上限です。
+	MaxPU int `json:"maxPU"`
+	// ExemptPanic を有効にすると、panicCPUThreshold によるパニックスケールアップは上限を超えても行います。
+	ExemptPanic bool `json:"exemptPanic"`
+	// Projects は fleet に含める project です。その project のすべてのインスタンスの PU を合計します。省略した場合は project だけです。
+	Projects []string `json:"projects"`
+	// Instances を指定すると、"project/instance" で指定したインスタンスだけを fleet とし、projects は使いません。
+	Instances []string `json:"instances"`
+}
+
+func (f *FleetCap) applyDefaults(project string) {
+	if len(f.Projects) == 0 && len(f.Instances) == 0 {
+		f.Projects = []string{project}
+	}
+}
+
+func (f *FleetCap) validate() error {
+	if f.MaxPU <= 0 {
+		return errors.New("Invalid fleetCap.maxPU.")
+	}
+	for _, name := range f.Instances {
+		if project, instance, ok := strings.Cut(name, "/"); !ok || project == "" || instance == "" || strings.Contains(instance, "/") {
+			return fmt.Errorf("Invalid fleetCap.instances %q. Use project/instance.", name)
+		}
+	}
+	return nil
+}
+
+// fleetProcessingUnits は ListInstances で取得した、exclude 以外の fleet のインスタンスの現在の PU の合計を返します。
+// ListInstances に失敗した project や、instances に指定したのに見つからないインスタンスは unknown として返します。
+func fleetProcessingUnits(ctx context.Context, f *FleetCap, exclude string) (int32, []string) {
+	projects := f.Projects
+	if len(f.Instances) > 0 {
+		projects = nil
+		seen := make(map[string]bool)
+		for _, name := range f.Instances {
+			project, _, _ := strings.Cut(name, "/")
+			if !seen[project] {
+				seen[project] = true
+				projects = append(projects, project)
+			}
+		}
+	}
+
+	pus := make(map[string]int32)
+	failed := make(map[string]bool)
+	var unknown []string
+	for _, project := range projects {
+		if err := listProcessingUnits(ctx, project, pus); err != nil {
+			logf(ctx, "Failed to list instances in project %s for the fleet cap: %v", project, err)
+			failed[project] = true
+			if len(f.Instances) == 0 {
+				unknown = append(unknown, project)
+			}
+		}
+	}
+
+	var total int32
+	if len(f.Instances) == 0 {
+		for name, pu := range pus {
+			if name != exclude {
+				total += pu
+			}
+		}
+		return total, unknown
+	}
+	for _, member := range f.Instances {
+		project, instance, _ := strings.Cut(member, "/")
+		name := fmt.Sprintf("projects/%s/instances/%s", project, instance)
+		if name == exclude {
+			continue
+		}
+		pu, ok := pus[name]
+		if !ok || failed[project] {
+			unknown = append(unknown, member)
+			continue
+		}
+		total += pu
+	}
+	sort.Strings(unknown)
+	return total, unknown
+}
+
+// listProcessingUnits は project のすべてのインスタンスの現在の PU を pus に追加します。
+func listProcessingUnits(ctx context.Context, project string, pus map[string]int32) error {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout())
+	defer cancel()
+
+	instanceAdminClient, err := newInstanceAdminClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create spanner instance admin client: %w", err)
+	}
+	defer instanceAdminClient.Close()
+
+	it := instanceAdminClient.ListInstances(ctx, &instancepb.ListInstancesRequest{Parent: "projects/" + project})
+	for {
+		instance, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to list instances: %w", err)
+		}
+		pus[instance.GetName()] = capacityOf(instance).ProcessingUnits
+	}
+}
+
+// clampToFleetCap はスケールアップによって fleet 全体の PU の合計が fleetCap.maxPU を超える場合、
+// 上限に収まる有効な PU まで小さくします。現在の PU より大きくできない場合はスケールアップしません。
+// fleet のインスタンスの PU を取得できない場合は、上限を確認できないためスケールアップしません。
+// apply では recheck を true にして呼び出し、評価の後に他のインスタンスがリサイズした分も反映します。
+// 評価で既に制限した結果は確認し直さず、上限に収まったままの場合は trace に同じ確認を繰り返し記録しません。
+func clampToFleetCap(ctx context.Context, config AutoscalerConfig, result *ScaleResult, recheck bool) {
+	f := config.FleetCap
+	if f == nil || result.Action != actionScaleUp || (recheck && result.FleetCapped) {
+		return
+	}
+	if f.ExemptPanic && result.panicked {
+		if !recheck {
+			result.trace("fleet_cap", tracePass, map[string]any{"exemptPanic": true})
+		}
+		return
+	}
+	others, unknown := fleetProcessingUnits(ctx, f, result.instanceName)
+	result.Diagnostics.FleetPU = others + result.CurrentPU
+	result.Diagnostics.FleetUnknown = unknown
+	inputs := map[string]any{"fleetPU": result.Diagnostics.FleetPU, "maxPU": f.MaxPU, "newPU": result.NewPU, "unknown": unknown}
+	if len(unknown) > 0 {
+		result.trace("fleet_cap", traceStop, inputs)
+		logf(ctx, "Skipping scale up of %s because the processing units of fleet members %v are unknown.", result.label(), unknown)
+		result.FleetCapped = true
+		result.Action = actionNone
+		result.NewPU = result.CurrentPU
+		result.Reason = reasonFleetCapReached
+		result.Message = fmt.Sprintf("Skipping scale up because the fleet total cannot be checked against the fleet cap of %d PUs: %s is unknown.", f.MaxPU, strings.Join(unknown, ", "))
+		return
+	}
+	allowed := int32(f.MaxPU) - others
+	if result.NewPU <= allowed {
+		if !recheck {
+			result.trace("fleet_cap", tracePass, inputs)
+		}
+		return
+	}
+	newPU := roundDownProcessingUnits(allowed)
+	if len(config.SizeLadder) > 0 {
+		newPU = config.ladderFloor(newPU)
+	}
+	result.FleetCapped = true
+	result.Reason = reasonFleetCapReached
+	if newPU <= result.CurrentPU {
+		result.trace("fleet_cap", traceStop, inputs)
+		logf(ctx, "Skipping scale up of %s because the fleet already has %d of %d PUs.", result.label(), result.Diagnostics.FleetPU, f.MaxPU)
+		result.Action = actionNone
+		result.NewPU = result.CurrentPU
+		result.Message = fmt.Sprintf("Skipping scale up because the fleet total of %d PUs is at the fleet cap of %d PUs.", result.Diagnostics.FleetPU, f.MaxPU)
+		return
+	}
+	result.trace("fleet_cap", traceClamped, inputs)
+	logf(ctx, "Fleet cap limited the scale up of %s from %d to %d PUs.", result.label(), result.NewPU, newPU)
+	result.NewPU = newPU
+	result.Message = fmt.Sprintf("Scaled up to %d PUs (limited by the fleet cap of %d PUs).", newPU, f.MaxPU)
+}
@@ -0,0 +1,214 @@
+package spanner
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEvaluate_FleetCap(t *testing.T) {
+	cases := []struct {
+		name        string
+		maxPU       int
+		panic       bool
+		exemptPanic bool
+		wantAction  string
+		wantNewPU   int32
+		wantReason  string
+		wantCapped  bool
+	}{
+		{"within the cap", 3000, false, false, actionScaleUp, 800, reasonCPUAboveThreshold, false},
+		{"reduced to fit the cap", 2700, false, false, actionScaleUp, 700, reasonFleetCapReached, true},
+		{"refused at the cap", 2500, false, false, actionNone, 500, reasonFleetCapReached, true},
+		{"panic limited by the cap", 2700, true, false, actionScaleUp, 700, reasonFleetCapReached, true},
+		{"panic exempt from the cap", 2500, true, true, actionScaleUp, 1000, reasonPanicThreshold, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// 状態には他のインスタンスがなく、b が 2000 PU を使っていることは ListInstances でだけ分かります。
+			admin := newFakeInstanceAdmin(map[string]int32{
+				"projects/p/instances/a": 500,
+				"projects/p/instances/b": 2000,
+			})
+			useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90}})
+			received := useFakeWebhook(t)
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 300, PUMin: 100, PUMax: 1000, FleetCap: &FleetCap{MaxPU: tc.maxPU, ExemptPanic: tc.exemptPanic}}
+			if tc.panic {
+				config.PanicCPUThreshold = 80
+			}
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := apply(context.Background(), result); err != nil {
+				t.Fatal(err)
+			}
+			if result.Action != tc.wantAction || result.NewPU != tc.wantNewPU || result.Reason != tc.wantReason {
+				t.Errorf("got action=%s newPU=%d reason=%s want action=%s newPU=%d reason=%s", result.Action, result.NewPU, result.Reason, tc.wantAction, tc.wantNewPU, tc.wantReason)
+			}
+			if got := admin.processingUnits("projects/p/instances/a"); got != tc.wantNewPU {
+				t.Errorf("instance has %d PUs want %d", got, tc.wantNewPU)
+			}
+			if result.FleetCapped != tc.wantCapped {
+				t.Errorf("fleetCapped got %v want %v", result.FleetCapped, tc.wantCapped)
+			}
+			var warnings int
+			for _, n := range received() {
+				if n.Severity == severityWarning && n.Reason == reasonFleetCapReached {
+					warnings++
+				}
+			}
+			if wantWarnings := map[bool]int{true: 1}[tc.wantCapped]; warnings != wantWarnings {
+				t.Errorf("got %d fleet cap notifications want %d", warnings, wantWarnings)
+			}
+		})
+	}
+}
+
+// 依存グループはすべて評価してから適用するため、先に適用したインスタンスの分を適用時に反映します。
+func TestProcessBatch_FleetCapRecheckedOnApply(t *testing.T) {
+	admin := newFakeInstanceAdmin(map[string]int32{
+		"projects/p/instances/a": 500,
+		"projects/p/instances/b": 500,
+	})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90, "b": 90}})
+	var instances []AutoscalerConfig
+	for _, id := range []string{"a", "b"} {
+		c := AutoscalerConfig{Project: "p", Instance: id, PUStep: 500, PUMin: 100, PUMax: 1000, FleetCap: &FleetCap{MaxPU: 1600}}
+		c.applyDefaults()
+		instances = append(instances, c)
+	}
+	result := processBatch(context.Background(), BatchConfig{
+		Instances:        instances,
+		DependencyGroups: []DependencyGroup{{Name: "g", Order: []string{"a", "b"}}},
+	})
+	a, b := result.Results[0], result.Results[1]
+	if a.NewPU != 1000 || a.FleetCapped {
+		t.Errorf("a got newPU=%d fleetCapped=%v want 1000 within the cap", a.NewPU, a.FleetCapped)
+	}
+	if b.Action != actionScaleUp || b.NewPU != 600 || b.Reason != reasonFleetCapReached {
+		t.Errorf("b got action=%s newPU=%d reason=%s want a scale up limited to 600", b.Action, b.NewPU, b.Reason)
+	}
+	if total, unknown := fleetProcessingUnits(context.Background(), instances[0].FleetCap, ""); total != 1600 || len(unknown) != 0 {
+		t.Errorf("fleet total got %d, unknown %v want 1600", total, unknown)
+	}
+}
+
+func TestEvaluate_FleetCapUnknownMembers(t *testing.T) {
+	cases := []struct {
+		name        string
+		fleetCap    FleetCap
+		listErr     error
+		wantUnknown []string
+	}{
+		{"missing instance", FleetCap{MaxPU: 10000, Instances: []string{"p/a", "p/b", "p/gone"}}, nil, []string{"p/gone"}},
+		{"project list failure", FleetCap{MaxPU: 10000, Projects: []string{"p", "q"}}, errors.New("list failed"), []string{"p", "q"}},
+		{"instances in a failed project", FleetCap{MaxPU: 10000, Instances: []string{"p/a", "p/b"}}, errors.New("list failed"), []string{"p/b"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := newFakeInstanceAdmin(map[string]int32{
+				"projects/p/instances/a": 500,
+				"projects/p/instances/b": 500,
+			})
+			admin.listErr = tc.listErr
+			useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90}})
+			fleetCap := tc.fleetCap
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 300, PUMin: 100, PUMax: 1000, FleetCap: &fleetCap}
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Action != actionNone || result.NewPU != 500 || result.Reason != reasonFleetCapReached || !result.FleetCapped {
+				t.Errorf("got action=%s newPU=%d reason=%s fleetCapped=%v want a refused scale up", result.Action, result.NewPU, result.Reason, result.FleetCapped)
+			}
+			if !reflect.DeepEqual(result.Diagnostics.FleetUnknown, tc.wantUnknown) {
+				t.Errorf("fleetUnknown got %v want %v", result.Diagnostics.FleetUnknown, tc.wantUnknown)
+			}
+		})
+	}
+}
+
+func TestFleetCap_Validate(t *testing.T) {
+	for _, name := range []string{"a", "p/", "/a", "p/a/b"} {
+		f := FleetCap{MaxPU: 1000, Instances: []string{name}}
+		if err := f.validate(); err == nil {
+			t.Errorf("%q: got nil want an error", name)
+		}
+	}
+}
+
+func TestApply_FleetCapRecheck(t *testing.T) {
+	cases := []struct {
+		name          string
+		maxPU         int
+		wantListCalls int
+		wantNewPU     int32
+	}{
+		// 評価で制限した結果は apply で確認し直しません。
+		{"capped on evaluate", 2700, 1, 700},
+		// 上限に収まっていた結果は apply で確認し直しますが、trace には1回だけ記録します。
+		{"within the cap", 3000, 2, 800},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := newFakeInstanceAdmin(map[string]int32{
+				"projects/p/instances/a": 500,
+				"projects/p/instances/b": 2000,
+			})
+			useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90}})
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 300, PUMin: 100, PUMax: 1000, Trace: true, FleetCap: &FleetCap{MaxPU: tc.maxPU}}
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := apply(context.Background(), result); err != nil {
+				t.Fatal(err)
+			}
+			if admin.listCalls != tc.wantListCalls {
+				t.Errorf("ListInstances called %d times want %d", admin.listCalls, tc.wantListCalls)
+			}
+			if result.NewPU != tc.wantNewPU {
+				t.Errorf("newPU got %d want %d", result.NewPU, tc.wantNewPU)
+			}
+			var steps int
+			for _, s := range result.Trace {
+				if s.Rule == "fleet_cap" {
+					steps++
+				}
+			}
+			if steps != 1 {
+				t.Errorf("got %d fleet_cap trace steps want 1", steps)
+			}
+		})
+	}
+}
+
+func TestHandler_FleetCapAuthorization(t *testing.T) {
+	t.Setenv("AUTHORIZED_CALLERS", `{"p": ["ops"]}`)
+	useFakeIDTokens(t, map[string]string{"ops-token": "scaler@ops.iam.gserviceaccount.com"})
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 500, "projects/other/instances/x": 2000})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90}})
+
+	// fleetCap で指定した他の project の PU の合計も返すため、その project の認可も必要です。
+	for _, fleetCap := range []string{`{"maxPU": 3000, "projects": ["p", "other"]}`, `{"maxPU": 3000, "instances": ["other/x"]}`} {
+		body := `{"project": "p", "instance": "a", "puStep": 100, "puMin": 100, "puMax": 1000, "fleetCap": ` + fleetCap + `}`
+		req := httptest.NewRequest(http.MethodPost, "/spanner/autoscaler", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer ops-token")
+		rr := httptest.NewRecorder()
+		Handler(rr, req)
+		if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "project other") {
+			t.Errorf("%s: got %d %s want 403 for project other", fleetCap, rr.Code, rr.Body.String())
+		}
+	}
+	if got := admin.updated(); len(got) != 0 {
+		t.Errorf("updated %v want none", got)
+	}
+}
@@ -0,0 +1,43 @@
+package spanner
+
+import "errors"
+
+const evaluatorLatency = "latency"
+
+// ScaleDownGate requires every enabled signal to be at a safe level before scaling down.
+// CPU usage must be below scaleDownThreshold as usual; any other signal at or above
+// its safe threshold vetoes the scale-down.
+type ScaleDownGate struct {
+	// StorageSafeThreshold を指定すると、storage の使用率 (%) がこれ未満でなければスケールダウンしません。
+	StorageSafeThreshold float64 `json:"storageSafeThreshold"`
+	// LatencySafeThresholdMs を指定すると、API リクエストの p99 レイテンシ (ms) がこれ未満でなければスケールダウンしません。
+	LatencySafeThresholdMs float64 `json:"latencySafeThresholdMs"`
+}
+
+func (g *ScaleDownGate) validate() error {
+	if g.StorageSafeThreshold < 0 || g.LatencySafeThresholdMs < 0 {
+		return errors.New("Invalid scaleDownGate.")
+	}
+	return nil
+}
+
+// readsStorage は storage の使用率を読み取る必要があるかどうかです。
+func (c *AutoscalerConfig) readsStorage() bool {
+	return c.StorageScaleUpThreshold > 0 || (c.ScaleDownGate != nil && c.ScaleDownGate.StorageSafeThreshold > 0)
+}
+
+// readsLatency はレイテンシを読み取る必要があるかどうかです。
+func (c *AutoscalerConfig) readsLatency() bool {
+	return c.ScaleDownGate != nil && c.ScaleDownGate.LatencySafeThresholdMs > 0
+}
+
+// latencyEvaluation は p99 レイテンシが LatencySafeThresholdMs 未満の場合だけスケールダウンを許可します。
+// レイテンシはスケーリングの理由にはしません。
+func latencyEvaluation(config AutoscalerConfig, latencyMs float64) Evaluation {
+	return Evaluation{
+		Name:        evaluatorLatency,
+		Value:       latencyMs,
+		Direction:   directionNone,
+		PermitsDown: latencyMs < config.ScaleDownGate.LatencySafeThresholdMs,
+	}
+}
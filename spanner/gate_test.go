@@ -0,0 +1,75 @@
+package spanner
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEvaluate_ScaleDownGate(t *testing.T) {
+	cases := []struct {
+		name       string
+		cpu        float64
+		storage    float64
+		latencyMs  float64
+		wantAction string
+		wantReason string
+		wantVetoes []string
+	}{
+		{"every signal is safe", 10, 20, 5, actionScaleDown, reasonCPUBelowThreshold, nil},
+		{"cpu is not low", 40, 20, 5, actionNone, reasonWithinRange, nil},
+		{"storage vetoes", 10, 50, 5, actionNone, reasonScaleDownVetoed, []string{evaluatorStorage}},
+		{"latency vetoes", 10, 20, 25, actionNone, reasonScaleDownVetoed, []string{evaluatorLatency}},
+		{"storage and latency veto", 10, 50, 25, actionNone, reasonScaleDownVetoed, []string{evaluatorStorage, evaluatorLatency}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 300})
+			useFakes(t, admin, &fakeMetricClient{
+				cpu:     map[string]float64{"a": tc.cpu},
+				storage: map[string]float64{"a": tc.storage},
+				latency: map[string]float64{"a": tc.latencyMs},
+			})
+
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000,
+				ScaleDownGate: &ScaleDownGate{StorageSafeThreshold: 40, LatencySafeThresholdMs: 20}}
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Action != tc.wantAction || result.Reason != tc.wantReason {
+				t.Errorf("got action=%s reason=%s want action=%s reason=%s", result.Action, result.Reason, tc.wantAction, tc.wantReason)
+			}
+			if !reflect.DeepEqual(result.ScaleDownVetoedBy, tc.wantVetoes) {
+				t.Errorf("vetoes got %v want %v", result.ScaleDownVetoedBy, tc.wantVetoes)
+			}
+			for _, v := range tc.wantVetoes {
+				if !strings.Contains(result.Message, v) {
+					t.Errorf("message %q does not name %s", result.Message, v)
+				}
+			}
+			if result.LatencyMs != tc.latencyMs {
+				t.Errorf("latencyMs got %v want %v", result.LatencyMs, tc.latencyMs)
+			}
+		})
+	}
+}
+
+func TestEvaluate_ScaleDownGateWithoutLatencyData(t *testing.T) {
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 300})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 10}})
+
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000,
+		ScaleDownGate: &ScaleDownGate{LatencySafeThresholdMs: 20}}
+	config.applyDefaults()
+	result, err := evaluate(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// リクエストがなければレイテンシはスケールダウンを妨げません。
+	if result.Action != actionScaleDown {
+		t.Errorf("got action=%s reason=%s want scale_down", result.Action, result.Reason)
+	}
+}
@@ -0,0 +1,119 @@
+package spanner
+
+import (
+	"encoding/csv"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// historyFlushRows ごとにレスポンスを flush し、長い history でも全体をバッファしないようにします。
+const historyFlushRows = 500
+
+var historyCSVHeader = []string{"timestamp", "instance", "cpu", "action", "previous_pu", "new_pu", "reason"}
+
+// HistoryHandler streams the decision history of the instances in a project as CSV.
+// project is required, instance filters the instances, and from and to (RFC 3339) filter the time range.
+func HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	r = withRequestID(w, r)
+	q := r.URL.Query()
+	var from, to time.Time
+	for _, p := range []struct {
+		key string
+		t   *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		v := q.Get(p.key)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "Invalid "+p.key+".", http.StatusBadRequest)
+			return
+		}
+		*p.t = t
+	}
+	project, allowlist, ok := authorizeProjectQuery(w, r)
+	if !ok {
+		return
+	}
+	instance := q.Get("instance")
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="autoscaler-history.csv"`)
+	flusher, _ := w.(http.Flusher)
+	cw := csv.NewWriter(w)
+	cw.Write(historyCSVHeader)
+
+	names := stateInstanceNames()
+	sort.Strings(names)
+	rows := 0
+	for _, name := range names {
+		if !matchesInstance(name, project, instance) || !allowedName(allowlist, name) {
+			continue
+		}
+		for _, e := range loadState(name).History {
+			if (!from.IsZero() && e.Time.Before(from)) || (!to.IsZero() && !e.Time.Before(to)) {
+				continue
+			}
+			cw.Write([]string{
+				e.Time.UTC().Format(time.RFC3339),
+				name,
+				strconv.FormatFloat(e.CPUUsage, 'f', 2, 64),
+				e.Action,
+				strconv.Itoa(int(e.CurrentPU)),
+				strconv.Itoa(int(e.NewPU)),
+				e.Reason,
+			})
+			if rows++; rows%historyFlushRows == 0 {
+				cw.Flush()
+				if flusher != nil {
+					flusher.Flush()
+				}
+			}
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		logf(r.Context(), "Failed to write history response: %v", err)
+	}
+}
+
+// matchesInstance は "projects/<project>/instances/<instance>" 形式の name が project と instance に一致するかを返します。
+// 空の条件はすべてに一致します。
+func matchesInstance(name, project, instance string) bool {
+	p, i, ok := strings.Cut(strings.TrimPrefix(name, "projects/"), "/instances/")
+	if !ok {
+		return false
+	}
+	return (project == "" || p == project) && (instance == "" || i == instance)
+}
+
+// authorizeProjectQuery は query の project を必須とし、呼び出し元がその project の履歴を参照してよいかを確認します。
+// 参照できない場合はエラーのレスポンスを書き込み、ok に false を返します。
+func authorizeProjectQuery(w http.ResponseWriter, r *http.Request) (project string, allowlist *instanceAllowlist, ok bool) {
+	project = r.URL.Query().Get("project")
+	if project == "" {
+		http.Error(w, "Missing project.", http.StatusBadRequest)
+		return "", nil, false
+	}
+	if err := authorizeCaller(r, project); err != nil {
+		http.Error(w, err.message, err.status)
+		return "", nil, false
+	}
+	allowlist, err := loadInstanceAllowlist()
+	if err != nil {
+		logf(r.Context(), "Failed to load the instance allowlist: %v", err)
+		http.Error(w, "Invalid allowlist configuration.", http.StatusInternalServerError)
+		return "", nil, false
+	}
+	return project, allowlist, true
+}
+
+// allowedName は "projects/<project>/instances/<instance>" 形式の name が allowlist に含まれるかを返します。
+func allowedName(allowlist *instanceAllowlist, name string) bool {
+	p, i, ok := strings.Cut(strings.TrimPrefix(name, "projects/"), "/instances/")
+	return ok && allowlist.allows(p, i)
+}
@@ -0,0 +1,141 @@
+package spanner
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHistoryHandler(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	entry := func(hours int, cpu float64, current, next int32, action, reason string) historyEntry {
+		return historyEntry{Time: base.Add(time.Duration(hours) * time.Hour), CPUUsage: cpu, CurrentPU: current, NewPU: next, Action: action, Reason: reason}
+	}
+	updateState("projects/p/instances/a", func(s *instanceState) {
+		s.History = []historyEntry{
+			entry(0, 72.5, 100, 200, actionScaleUp, reasonCPUAboveThreshold),
+			entry(1, 40, 200, 200, actionNone, reasonWithinRange),
+			entry(2, 10, 200, 100, actionScaleDown, reasonCPUBelowThreshold),
+		}
+	})
+	updateState("projects/q/instances/b", func(s *instanceState) {
+		s.History = []historyEntry{entry(1, 55, 300, 400, actionScaleUp, reasonCPUAboveThreshold)}
+	})
+
+	cases := []struct {
+		name  string
+		query string
+		want  [][]string
+	}{
+		{"by project", "?project=p", [][]string{
+			{"2026-01-01T00:00:00Z", "projects/p/instances/a", "72.50", "scale_up", "100", "200", "cpu_above_threshold"},
+			{"2026-01-01T01:00:00Z", "projects/p/instances/a", "40.00", "none", "200", "200", "within_range"},
+			{"2026-01-01T02:00:00Z", "projects/p/instances/a", "10.00", "scale_down", "200", "100", "cpu_below_threshold"},
+		}},
+		{"by instance", "?project=q&instance=b", [][]string{
+			{"2026-01-01T01:00:00Z", "projects/q/instances/b", "55.00", "scale_up", "300", "400", "cpu_above_threshold"},
+		}},
+		{"by time range", "?project=p&instance=a&from=2026-01-01T01:00:00Z&to=2026-01-01T02:00:00Z", [][]string{
+			{"2026-01-01T01:00:00Z", "projects/p/instances/a", "40.00", "none", "200", "200", "within_range"},
+		}},
+		{"no match", "?project=p&instance=c", nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			HistoryHandler(rr, httptest.NewRequest(http.MethodGet, "/spanner/autoscaler/history"+tc.query, nil))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("status got %d: %s", rr.Code, rr.Body.String())
+			}
+			if got := rr.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+				t.Errorf("content type got %q", got)
+			}
+			records, err := csv.NewReader(rr.Body).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(records[0], historyCSVHeader) {
+				t.Errorf("header got %v want %v", records[0], historyCSVHeader)
+			}
+			if got := records[1:]; !reflect.DeepEqual(got, tc.want) && !(len(got) == 0 && tc.want == nil) {
+				t.Errorf("rows got %v want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHistoryHandler_InvalidTime(t *testing.T) {
+	rr := httptest.NewRecorder()
+	HistoryHandler(rr, httptest.NewRequest(http.MethodGet, "/spanner/autoscaler/history?project=p&from=yesterday", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status got %d want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHistoryHandler_MissingProject(t *testing.T) {
+	rr := httptest.NewRecorder()
+	HistoryHandler(rr, httptest.NewRequest(http.MethodGet, "/spanner/autoscaler/history", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status got %d want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHistoryHandler_AuthorizeCaller(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+	t.Setenv("AUTHORIZED_CALLERS", `{"p": ["ops"]}`)
+	useFakeIDTokens(t, map[string]string{"ops-token": "scaler@ops.iam.gserviceaccount.com"})
+	updateState("projects/q/instances/b", func(s *instanceState) {
+		s.History = []historyEntry{{Time: time.Now(), Action: actionNone, Reason: reasonWithinRange}}
+	})
+
+	cases := []struct {
+		name  string
+		query string
+		token string
+		want  int
+	}{
+		{"authorized project", "?project=p", "ops-token", http.StatusOK},
+		{"other project", "?project=q", "ops-token", http.StatusForbidden},
+		{"missing token", "?project=p", "", http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/spanner/autoscaler/history"+tc.query, nil)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			rr := httptest.NewRecorder()
+			HistoryHandler(rr, req)
+			if rr.Code != tc.want {
+				t.Errorf("status got %d want %d: %s", rr.Code, tc.want, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHistoryHandler_InstanceAllowlist(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+	t.Setenv("ALLOWED_INSTANCES", "p/a")
+	for _, name := range []string{"projects/p/instances/a", "projects/p/instances/b"} {
+		updateState(name, func(s *instanceState) {
+			s.History = []historyEntry{{Time: time.Now(), Action: actionNone, Reason: reasonWithinRange}}
+		})
+	}
+	rr := httptest.NewRecorder()
+	HistoryHandler(rr, httptest.NewRequest(http.MethodGet, "/spanner/autoscaler/history?project=p", nil))
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[1][1] != "projects/p/instances/a" {
+		t.Errorf("rows got %v want only projects/p/instances/a", records[1:])
+	}
+}
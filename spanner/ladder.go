@@ -0,0 +1,39 @@
+package spanner
+
+import (
+	"errors"
+	"fmt"
+)
+
+// validateSizeLadder は SizeLadder が昇順で、各値が Spanner の受け付ける PU であることを確認します。
+func (c *AutoscalerConfig) validateSizeLadder() error {
+	for i, pu := range c.SizeLadder {
+		if pu <= 0 || roundUpProcessingUnits(pu) != pu {
+			return fmt.Errorf("Invalid sizeLadder. %d is not a valid processing units.", pu)
+		}
+		if i > 0 && pu <= c.SizeLadder[i-1] {
+			return errors.New("Invalid sizeLadder. It must be sorted in ascending order without duplicates.")
+		}
+	}
+	return nil
+}
+
+// ladderCeil は SizeLadder のうち pu 以上で最小の段を返します。pu が最上段より大きい場合は最上段を返します。
+func (c *AutoscalerConfig) ladderCeil(pu int32) int32 {
+	for _, rung := range c.SizeLadder {
+		if rung >= pu {
+			return rung
+		}
+	}
+	return c.SizeLadder[len(c.SizeLadder)-1]
+}
+
+// ladderFloor は SizeLadder のうち pu 以下で最大の段を返します。pu が最下段より小さい場合は最下段を返します。
+func (c *AutoscalerConfig) ladderFloor(pu int32) int32 {
+	for i := len(c.SizeLadder) - 1; i >= 0; i-- {
+		if c.SizeLadder[i] <= pu {
+			return c.SizeLadder[i]
+		}
+	}
+	return c.SizeLadder[0]
+}
@@ -0,0 +1,96 @@
+package spanner
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAutoscalerConfig_StepSizeLadder(t *testing.T) {
+	config := AutoscalerConfig{PUStep: 100, ProportionalStep: true, SizeLadder: []int32{100, 300, 600, 1000, 2000}}
+	config.applyDefaults()
+	cases := []struct {
+		name      string
+		currentPU int32
+		wantUp    int32
+		wantDown  int32
+	}{
+		{"bottom rung", 100, 300, 100},
+		{"middle rung", 600, 1000, 300},
+		{"top rung", 2000, 2000, 1000},
+		{"between rungs", 400, 600, 300},
+		{"above ladder", 5000, 2000, 2000},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := config.stepUp(tc.currentPU); got != tc.wantUp {
+				t.Errorf("stepUp(%d) got %d want %d", tc.currentPU, got, tc.wantUp)
+			}
+			if got := config.stepDown(tc.currentPU); got != tc.wantDown {
+				t.Errorf("stepDown(%d) got %d want %d", tc.currentPU, got, tc.wantDown)
+			}
+		})
+	}
+}
+
+func TestEvaluate_SizeLadder(t *testing.T) {
+	const name = "projects/p/instances/a"
+	admin := newFakeInstanceAdmin(map[string]int32{name: 100})
+	metrics := &fakeMetricClient{cpu: map[string]float64{"a": 90}}
+	useFakes(t, admin, metrics)
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUMin: 100, PUMax: 5000, SizeLadder: []int32{100, 300, 600, 1000, 2000}}
+	config.applyDefaults()
+	run := func() *ScaleResult {
+		t.Helper()
+		result, err := evaluate(context.Background(), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := apply(context.Background(), result); err != nil {
+			t.Fatal(err)
+		}
+		// cooldown を待たずに次の段を確認します。
+		updateState(name, func(s *instanceState) { s.LastResized = time.Time{} })
+		return result
+	}
+
+	for _, want := range []int32{300, 600, 1000, 2000} {
+		if result := run(); result.Action != actionScaleUp || result.NewPU != want {
+			t.Errorf("scale up got action=%s newPU=%d want %d", result.Action, result.NewPU, want)
+		}
+	}
+	if result := run(); result.Action != actionNone || result.Reason != reasonAtMaxPU {
+		t.Errorf("at top rung got action=%s reason=%s newPU=%d", result.Action, result.Reason, result.NewPU)
+	}
+
+	metrics.cpu["a"] = 10
+	for _, want := range []int32{1000, 600, 300, 100} {
+		if result := run(); result.Action != actionScaleDown || result.NewPU != want {
+			t.Errorf("scale down got action=%s newPU=%d want %d", result.Action, result.NewPU, want)
+		}
+	}
+}
+
+func TestAutoscalerConfig_ValidateSizeLadder(t *testing.T) {
+	cases := []struct {
+		name    string
+		ladder  []int32
+		wantErr bool
+	}{
+		{"empty", nil, false},
+		{"valid", []int32{100, 300, 600, 1000, 2000}, false},
+		{"not a multiple of 100", []int32{100, 250}, true},
+		{"not a multiple of 1000 above 1000", []int32{1000, 1500}, true},
+		{"not sorted", []int32{300, 100}, true},
+		{"duplicate", []int32{300, 300}, true},
+		{"zero", []int32{0, 100}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := AutoscalerConfig{SizeLadder: tc.ladder}
+			if err := config.validateSizeLadder(); (err != nil) != tc.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
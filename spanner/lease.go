@@ -0,0 +1,160 @@
+package spanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	// errLeaseHeld は他の呼び出しがインスタンスの lease を持っていることを表します。
+	errLeaseHeld = errors.New("lease is held by another caller")
+	// errLeaseLost は lease の更新に失敗し、他の呼び出しが lease を取得できる状態になったことを表します。
+	errLeaseLost = errors.New("lease was lost")
+)
+
+// leaseBackend はインスタンスごとに1つの呼び出しだけが UpdateInstance を行えるようにする lease の取得先です。
+// LEASE_DATABASE を設定すると Spanner のテーブルを使い、複数の autoscaler のインスタンスで lease を共有します。
+type leaseBackend interface {
+	// Acquire は key の lease を ttl の間取得します。他の呼び出しが持っている場合は errLeaseHeld を返します。
+	Acquire(ctx context.Context, key string, ttl time.Duration) (lease, error)
+}
+
+// lease は取得した lease です。
+type lease interface {
+	// Renew は lease の期限を ttl だけ延ばします。既に失っている場合は errLeaseLost を返します。
+	Renew(ctx context.Context, ttl time.Duration) error
+	Release(ctx context.Context) error
+}
+
+var (
+	// leases は lease の取得先です。テストで fake に差し替えられるように変数にしています。
+	leases leaseBackend
+	// leasesInit は最初に lease を使う時に leases を作ります。
+	// package の初期化では作らないため、LEASE_DATABASE は main やテストで設定した後の値を使います。
+	leasesInit sync.Once
+)
+
+// leaseStore は lease の取得先を返します。テストで leases に fake を設定した場合はそれを使います。
+func leaseStore() leaseBackend {
+	leasesInit.Do(func() {
+		if leases == nil {
+			leases = newLeaseBackend()
+		}
+	})
+	return leases
+}
+
+// newLeaseBackend は LEASE_DATABASE を設定した場合は Spanner のテーブルを、そうでなければプロセス内の lease を使います。
+func newLeaseBackend() leaseBackend {
+	if db := os.Getenv("LEASE_DATABASE"); db != "" {
+		return newSpannerLeaseBackend(db)
+	}
+	log.Print("LEASE_DATABASE is not set; leases only prevent concurrent updates within this process.")
+	return newLocalLeaseBackend()
+}
+
+// defaultLeaseTTL は LEASE_TTL_SECONDS が正の値でない場合に使う lease の期限です。
+const defaultLeaseTTL = 60 * time.Second
+
+// leaseTTL は UpdateInstance の間に持つ lease の期限です。ttl の 1/3 ごとに更新します。
+// 0 以下の値では lease を更新できないため、ログに出力してデフォルト値を使います。
+func leaseTTL() time.Duration {
+	ttl := durationFromEnv("LEASE_TTL_SECONDS", int(defaultLeaseTTL/time.Second), time.Second)
+	if ttl <= 0 {
+		log.Printf("Invalid LEASE_TTL_SECONDS %s; using %s", ttl, defaultLeaseTTL)
+		return defaultLeaseTTL
+	}
+	return ttl
+}
+
+// waitHoldingLease は l を ttl の 1/3 ごとに更新しながら op の完了を待ちます。
+// 更新に失敗した場合は他の呼び出しが競合する更新を始められるため、待つのをやめて errLeaseLost を返します。
+func waitHoldingLease(ctx context.Context, op updateInstanceOperation, instanceName string, l lease, ttl, interval time.Duration) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel(nil)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := l.Renew(ctx, ttl); err != nil {
+					logf(ctx, "Failed to renew lease of %s: %v", instanceName, err)
+					cancel(fmt.Errorf("%w: %v", errLeaseLost, err))
+					return
+				}
+			}
+		}
+	}()
+	return waitWithProgress(ctx, op, instanceName, interval)
+}
+
+// localLeaseBackend はプロセス内だけで有効な leaseBackend です。
+type localLeaseBackend struct {
+	mu     sync.Mutex
+	now    func() time.Time
+	next   int
+	leases map[string]localLeaseEntry
+}
+
+type localLeaseEntry struct {
+	token   int
+	expires time.Time
+}
+
+func newLocalLeaseBackend() *localLeaseBackend {
+	return &localLeaseBackend{now: time.Now, leases: make(map[string]localLeaseEntry)}
+}
+
+func (b *localLeaseBackend) Acquire(ctx context.Context, key string, ttl time.Duration) (lease, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	if e, ok := b.leases[key]; ok && now.Before(e.expires) {
+		return nil, errLeaseHeld
+	}
+	b.next++
+	b.leases[key] = localLeaseEntry{token: b.next, expires: now.Add(ttl)}
+	return &localLease{backend: b, key: key, token: b.next}, nil
+}
+
+type localLease struct {
+	backend *localLeaseBackend
+	key     string
+	token   int
+}
+
+func (l *localLease) Renew(ctx context.Context, ttl time.Duration) error {
+	b := l.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	e, ok := b.leases[l.key]
+	if !ok || e.token != l.token || !now.Before(e.expires) {
+		return errLeaseLost
+	}
+	b.leases[l.key] = localLeaseEntry{token: l.token, expires: now.Add(ttl)}
+	return nil
+}
+
+func (l *localLease) Release(ctx context.Context) error {
+	b := l.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if e, ok := b.leases[l.key]; ok && e.token == l.token {
+		delete(b.leases, l.key)
+	}
+	return nil
+}
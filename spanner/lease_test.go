@@ -0,0 +1,190 @@
+package spanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLeaseBackend は renewals 回目の更新までは成功し、それ以降の更新を失敗させる lease の fake です。
+// renewals が負の場合は常に成功します。
+type fakeLeaseBackend struct {
+	mu       sync.Mutex
+	renewals int
+	renewed  int
+	acquired []string
+	released []string
+}
+
+func (b *fakeLeaseBackend) Acquire(ctx context.Context, key string, ttl time.Duration) (lease, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.acquired = append(b.acquired, key)
+	return &fakeLease{backend: b, key: key}, nil
+}
+
+type fakeLease struct {
+	backend *fakeLeaseBackend
+	key     string
+}
+
+func (l *fakeLease) Renew(ctx context.Context, ttl time.Duration) error {
+	b := l.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.renewals >= 0 && b.renewed >= b.renewals {
+		return errors.New("lease expired")
+	}
+	b.renewed++
+	return nil
+}
+
+func (l *fakeLease) Release(ctx context.Context) error {
+	b := l.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.released = append(b.released, l.key)
+	return nil
+}
+
+func TestWaitHoldingLease_Renews(t *testing.T) {
+	backend := &fakeLeaseBackend{renewals: -1}
+	l, _ := backend.Acquire(context.Background(), "projects/p/instances/a", 0)
+	op := &fakeOperation{pollsUntilDone: 30}
+	if err := waitHoldingLease(context.Background(), op, "projects/p/instances/a", l, 3*time.Millisecond, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if backend.renewed < 2 {
+		t.Errorf("renewed got %d want at least 2", backend.renewed)
+	}
+}
+
+func TestWaitHoldingLease_LostLeaseAbortsWait(t *testing.T) {
+	backend := &fakeLeaseBackend{renewals: 1}
+	l, _ := backend.Acquire(context.Background(), "projects/p/instances/a", 0)
+	op := &fakeOperation{pollsUntilDone: 1 << 30}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- waitHoldingLease(context.Background(), op, "projects/p/instances/a", l, 3*time.Millisecond, time.Millisecond)
+	}()
+	select {
+	case err := <-errc:
+		if !errors.Is(err, errLeaseLost) {
+			t.Errorf("got %v want %v", err, errLeaseLost)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait was not aborted after losing the lease")
+	}
+}
+
+// useLeaseBackend は leaseStore が backend を返すようにします。
+func useLeaseBackend(t *testing.T, backend leaseBackend) {
+	t.Helper()
+	restoreLeaseStore(t)
+	leases = backend
+}
+
+// restoreLeaseStore はテストの後で leases を元に戻します。元が未作成であれば次に使う時に作り直します。
+func restoreLeaseStore(t *testing.T) {
+	orig := leases
+	t.Cleanup(func() { leases, leasesInit = orig, sync.Once{} })
+}
+
+func TestLeaseStore_ReadsEnvironmentOnFirstUse(t *testing.T) {
+	restoreLeaseStore(t)
+	for _, tc := range []struct {
+		database string
+		want     string
+	}{
+		{"", "*spanner.localLeaseBackend"},
+		{"projects/p/instances/i/databases/d", "*spanner.spannerLeaseBackend"},
+	} {
+		t.Setenv("LEASE_DATABASE", tc.database)
+		leases, leasesInit = nil, sync.Once{}
+		if got := fmt.Sprintf("%T", leaseStore()); got != tc.want {
+			t.Errorf("LEASE_DATABASE=%q: got %s want %s", tc.database, got, tc.want)
+		}
+		// 以降の呼び出しは同じ backend を使い回します。
+		if leaseStore() != leases {
+			t.Errorf("LEASE_DATABASE=%q: backend was created again", tc.database)
+		}
+	}
+}
+
+func TestUpdateProcessingUnits_Lease(t *testing.T) {
+	const name = "projects/p/instances/a"
+	admin := newFakeInstanceAdmin(map[string]int32{name: 100})
+	useFakes(t, admin, &fakeMetricClient{})
+	backend := &fakeLeaseBackend{renewals: -1}
+	useLeaseBackend(t, backend)
+	if err := updateCapacity(context.Background(), name, capacityTarget{ProcessingUnits: 200}); err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.acquired) != 1 || len(backend.released) != 1 {
+		t.Errorf("acquired %v released %v want one each", backend.acquired, backend.released)
+	}
+
+	// 他の呼び出しが lease を持っている間は更新を始めません。
+	local := newLocalLeaseBackend()
+	useLeaseBackend(t, local)
+	if _, err := local.Acquire(context.Background(), name, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateCapacity(context.Background(), name, capacityTarget{ProcessingUnits: 300}); !errors.Is(err, errLeaseHeld) {
+		t.Errorf("got %v want %v", err, errLeaseHeld)
+	}
+	if got := admin.processingUnits(name); got != 200 {
+		t.Errorf("processing units got %d want 200", got)
+	}
+}
+
+func TestLocalLeaseBackend(t *testing.T) {
+	now := time.Now()
+	b := newLocalLeaseBackend()
+	b.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	l, err := b.Acquire(ctx, "a", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Acquire(ctx, "a", time.Minute); !errors.Is(err, errLeaseHeld) {
+		t.Errorf("second acquire got %v want %v", err, errLeaseHeld)
+	}
+	now = now.Add(50 * time.Second)
+	if err := l.Renew(ctx, time.Minute); err != nil {
+		t.Errorf("renew got %v", err)
+	}
+
+	// 期限が切れた lease は他の呼び出しが取得でき、元の lease は更新できません。
+	now = now.Add(2 * time.Minute)
+	if _, err := b.Acquire(ctx, "a", time.Minute); err != nil {
+		t.Errorf("acquire after expiry got %v", err)
+	}
+	if err := l.Renew(ctx, time.Minute); !errors.Is(err, errLeaseLost) {
+		t.Errorf("renew after expiry got %v want %v", err, errLeaseLost)
+	}
+}
+
+func TestLeaseTTL(t *testing.T) {
+	cases := []struct {
+		env  string
+		want time.Duration
+	}{
+		{"", defaultLeaseTTL},
+		{"30", 30 * time.Second},
+		{"0", defaultLeaseTTL},
+		{"-5", defaultLeaseTTL},
+	}
+	for _, tc := range cases {
+		t.Run(tc.env, func(t *testing.T) {
+			t.Setenv("LEASE_TTL_SECONDS", tc.env)
+			if got := leaseTTL(); got != tc.want {
+				t.Errorf("got %s want %s", got, tc.want)
+			}
+		})
+	}
+}
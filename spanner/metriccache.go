@@ -0,0 +1,61 @@
+package spanner
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// cachedMetric は最後に読み取ったメトリクスの値です。
+type cachedMetric struct {
+	// Key は readMetric が読み取ったメトリクスを表します。metricQuery を変えた場合は再利用しません。
+	Key     string
+	Source  string
+	Reading metricReading
+	ReadAt  time.Time
+}
+
+// metricCacheKey は config で読み取るメトリクスを表す文字列です。
+func metricCacheKey(config AutoscalerConfig) string {
+	if config.MetricQuery != "" {
+		return metricSourceQuery + ":" + config.MetricQuery
+	}
+	if r := config.ReferenceInstance; r != nil && r.Mode == referenceModeCPU {
+		return metricSourceReference + ":" + r.instanceName()
+	}
+	return metricSourceCPU
+}
+
+// validateMinMetricReadInterval は MinMetricReadIntervalSeconds がメトリクスの読み取り期間と cooldown より短いかを確認します。
+// それより長く再利用すると、判断に使う値がスケーリングの間隔に追従しなくなります。
+func (c *AutoscalerConfig) validateMinMetricReadInterval() error {
+	interval := time.Duration(c.MinMetricReadIntervalSeconds * float64(time.Second))
+	if interval < 0 || (interval > 0 && (interval >= metricLookback || interval >= c.cooldown(0))) {
+		return errors.New("Invalid minMetricReadIntervalSeconds. It must be shorter than 5 minutes and the cooldown.")
+	}
+	return nil
+}
+
+// readMetricCached は MinMetricReadIntervalSeconds 以内に読み取ったメトリクスがあれば
+// ListTimeSeries を呼ばずにその値を返します。なければ readMetric で読み取り、その値を保存します。
+func readMetricCached(ctx context.Context, config AutoscalerConfig, state instanceState, now time.Time, result *ScaleResult) (*metricReading, error) {
+	interval := time.Duration(config.MinMetricReadIntervalSeconds * float64(time.Second))
+	key := metricCacheKey(config)
+	if c := state.Metric; interval > 0 && c != nil && c.Key == key && now.Sub(c.ReadAt) < interval {
+		logf(ctx, "Reusing metrics read %s ago.", now.Sub(c.ReadAt).Round(time.Second))
+		result.Diagnostics.MetricSource = c.Source
+		result.Diagnostics.MetricAgeSeconds = now.Sub(c.ReadAt).Seconds()
+		reading := c.Reading
+		return &reading, nil
+	}
+	reading, err := readMetric(ctx, config, result)
+	if err != nil {
+		return nil, err
+	}
+	if interval > 0 {
+		updateState(result.instanceName, func(s *instanceState) {
+			s.Metric = &cachedMetric{Key: key, Source: result.Diagnostics.MetricSource, Reading: *reading, ReadAt: now.UTC()}
+		})
+	}
+	return reading, nil
+}
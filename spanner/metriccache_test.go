@@ -0,0 +1,80 @@
+package spanner
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEvaluate_MinMetricReadInterval(t *testing.T) {
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 300})
+	metrics := &fakeMetricClient{reads: map[string][]float64{"a": {40, 90, 10}}}
+	useFakes(t, admin, metrics)
+
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000, MinMetricReadIntervalSeconds: 60}
+	config.applyDefaults()
+	for i := 0; i < 3; i++ {
+		result, err := evaluate(context.Background(), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.CPUUsage != 40 {
+			t.Errorf("call %d: cpu got %v want the cached 40", i, result.CPUUsage)
+		}
+		if i > 0 && result.Diagnostics.MetricAgeSeconds <= 0 {
+			t.Errorf("call %d: metricAgeSeconds got %v", i, result.Diagnostics.MetricAgeSeconds)
+		}
+	}
+	if metrics.listCalls != 1 {
+		t.Errorf("ListTimeSeries called %d times want 1", metrics.listCalls)
+	}
+
+	// 間隔を過ぎると読み取り直します。
+	updateState("projects/p/instances/a", func(s *instanceState) { s.Metric.ReadAt = time.Now().Add(-time.Minute) })
+	result, err := evaluate(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.CPUUsage != 90 || metrics.listCalls != 2 {
+		t.Errorf("after the interval: cpu got %v, ListTimeSeries called %d times", result.CPUUsage, metrics.listCalls)
+	}
+}
+
+func TestEvaluate_MinMetricReadIntervalDisabled(t *testing.T) {
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 300})
+	metrics := &fakeMetricClient{reads: map[string][]float64{"a": {40, 90}}}
+	useFakes(t, admin, metrics)
+
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000}
+	config.applyDefaults()
+	for _, want := range []float64{40, 90} {
+		result, err := evaluate(context.Background(), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.CPUUsage != want {
+			t.Errorf("cpu got %v want %v", result.CPUUsage, want)
+		}
+	}
+}
+
+func TestAutoscalerConfig_ValidateMinMetricReadInterval(t *testing.T) {
+	cases := []struct {
+		name    string
+		config  AutoscalerConfig
+		wantErr bool
+	}{
+		{"disabled", AutoscalerConfig{}, false},
+		{"shorter than lookback and cooldown", AutoscalerConfig{MinMetricReadIntervalSeconds: 60}, false},
+		{"negative", AutoscalerConfig{MinMetricReadIntervalSeconds: -1}, true},
+		{"as long as lookback", AutoscalerConfig{MinMetricReadIntervalSeconds: 300}, true},
+		{"longer than cooldown", AutoscalerConfig{MinMetricReadIntervalSeconds: 120, CooldownBaseMinutes: 1}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.config.validateMinMetricReadInterval(); (err != nil) != tc.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package spanner
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const reasonInstanceTooNew = "instance_too_new"
+
+// newInstanceGracePeriod は作成直後のインスタンスをスケーリングしない期間です。0 の場合は作成直後でもスケーリングします。
+func newInstanceGracePeriod() time.Duration {
+	return durationFromEnv("NEW_INSTANCE_GRACE_PERIOD_MINUTES", 10, time.Minute)
+}
+
+// instanceAge はインスタンスが作成されてからの時間を返します。
+// GetInstance が作成時刻を返さない場合は、autoscaler が最初にインスタンスを見た時刻からの時間を返します。
+func instanceAge(info instanceInfo, state instanceState, now time.Time) time.Duration {
+	created := info.CreateTime
+	if created.IsZero() {
+		created = state.FirstSeen
+	}
+	if created.IsZero() {
+		return 0
+	}
+	return now.Sub(created)
+}
+
+// skipNewInstance は作成されてから newInstanceGracePeriod が経過していないインスタンスであれば、
+// スケーリングしない理由を result に設定して true を返します。
+// 作成直後のインスタンスはメトリクスが安定していないため、判断に使いません。
+func skipNewInstance(ctx context.Context, info instanceInfo, state instanceState, now time.Time, result *ScaleResult) bool {
+	if info.CreateTime.IsZero() && state.FirstSeen.IsZero() {
+		updateState(result.instanceName, func(s *instanceState) {
+			if s.FirstSeen.IsZero() {
+				s.FirstSeen = now.UTC()
+			}
+		})
+	}
+	grace := newInstanceGracePeriod()
+	age := instanceAge(info, state, now)
+	tooNew := grace > 0 && age < grace
+	result.trace("instance_age", traceOutcome(tooNew), map[string]any{"ageSeconds": age.Seconds(), "gracePeriodSeconds": grace.Seconds()})
+	if !tooNew {
+		return false
+	}
+	logf(ctx, "Skipping scaling because %s was created %s ago.", result.label(), age.Round(time.Second))
+	result.Reason = reasonInstanceTooNew
+	result.Message = fmt.Sprintf("Skipping scaling because the instance was created %s ago, within the %s grace period.", age.Round(time.Second), grace)
+	return true
+}
@@ -0,0 +1,75 @@
+package spanner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestEvaluate_InstanceTooNew(t *testing.T) {
+	cases := []struct {
+		name        string
+		createdAgo  time.Duration
+		gracePeriod string
+		wantAction  string
+		wantReason  string
+	}{
+		{"recently created", 2 * time.Minute, "", actionNone, reasonInstanceTooNew},
+		{"established", time.Hour, "", actionScaleUp, reasonCPUAboveThreshold},
+		{"grace period disabled", 2 * time.Minute, "0", actionScaleUp, reasonCPUAboveThreshold},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.gracePeriod != "" {
+				t.Setenv("NEW_INSTANCE_GRACE_PERIOD_MINUTES", tc.gracePeriod)
+			}
+			admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 100})
+			admin.instances["projects/p/instances/a"].CreateTime = timestamppb.New(time.Now().Add(-tc.createdAgo))
+			metrics := &fakeMetricClient{cpu: map[string]float64{"a": 90}}
+			useFakes(t, admin, metrics)
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000}
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Action != tc.wantAction || result.Reason != tc.wantReason {
+				t.Errorf("got action=%s reason=%s want action=%s reason=%s", result.Action, result.Reason, tc.wantAction, tc.wantReason)
+			}
+			if tc.wantReason == reasonInstanceTooNew && metrics.listCalls != 0 {
+				t.Errorf("read metrics of a new instance %d times", metrics.listCalls)
+			}
+		})
+	}
+}
+
+func TestEvaluate_InstanceTooNewByFirstSeen(t *testing.T) {
+	const name = "projects/p/instances/a"
+	admin := newFakeInstanceAdmin(map[string]int32{name: 100})
+	admin.instances[name].CreateTime = nil
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90}})
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000}
+	config.applyDefaults()
+
+	result, err := evaluate(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Reason != reasonInstanceTooNew {
+		t.Errorf("first seen instance got reason=%s want %s", result.Reason, reasonInstanceTooNew)
+	}
+	if loadState(name).FirstSeen.IsZero() {
+		t.Fatal("first seen time was not recorded")
+	}
+
+	updateState(name, func(s *instanceState) { s.FirstSeen = time.Now().Add(-11 * time.Minute) })
+	result, err = evaluate(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Action != actionScaleUp {
+		t.Errorf("after grace period got action=%s reason=%s", result.Action, result.Reason)
+	}
+}
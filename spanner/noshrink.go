@@ -0,0 +1,108 @@
+package spanner
+
+import (
+	"fmt"
+	"time"
+	_ "time/tzdata" // NoShrinkWindow の timeZone をタイムゾーンのデータがない環境でも解決するため
+)
+
+const reasonNoShrinkWindow = "no_shrink_window"
+
+// NoShrinkWindow is a recurring time window during which the instance is not scaled down
+// below the processing units it had when the window was entered. Scale up is still allowed.
+type NoShrinkWindow struct {
+	// Days は "Mon", "Tue" のような曜日です。省略した場合は毎日です。
+	// End が Start より前の日をまたぐ期間では、Start の曜日で判断します。
+	Days []string `json:"days"`
+	// Start, End は "09:00" のような時刻です。End には "24:00" を指定できます。
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// TimeZone は "Asia/Tokyo" のような IANA のタイムゾーンです。省略した場合は UTC です。
+	TimeZone string `json:"timeZone"`
+}
+
+func (w NoShrinkWindow) validate() error {
+	if _, err := parseClock(w.Start); err != nil {
+		return err
+	}
+	if _, err := parseClock(w.End); err != nil {
+		return err
+	}
+	if _, err := time.LoadLocation(w.TimeZone); err != nil {
+		return err
+	}
+	for _, d := range w.Days {
+		if _, ok := weekdays[d]; !ok {
+			return fmt.Errorf("unknown day %q", d)
+		}
+	}
+	return nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"Sun": time.Sunday, "Mon": time.Monday, "Tue": time.Tuesday, "Wed": time.Wednesday,
+	"Thu": time.Thursday, "Fri": time.Friday, "Sat": time.Saturday,
+}
+
+// contains は t が期間内かどうかを返します。validate 済みであることを前提にしています。
+func (w NoShrinkWindow) contains(t time.Time) bool {
+	loc, err := time.LoadLocation(w.TimeZone)
+	if err != nil {
+		return false
+	}
+	t = t.In(loc)
+	start, _ := parseClock(w.Start)
+	end, _ := parseClock(w.End)
+	clock := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+
+	day := t.Weekday()
+	switch {
+	case start <= end:
+		if clock < start || clock >= end {
+			return false
+		}
+	case clock >= start:
+	case clock < end:
+		// 日をまたぐ期間の翌日側は、前日に始まった期間です。
+		day = (day + 6) % 7
+	default:
+		return false
+	}
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if weekdays[d] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock は "15:04" 形式の時刻を 0 時からの経過時間として返します。
+func parseClock(s string) (time.Duration, error) {
+	if s == "24:00" {
+		return 24 * time.Hour, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// noShrinkFloor は now がいずれかの NoShrinkWindow 内であれば、スケールダウンの下限にする PU を返します。
+// 期間に入って最初の判断では currentPU を下限とし、その後は state に記録した下限を使い続けます。
+// 期間外の場合は 0 を返します。
+func noShrinkFloor(config AutoscalerConfig, state instanceState, now time.Time, currentPU int32) int32 {
+	for _, w := range config.NoShrinkWindows {
+		if !w.contains(now) {
+			continue
+		}
+		if state.NoShrinkFloorPU > 0 {
+			return state.NoShrinkFloorPU
+		}
+		return currentPU
+	}
+	return 0
+}
@@ -0,0 +1,111 @@
+package spanner
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNoShrinkWindow_Contains(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	weekdays := NoShrinkWindow{Days: []string{"Mon", "Tue", "Wed", "Thu", "Fri"}, Start: "09:00", End: "18:00", TimeZone: "Asia/Tokyo"}
+	overnight := NoShrinkWindow{Days: []string{"Fri"}, Start: "22:00", End: "02:00", TimeZone: "Asia/Tokyo"}
+	cases := []struct {
+		name   string
+		window NoShrinkWindow
+		t      time.Time
+		want   bool
+	}{
+		{"weekday morning", weekdays, time.Date(2026, 10, 14, 9, 0, 0, 0, tokyo), true},
+		{"weekday before start", weekdays, time.Date(2026, 10, 14, 8, 59, 0, 0, tokyo), false},
+		{"weekday at end", weekdays, time.Date(2026, 10, 14, 18, 0, 0, 0, tokyo), false},
+		{"saturday", weekdays, time.Date(2026, 10, 17, 12, 0, 0, 0, tokyo), false},
+		{"converted from UTC", weekdays, time.Date(2026, 10, 14, 1, 0, 0, 0, time.UTC), true},
+		{"overnight start day", overnight, time.Date(2026, 10, 16, 23, 0, 0, 0, tokyo), true},
+		{"overnight next day", overnight, time.Date(2026, 10, 17, 1, 0, 0, 0, tokyo), true},
+		{"overnight wrong day", overnight, time.Date(2026, 10, 16, 1, 0, 0, 0, tokyo), false},
+		{"whole day", NoShrinkWindow{Start: "00:00", End: "24:00"}, time.Date(2026, 10, 14, 23, 59, 0, 0, time.UTC), true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.window.contains(tc.t); got != tc.want {
+				t.Errorf("contains(%v) got %v want %v", tc.t, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNoShrinkWindow_Validate(t *testing.T) {
+	cases := []struct {
+		name    string
+		window  NoShrinkWindow
+		wantErr bool
+	}{
+		{"ok", NoShrinkWindow{Days: []string{"Mon"}, Start: "09:00", End: "18:00", TimeZone: "Asia/Tokyo"}, false},
+		{"invalid start", NoShrinkWindow{Start: "9am", End: "18:00"}, true},
+		{"unknown time zone", NoShrinkWindow{Start: "09:00", End: "18:00", TimeZone: "Asia/Nowhere"}, true},
+		{"unknown day", NoShrinkWindow{Days: []string{"Monday"}, Start: "09:00", End: "18:00"}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.window.validate(); (err != nil) != tc.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestEvaluate_NoShrinkWindow(t *testing.T) {
+	t.Setenv("RESIZE_INTERVAL_MINUTES", "0")
+	const name = "projects/p/instances/a"
+	admin := newFakeInstanceAdmin(map[string]int32{name: 500})
+	metrics := &fakeMetricClient{cpu: map[string]float64{"a": 10}}
+	useFakes(t, admin, metrics)
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000,
+		NoShrinkWindows: []NoShrinkWindow{{Start: "00:00", End: "24:00"}}}
+	config.applyDefaults()
+	run := func() *ScaleResult {
+		t.Helper()
+		result, err := evaluate(context.Background(), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := apply(context.Background(), result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	// 期間に入った時点の PU で固定します。
+	if result := run(); result.Action != actionNone || result.Reason != reasonNoShrinkWindow {
+		t.Errorf("entering window: got action=%s reason=%s", result.Action, result.Reason)
+	}
+	if got := loadState(name).NoShrinkFloorPU; got != 500 {
+		t.Fatalf("floor got %d want 500", got)
+	}
+
+	// スケールアップはでき、その後も期間に入った時点の PU までしか縮めません。
+	metrics.cpu["a"] = 90
+	if result := run(); result.Action != actionScaleUp || result.NewPU != 600 {
+		t.Errorf("got action=%s newPU=%d want scale_up to 600", result.Action, result.NewPU)
+	}
+	metrics.cpu["a"] = 10
+	if result := run(); result.Action != actionScaleDown || result.NewPU != 500 {
+		t.Errorf("got action=%s newPU=%d want scale_down to 500", result.Action, result.NewPU)
+	}
+	if result := run(); result.Action != actionNone || result.Reason != reasonNoShrinkWindow {
+		t.Errorf("at floor: got action=%s reason=%s", result.Action, result.Reason)
+	}
+
+	// 期間を出ると下限を解除します。
+	config.NoShrinkWindows = nil
+	if result := run(); result.Action != actionScaleDown || result.NewPU != 400 {
+		t.Errorf("leaving window: got action=%s newPU=%d want scale_down to 400", result.Action, result.NewPU)
+	}
+	if got := loadState(name).NoShrinkFloorPU; got != 0 {
+		t.Errorf("floor was not cleared: %d", got)
+	}
+}
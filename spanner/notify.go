@@ -0,0 +1,78 @@
+package spanner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+const (
+	severityCritical = "critical"
+	severityWarning  = "warning"
+)
+
+// notification は NOTIFY_WEBHOOK_URL に POST する通知です。
+type notification struct {
+	Severity    string `json:"severity"`
+	RequestID   string `json:"requestId,omitempty"`
+	Project     string `json:"project"`
+	Instance    string `json:"instance"`
+	DisplayName string `json:"displayName,omitempty"`
+	Reason      string `json:"reason"`
+	Message     string `json:"message"`
+}
+
+// notifyHTTPClient はテストで差し替えられるように変数にしています。
+var notifyHTTPClient = http.DefaultClient
+
+// notify は NOTIFY_WEBHOOK_URL が設定されていれば n を JSON で POST します。
+// 通知に失敗してもスケーリングの結果は変えず、ログに出力するだけです。
+func notify(ctx context.Context, n notification) {
+	url := os.Getenv("NOTIFY_WEBHOOK_URL")
+	if url == "" {
+		return
+	}
+	if err := postNotification(ctx, url, n); err != nil {
+		logf(ctx, "Failed to send %s notification: %v", n.Severity, err)
+	}
+}
+
+func postNotification(ctx context.Context, url string, n notification) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), readTimeout())
+	defer cancel()
+
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := notifyHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// resultNotification は result の内容で通知を作ります。
+func resultNotification(severity string, result *ScaleResult) notification {
+	return notification{
+		Severity:    severity,
+		RequestID:   result.RequestID,
+		Project:     result.Project,
+		Instance:    result.Instance,
+		DisplayName: result.DisplayName,
+		Reason:      result.Reason,
+		Message:     result.Message,
+	}
+}
@@ -0,0 +1,71 @@
+package spanner
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const meterName = "github.com/sinmetalcraft/autoscaler/spanner"
+
+// decisionInstruments は autoscaler の判断を記録する OpenTelemetry の instrument です。
+type decisionInstruments struct {
+	decisions       metric.Int64Counter
+	cpuUsage        metric.Float64Histogram
+	processingUnits metric.Int64Gauge
+	nearBound       metric.Float64Gauge
+}
+
+// newDecisionInstruments は otel.GetMeterProvider から instrument を作ります。
+// MeterProvider が設定されていない場合は何も記録しない no-op の instrument になります。
+// SDK は同じ名前の instrument を再利用するため、呼び出しごとに作っても問題ありません。
+func newDecisionInstruments() (*decisionInstruments, error) {
+	meter := otel.GetMeterProvider().Meter(meterName)
+	decisions, err := meter.Int64Counter("autoscaler.decisions",
+		metric.WithDescription("Number of autoscaling decisions by action and reason."))
+	if err != nil {
+		return nil, err
+	}
+	cpuUsage, err := meter.Float64Histogram("autoscaler.cpu_usage",
+		metric.WithDescription("Observed CPU usage (or metricQuery value) the decision was based on."),
+		metric.WithUnit("%"))
+	if err != nil {
+		return nil, err
+	}
+	processingUnits, err := meter.Int64Gauge("autoscaler.processing_units",
+		metric.WithDescription("Processing units of the instance after the decision."),
+		metric.WithUnit("{processing_unit}"))
+	if err != nil {
+		return nil, err
+	}
+	nearBound, err := meter.Float64Gauge("autoscaler.near_bound_ratio",
+		metric.WithDescription("Fraction of recent decisions near puMin or puMax, recorded when it exceeds the boundsAdvisory ratio."))
+	if err != nil {
+		return nil, err
+	}
+	return &decisionInstruments{decisions: decisions, cpuUsage: cpuUsage, processingUnits: processingUnits, nearBound: nearBound}, nil
+}
+
+// recordDecisionMetrics は result の判断を OpenTelemetry の metrics として記録します。
+func recordDecisionMetrics(ctx context.Context, result *ScaleResult) {
+	inst, err := newDecisionInstruments()
+	if err != nil {
+		logf(ctx, "Failed to create OpenTelemetry instruments: %v", err)
+		return
+	}
+	instance := metric.WithAttributes(
+		attribute.String("project", result.Project),
+		attribute.String("instance", result.Instance),
+	)
+	inst.decisions.Add(ctx, 1, instance, metric.WithAttributes(
+		attribute.String("action", result.Action),
+		attribute.String("reason", result.Reason),
+	))
+	inst.cpuUsage.Record(ctx, result.CPUUsage, instance)
+	inst.processingUnits.Record(ctx, int64(result.NewPU), instance)
+	for _, b := range result.NearBounds {
+		inst.nearBound.Record(ctx, b.Ratio, instance, metric.WithAttributes(attribute.String("bound", b.Bound)))
+	}
+}
@@ -0,0 +1,63 @@
+package spanner
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestApply_RecordsOpenTelemetryMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	orig := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	t.Cleanup(func() { otel.SetMeterProvider(orig) })
+
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 100})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90}})
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000}
+	config.applyDefaults()
+	result, err := evaluate(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := apply(context.Background(), result); err != nil {
+		t.Fatal(err)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	metrics := map[string]metricdata.Aggregation{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+
+	decisions, ok := metrics["autoscaler.decisions"].(metricdata.Sum[int64])
+	if !ok || len(decisions.DataPoints) != 1 {
+		t.Fatalf("autoscaler.decisions got %#v", metrics["autoscaler.decisions"])
+	}
+	dp := decisions.DataPoints[0]
+	if dp.Value != 1 {
+		t.Errorf("decisions got %d want 1", dp.Value)
+	}
+	if v, _ := dp.Attributes.Value(attribute.Key("action")); v.AsString() != actionScaleUp {
+		t.Errorf("action attribute got %q want %q", v.AsString(), actionScaleUp)
+	}
+
+	cpu, ok := metrics["autoscaler.cpu_usage"].(metricdata.Histogram[float64])
+	if !ok || len(cpu.DataPoints) != 1 || cpu.DataPoints[0].Sum != 90 {
+		t.Errorf("autoscaler.cpu_usage got %#v", metrics["autoscaler.cpu_usage"])
+	}
+
+	pu, ok := metrics["autoscaler.processing_units"].(metricdata.Gauge[int64])
+	if !ok || len(pu.DataPoints) != 1 || pu.DataPoints[0].Value != 200 {
+		t.Errorf("autoscaler.processing_units got %#v", metrics["autoscaler.processing_units"])
+	}
+}
@@ -0,0 +1,31 @@
+package spanner
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const reasonPanicThreshold = "cpu_above_panic_threshold"
+
+// panicScaleUp は CPU 使用率が PanicCPUThreshold を超えた場合に、ステップを無視して一度に PUMax までスケールアップします。
+// Spanner を続けてリサイズする際の最小の間隔 (MIN_UPDATE_INTERVAL_SECONDS) は守ります。
+func panicScaleUp(ctx context.Context, config AutoscalerConfig, state instanceState, result *ScaleResult) {
+	logf(ctx, "CPU usage %.2f%% is above the panic threshold %.2f%%", result.CPUUsage, config.PanicCPUThreshold)
+	result.Reason = reasonPanicThreshold
+	if result.CurrentPU >= int32(config.PUMax) {
+		result.Reason = reasonAtMaxPU
+		result.Message = "CPU usage is above the panic threshold, but already at max PUs."
+		return
+	}
+	if !state.LastResized.IsZero() && time.Since(state.LastResized) < minUpdateInterval() {
+		logf(ctx, "Skipping panic scale up due to update rate limit.")
+		result.Reason = reasonRateLimited
+		result.Message = "CPU usage is above the panic threshold, but skipping scale up due to update rate limit."
+		return
+	}
+	result.Action = actionScaleUp
+	result.NewPU = int32(config.PUMax)
+	result.Message = fmt.Sprintf("CPU usage is above the panic threshold; scaled up to %d PUs.", result.NewPU)
+	result.panicked = true
+}
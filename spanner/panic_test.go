@@ -0,0 +1,172 @@
+package spanner
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// useFakeWebhook は NOTIFY_WEBHOOK_URL に受け取った通知を記録する server を設定します。
+func useFakeWebhook(t *testing.T) func() []notification {
+	t.Helper()
+	var mu sync.Mutex
+	var received []notification
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n notification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Errorf("invalid notification: %v", err)
+		}
+		mu.Lock()
+		received = append(received, n)
+		mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("NOTIFY_WEBHOOK_URL", srv.URL)
+	return func() []notification {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]notification(nil), received...)
+	}
+}
+
+func TestEvaluate_PanicThreshold(t *testing.T) {
+	cases := []struct {
+		name        string
+		cpu         float64
+		currentPU   int32
+		lastResized time.Duration
+		wantAction  string
+		wantReason  string
+		wantNewPU   int32
+	}{
+		{"above panic threshold", 97, 200, 0, actionScaleUp, reasonPanicThreshold, 5000},
+		{"below panic threshold steps up", 90, 200, 0, actionScaleUp, reasonCPUAboveThreshold, 300},
+		{"ignores cooldown after a recent scale up", 97, 200, 10 * time.Minute, actionScaleUp, reasonPanicThreshold, 5000},
+		{"respects update rate limit", 97, 200, 10 * time.Second, actionNone, reasonRateLimited, 200},
+		{"already at max", 97, 5000, 0, actionNone, reasonAtMaxPU, 5000},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": tc.currentPU})
+			useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": tc.cpu}})
+			if tc.lastResized > 0 {
+				updateState("projects/p/instances/a", func(s *instanceState) {
+					s.LastResized = time.Now().Add(-tc.lastResized)
+					s.LastChangePU = 100
+				})
+			}
+
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 5000, PanicCPUThreshold: 95}
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Action != tc.wantAction || result.Reason != tc.wantReason || result.NewPU != tc.wantNewPU {
+				t.Errorf("got action=%s reason=%s newPU=%d want action=%s reason=%s newPU=%d",
+					result.Action, result.Reason, result.NewPU, tc.wantAction, tc.wantReason, tc.wantNewPU)
+			}
+		})
+	}
+}
+
+func TestEvaluate_PanicThresholdWithSafeMode(t *testing.T) {
+	cases := []struct {
+		name        string
+		cpu         float64
+		wantReason  string
+		wantNewPU   int32
+		wantClamped bool
+	}{
+		// パニックスケールアップは safeMode でも1ステップに制限せず puMax までスケールアップします。
+		{"panic scale up", 97, reasonPanicThreshold, 5000, false},
+		{"normal scale up", 90, reasonCPUAboveThreshold, 1100, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 1000})
+			useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": tc.cpu}})
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 5000, PanicCPUThreshold: 95, SafeMode: true}
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Action != actionScaleUp || result.Reason != tc.wantReason || result.NewPU != tc.wantNewPU || result.SafeModeClamped != tc.wantClamped {
+				t.Errorf("got action=%s reason=%s newPU=%d safeModeClamped=%v want reason=%s newPU=%d safeModeClamped=%v",
+					result.Action, result.Reason, result.NewPU, result.SafeModeClamped, tc.wantReason, tc.wantNewPU, tc.wantClamped)
+			}
+		})
+	}
+}
+
+func TestApply_PanicNotification(t *testing.T) {
+	received := useFakeWebhook(t)
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 200})
+	admin.instances["projects/p/instances/a"].DisplayName = "Orders DB"
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 99}})
+
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 5000, PanicCPUThreshold: 95}
+	config.applyDefaults()
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "panic-id")
+	result, err := evaluate(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := apply(ctx, result); err != nil {
+		t.Fatal(err)
+	}
+	if got := admin.processingUnits("projects/p/instances/a"); got != 5000 {
+		t.Errorf("processing units got %d want 5000", got)
+	}
+	n := received()
+	if len(n) != 1 {
+		t.Fatalf("notifications got %+v want 1", n)
+	}
+	if n[0].Severity != severityCritical || n[0].RequestID != "panic-id" || n[0].DisplayName != "Orders DB" || n[0].Reason != reasonPanicThreshold {
+		t.Errorf("notification got %+v", n[0])
+	}
+
+	// CPU 使用率が下がった後は通常どおりステップごとにスケールダウンし、通知はしません。
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 10}})
+	result, err = evaluate(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Action != actionScaleDown || result.NewPU != 4900 {
+		t.Errorf("got action=%s newPU=%d want scale_down to 4900", result.Action, result.NewPU)
+	}
+	if err := apply(context.Background(), result); err != nil {
+		t.Fatal(err)
+	}
+	if len(received()) != 1 {
+		t.Errorf("notified %d times want 1", len(received()))
+	}
+}
+
+func TestAutoscalerConfig_ValidatePanicCPUThreshold(t *testing.T) {
+	cases := []struct {
+		name      string
+		threshold float64
+		scaleUp   float64
+		wantErr   bool
+	}{
+		{"disabled", 0, 0, false},
+		{"above scaleUpThreshold", 95, 80, false},
+		{"not above scaleUpThreshold", 80, 80, true},
+		{"not above default scaleUpThreshold", 40, 0, true},
+		{"negative", -1, 0, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000, ScaleUpThreshold: tc.scaleUp, PanicCPUThreshold: tc.threshold}
+			if err := config.validate(); (err != nil) != tc.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package spanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	monitoringpb "cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	metricSourceCPU   = "cpu"
+	metricSourceQuery = "query"
+)
+
+// errNotScalar はクエリの結果が1つの数値ではない場合のエラーです。
+var errNotScalar = errors.New("metric query must return a single scalar time series")
+
+// getMetricQueryValue は MQL のクエリ query を実行し、その結果の最新の値を返します。
+// クエリは1つの time series で、各データポイントが1つの数値を持つ必要があります。
+func getMetricQueryValue(ctx context.Context, projectID, query string) (*metricReading, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout())
+	defer cancel()
+
+	c, err := newQueryClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	it := c.QueryTimeSeries(ctx, &monitoringpb.QueryTimeSeriesRequest{
+		Name:  "projects/" + projectID,
+		Query: query,
+	})
+	var series []*monitoringpb.TimeSeriesData
+	for {
+		resp, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read metric query result: %w", err)
+		}
+		series = append(series, resp)
+	}
+	if len(series) != 1 {
+		return nil, fmt.Errorf("%w: got %d time series", errNotScalar, len(series))
+	}
+
+	var reading metricReading
+	var latest time.Time
+	var points []trendPoint
+	for _, p := range series[0].GetPointData() {
+		if len(p.GetValues()) != 1 {
+			return nil, fmt.Errorf("%w: got %d values per point", errNotScalar, len(p.GetValues()))
+		}
+		var v float64
+		switch value := p.GetValues()[0].GetValue().(type) {
+		case *monitoringpb.TypedValue_DoubleValue:
+			v = value.DoubleValue
+		case *monitoringpb.TypedValue_Int64Value:
+			v = float64(value.Int64Value)
+		default:
+			return nil, fmt.Errorf("%w: got non-numeric value %T", errNotScalar, value)
+		}
+		reading.Samples++
+		t := p.GetTimeInterval().GetEndTime().AsTime()
+		points = append(points, trendPoint{t: t, v: v})
+		if reading.Samples == 1 || t.After(latest) {
+			latest = t
+			reading.Usage = v
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].t.Before(points[j].t) })
+	reading.SlopePerMinute = trendSlope(points)
+	if reading.Samples == 0 {
+		return nil, fmt.Errorf("no data found for metric query")
+	}
+	return &reading, nil
+}
@@ -0,0 +1,86 @@
+package spanner
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	monitoringpb "cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func scalarSeries(values ...*monitoringpb.TypedValue) *monitoringpb.TimeSeriesData {
+	now := time.Now()
+	ts := &monitoringpb.TimeSeriesData{}
+	for i, v := range values {
+		ts.PointData = append(ts.PointData, &monitoringpb.TimeSeriesData_PointData{
+			Values:       []*monitoringpb.TypedValue{v},
+			TimeInterval: &monitoringpb.TimeInterval{EndTime: timestamppb.New(now.Add(-time.Duration(i) * time.Minute))},
+		})
+	}
+	return ts
+}
+
+func doubleValue(v float64) *monitoringpb.TypedValue {
+	return &monitoringpb.TypedValue{Value: &monitoringpb.TypedValue_DoubleValue{DoubleValue: v}}
+}
+
+func TestEvaluate_MetricQuery(t *testing.T) {
+	const query = "fetch spanner_instance | metric 'spanner.googleapis.com/instance/session_count' | group_by [], sum(val())"
+	cases := []struct {
+		name       string
+		series     []*monitoringpb.TimeSeriesData
+		wantAction string
+		wantPU     int32
+	}{
+		{"above scale up threshold", []*monitoringpb.TimeSeriesData{scalarSeries(doubleValue(120), doubleValue(10))}, actionScaleUp, 400},
+		{"below scale down threshold", []*monitoringpb.TimeSeriesData{scalarSeries(&monitoringpb.TypedValue{Value: &monitoringpb.TypedValue_Int64Value{Int64Value: 5}})}, actionScaleDown, 200},
+		{"within range", []*monitoringpb.TimeSeriesData{scalarSeries(doubleValue(50))}, actionNone, 300},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 300})
+			// CPU 使用率は使われません。
+			useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 50}})
+			q := &fakeQueryClient{series: tc.series}
+			useFakeQuery(t, q)
+
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000,
+				ScaleUpThreshold: 100, ScaleDownThreshold: 20, MetricQuery: query}
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q.query != query {
+				t.Errorf("query got %q", q.query)
+			}
+			if result.Action != tc.wantAction || result.NewPU != tc.wantPU {
+				t.Errorf("got action=%s newPU=%d want action=%s newPU=%d", result.Action, result.NewPU, tc.wantAction, tc.wantPU)
+			}
+			if result.Diagnostics.MetricSource != metricSourceQuery {
+				t.Errorf("metric source got %s", result.Diagnostics.MetricSource)
+			}
+		})
+	}
+}
+
+func TestGetMetricQueryValue_NotScalar(t *testing.T) {
+	cases := []struct {
+		name   string
+		series []*monitoringpb.TimeSeriesData
+	}{
+		{"multiple series", []*monitoringpb.TimeSeriesData{scalarSeries(doubleValue(1)), scalarSeries(doubleValue(2))}},
+		{"multiple values", []*monitoringpb.TimeSeriesData{{PointData: []*monitoringpb.TimeSeriesData_PointData{{Values: []*monitoringpb.TypedValue{doubleValue(1), doubleValue(2)}}}}}},
+		{"non-numeric", []*monitoringpb.TimeSeriesData{scalarSeries(&monitoringpb.TypedValue{Value: &monitoringpb.TypedValue_StringValue{StringValue: "x"}})}},
+		{"no series", nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			useFakeQuery(t, &fakeQueryClient{series: tc.series})
+			if _, err := getMetricQueryValue(context.Background(), "p", "q"); !errors.Is(err, errNotScalar) {
+				t.Errorf("got %v want %v", err, errNotScalar)
+			}
+		})
+	}
+}
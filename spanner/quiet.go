@@ -0,0 +1,35 @@
+package spanner
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const reasonAwaitingQuietPeriod = "awaiting_quiet_period"
+
+// awaitsQuietPeriod は最後のスケールアップから QuietPeriodMinutes が経過していないかどうかです。
+func (c *AutoscalerConfig) awaitsQuietPeriod(state instanceState, now time.Time) bool {
+	quiet := time.Duration(c.QuietPeriodMinutes * float64(time.Minute))
+	return quiet > 0 && !state.LastScaledUp.IsZero() && now.Sub(state.LastScaledUp) < quiet
+}
+
+// deferForQuietPeriod は最後のスケールアップから QuietPeriodMinutes が経過していなければ、
+// スケールダウンしない理由を result に設定して true を返します。cooldown とは別に判断します。
+func deferForQuietPeriod(ctx context.Context, config AutoscalerConfig, state instanceState, now time.Time, result *ScaleResult) bool {
+	waiting := config.awaitsQuietPeriod(state, now)
+	if config.QuietPeriodMinutes > 0 {
+		inputs := map[string]any{"quietPeriodMinutes": config.QuietPeriodMinutes}
+		if !state.LastScaledUp.IsZero() {
+			inputs["secondsSinceLastScaleUp"] = now.Sub(state.LastScaledUp).Seconds()
+		}
+		result.trace("quiet_period", traceOutcome(waiting), inputs)
+	}
+	if !waiting {
+		return false
+	}
+	logf(ctx, "Skipping scale down until %s after the last scale up.", time.Duration(config.QuietPeriodMinutes*float64(time.Minute)))
+	result.Reason = reasonAwaitingQuietPeriod
+	result.Message = fmt.Sprintf("CPU usage is low, but the last scale up was %s ago, within the quiet period.", now.Sub(state.LastScaledUp).Round(time.Second))
+	return true
+}
@@ -0,0 +1,76 @@
+package spanner
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEvaluate_QuietPeriod(t *testing.T) {
+	cases := []struct {
+		name         string
+		lastScaledUp time.Duration
+		minimizeCost bool
+		wantAction   string
+		wantReason   string
+	}{
+		{"recent scale up", 10 * time.Minute, false, actionNone, reasonAwaitingQuietPeriod},
+		{"recent scale up with minimizeCost", 10 * time.Minute, true, actionNone, reasonAwaitingQuietPeriod},
+		{"old scale up", 2 * time.Hour, false, actionScaleDown, reasonCPUBelowThreshold},
+		{"never scaled up", 0, false, actionScaleDown, reasonCPUBelowThreshold},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			const name = "projects/p/instances/a"
+			admin := newFakeInstanceAdmin(map[string]int32{name: 500})
+			useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 10}})
+			if tc.lastScaledUp > 0 {
+				updateState(name, func(s *instanceState) {
+					s.LastScaledUp = time.Now().Add(-tc.lastScaledUp)
+					// 最後のリサイズからは cooldown 以上経過しています。
+					s.LastResized = time.Now().Add(-2 * time.Hour)
+				})
+			}
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000, QuietPeriodMinutes: 60, MinimizeCost: tc.minimizeCost}
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Action != tc.wantAction || result.Reason != tc.wantReason {
+				t.Errorf("got action=%s reason=%s want action=%s reason=%s", result.Action, result.Reason, tc.wantAction, tc.wantReason)
+			}
+		})
+	}
+}
+
+func TestApply_RecordsLastScaledUp(t *testing.T) {
+	const name = "projects/p/instances/a"
+	admin := newFakeInstanceAdmin(map[string]int32{name: 100})
+	metrics := &fakeMetricClient{cpu: map[string]float64{"a": 90}}
+	useFakes(t, admin, metrics)
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000, QuietPeriodMinutes: 60, CooldownBaseMinutes: 1}
+	config.applyDefaults()
+	run := func() *ScaleResult {
+		t.Helper()
+		result, err := evaluate(context.Background(), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := apply(context.Background(), result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	run()
+	if loadState(name).LastScaledUp.IsZero() {
+		t.Fatal("last scale up was not recorded")
+	}
+	// cooldown が過ぎても quiet period の間はスケールダウンしません。
+	updateState(name, func(s *instanceState) { s.LastResized = time.Now().Add(-5 * time.Minute) })
+	metrics.cpu["a"] = 10
+	if result := run(); result.Reason != reasonAwaitingQuietPeriod {
+		t.Errorf("reason got %s want %s", result.Reason, reasonAwaitingQuietPeriod)
+	}
+}
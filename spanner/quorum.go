@@ -0,0 +1,68 @@
+package spanner
+
+import (
+	"context"
+	"time"
+)
+
+const reasonNoMetricQuorum = "no_metric_quorum"
+
+// MetricQuorum reads the metric several times in one invocation and acts only when
+// enough of the reads agree on the scaling direction.
+type MetricQuorum struct {
+	// Reads はメトリクスを読み取る回数です。最初の読み取りも含みます。
+	Reads int `json:"reads"`
+	// Quorum はスケーリングするために同じ向きを示す必要がある読み取りの数です。デフォルトは過半数です。
+	Quorum int `json:"quorum"`
+	// IntervalSeconds は読み取りの間隔です。デフォルトは 2 秒です。
+	IntervalSeconds float64 `json:"intervalSeconds"`
+}
+
+func (q *MetricQuorum) applyDefaults() {
+	if q.Quorum == 0 {
+		q.Quorum = q.Reads/2 + 1
+	}
+	if q.IntervalSeconds == 0 {
+		q.IntervalSeconds = 2
+	}
+}
+
+// readQuorum は first に続けて IntervalSeconds ごとにメトリクスを読み取り、first を含むすべての値を返します。
+// ctx の deadline までに次の読み取りを待てない場合は、それまでに読み取った値だけを返します。
+func readQuorum(ctx context.Context, config AutoscalerConfig, result *ScaleResult, first float64) ([]float64, error) {
+	q := config.MetricQuorum
+	interval := time.Duration(q.IntervalSeconds * float64(time.Second))
+	reads := []float64{first}
+	for len(reads) < q.Reads {
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < interval {
+			logf(ctx, "Stopping metric reads at %d of %d due to the request deadline.", len(reads), q.Reads)
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, &autoscaleError{message: "Failed to read metrics for quorum.", err: ctx.Err()}
+		case <-time.After(interval):
+		}
+		reading, err := readMetric(ctx, config, result)
+		if err != nil {
+			return nil, err
+		}
+		reads = append(reads, reading.Usage)
+	}
+	return reads, nil
+}
+
+// quorumAgrees は reads のうち Quorum 個以上が direction と同じ向きを示しているかを返します。
+// metricQuorum を指定していない場合と、direction がスケーリングを求めていない場合は常に true です。
+func quorumAgrees(config AutoscalerConfig, direction string, reads []float64) bool {
+	if config.MetricQuorum == nil || direction == directionNone {
+		return true
+	}
+	var agree int
+	for _, v := range reads {
+		if cpuEvaluation(config, v).Direction == direction {
+			agree++
+		}
+	}
+	return agree >= config.MetricQuorum.Quorum
+}
@@ -0,0 +1,62 @@
+package spanner
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEvaluate_MetricQuorum(t *testing.T) {
+	cases := []struct {
+		name       string
+		reads      []float64
+		quorum     int
+		wantAction string
+		wantReason string
+	}{
+		{"all reads agree", []float64{90, 80, 85}, 0, actionScaleUp, reasonCPUAboveThreshold},
+		{"majority agrees", []float64{90, 40, 85}, 0, actionScaleUp, reasonCPUAboveThreshold},
+		{"single spike", []float64{90, 40, 45}, 0, actionNone, reasonNoMetricQuorum},
+		{"single dip", []float64{10, 40, 45}, 0, actionNone, reasonNoMetricQuorum},
+		{"unanimity required", []float64{90, 40, 85}, 3, actionNone, reasonNoMetricQuorum},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 500})
+			useFakes(t, admin, &fakeMetricClient{reads: map[string][]float64{"a": append([]float64(nil), tc.reads...)}})
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000,
+				MetricQuorum: &MetricQuorum{Reads: 3, Quorum: tc.quorum, IntervalSeconds: 0.001}}
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Action != tc.wantAction || result.Reason != tc.wantReason {
+				t.Errorf("got action=%s reason=%s want action=%s reason=%s", result.Action, result.Reason, tc.wantAction, tc.wantReason)
+			}
+			if !reflect.DeepEqual(result.Diagnostics.QuorumReads, tc.reads) {
+				t.Errorf("quorum reads got %v want %v", result.Diagnostics.QuorumReads, tc.reads)
+			}
+		})
+	}
+}
+
+func TestEvaluate_MetricQuorumBoundedByDeadline(t *testing.T) {
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 500})
+	useFakes(t, admin, &fakeMetricClient{reads: map[string][]float64{"a": {90, 90, 90}}})
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000,
+		MetricQuorum: &MetricQuorum{Reads: 3, IntervalSeconds: 60}}
+	config.applyDefaults()
+
+	// 次の読み取りを待つと deadline を過ぎるため、1回だけ読み取って quorum に届きません。
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	result, err := evaluate(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Diagnostics.QuorumReads) != 1 || result.Reason != reasonNoMetricQuorum {
+		t.Errorf("got reads=%v reason=%s", result.Diagnostics.QuorumReads, result.Reason)
+	}
+}
@@ -0,0 +1,145 @@
+package spanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	metricSourceReference = "reference"
+
+	referenceModeCPU = "cpu"
+	referenceModePU  = "pu"
+
+	reasonMatchReference = "match_reference"
+)
+
+// ReferenceInstance sizes the configured instance from another instance,
+// e.g. to keep the green instance of a blue/green pair sized like blue.
+type ReferenceInstance struct {
+	// Project は参照するインスタンスの project です。省略した場合は設定したインスタンスと同じ project です。
+	Project  string `json:"project"`
+	Instance string `json:"instance"`
+	// Mode が cpu (デフォルト) の場合は参照するインスタンスの CPU 使用率で、pu の場合は参照するインスタンスと同じ PU になるようにスケーリングします。
+	Mode string `json:"mode"`
+}
+
+func (r *ReferenceInstance) applyDefaults(project string) {
+	if r.Project == "" {
+		r.Project = project
+	}
+	if r.Mode == "" {
+		r.Mode = referenceModeCPU
+	}
+}
+
+func (c *AutoscalerConfig) validateReferenceInstance() error {
+	r := c.ReferenceInstance
+	if r == nil {
+		return nil
+	}
+	if r.Instance == "" {
+		return errors.New("Invalid referenceInstance. instance is required.")
+	}
+	if (r.Project == "" || r.Project == c.Project) && r.Instance == c.Instance {
+		return errors.New("Invalid referenceInstance. It must be another instance.")
+	}
+	switch r.Mode {
+	case "", referenceModeCPU:
+		if c.MetricQuery != "" {
+			return errors.New("Invalid referenceInstance. It cannot be used with metricQuery.")
+		}
+	case referenceModePU:
+	default:
+		return fmt.Errorf("Invalid referenceInstance.mode %q.", r.Mode)
+	}
+	return nil
+}
+
+func (r *ReferenceInstance) instanceName() string {
+	return fmt.Sprintf("projects/%s/instances/%s", r.Project, r.Instance)
+}
+
+// checkAllowed は参照するインスタンスが allowlist にあるかを確認します。
+// discovery の template で指定した参照先は Handler で確認できないため、読み取る直前にも確認します。
+func (r *ReferenceInstance) checkAllowed() error {
+	allowlist, err := loadInstanceAllowlist()
+	if err != nil {
+		return fmt.Errorf("failed to load the instance allowlist: %w", err)
+	}
+	if !allowlist.allows(r.Project, r.Instance) {
+		return fmt.Errorf("reference instance %s/%s is not allowed in this deployment", r.Project, r.Instance)
+	}
+	return nil
+}
+
+// readReferenceCPU は参照するインスタンスの CPU 使用率を読み取ります。
+// 読み取れない場合はエラーを diagnostics に記録して nil を返し、呼び出し元は設定したインスタンス自身の CPU 使用率を使います。
+func readReferenceCPU(ctx context.Context, r *ReferenceInstance, result *ScaleResult) *metricReading {
+	if err := r.checkAllowed(); err != nil {
+		logf(ctx, "Skipping reference instance %s; using the CPU usage of %s: %v", r.instanceName(), result.label(), err)
+		result.Diagnostics.ReferenceError = err.Error()
+		return nil
+	}
+	reading, err := getSpannerCPUUsage(ctx, r.Project, r.Instance)
+	if err != nil {
+		logf(ctx, "Failed to get CPU usage of reference instance %s; using the CPU usage of %s: %v", r.instanceName(), result.label(), err)
+		result.Diagnostics.ReferenceError = err.Error()
+		return nil
+	}
+	result.Diagnostics.MetricSource = metricSourceReference
+	return reading
+}
+
+// readReferencePU は mode が pu の場合に参照するインスタンスの PU を result に記録します。
+// 読み取れない場合はエラーを diagnostics に記録し、設定したインスタンス自身のメトリクスで判断します。
+func readReferencePU(ctx context.Context, config AutoscalerConfig, result *ScaleResult) {
+	r := config.ReferenceInstance
+	if r == nil || r.Mode != referenceModePU {
+		return
+	}
+	if err := r.checkAllowed(); err != nil {
+		logf(ctx, "Skipping reference instance %s; scaling %s on its own metrics: %v", r.instanceName(), result.label(), err)
+		result.Diagnostics.ReferenceError = err.Error()
+		return
+	}
+	info, err := getCurrentCapacity(ctx, r.instanceName())
+	if err != nil {
+		logf(ctx, "Failed to get processing units of reference instance %s; scaling %s on its own metrics: %v", r.instanceName(), result.label(), err)
+		result.Diagnostics.ReferenceError = err.Error()
+		return
+	}
+	result.Diagnostics.ReferencePU = info.Capacity.ProcessingUnits
+}
+
+// matchReference は参照するインスタンスの PU を読み取れた場合に、puMin と puMax の範囲で同じ PU にする判断を result に設定して true を返します。
+// 続けてリサイズする場合は MIN_UPDATE_INTERVAL_SECONDS の間隔を空けます。
+func matchReference(ctx context.Context, config AutoscalerConfig, state instanceState, result *ScaleResult) bool {
+	target := result.Diagnostics.ReferencePU
+	if target == 0 {
+		return false
+	}
+	target = min(max(target, scaleDownFloor(config, result)), int32(config.PUMax))
+	result.trace("reference_instance", traceStop, map[string]any{"referencePU": result.Diagnostics.ReferencePU, "newPU": target})
+	result.Reason = reasonMatchReference
+	name := config.ReferenceInstance.instanceName()
+	if target == result.CurrentPU {
+		result.Message = fmt.Sprintf("Already sized like reference instance %s.", name)
+		return true
+	}
+	if !state.LastResized.IsZero() && time.Since(state.LastResized) < minUpdateInterval() {
+		logf(ctx, "Skipping resize to match the reference instance due to update rate limit.")
+		result.Reason = reasonRateLimited
+		result.Message = "Skipping resize to match the reference instance due to update rate limit."
+		return true
+	}
+	result.Action = actionScaleUp
+	if target < result.CurrentPU {
+		result.Action = actionScaleDown
+	}
+	result.NewPU = target
+	result.Message = fmt.Sprintf("Resized to %d PUs to match reference instance %s.", target, name)
+	return true
+}
@@ -0,0 +1,178 @@
+package spanner
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEvaluate_ReferenceInstanceCPU(t *testing.T) {
+	cases := []struct {
+		name       string
+		cpu        map[string]float64
+		wantAction string
+		wantSource string
+		wantErr    bool
+	}{
+		// b 自身の CPU 使用率は閾値の範囲内ですが、参照する a の CPU 使用率でスケールアップします。
+		{"reference drives scale up", map[string]float64{"a": 90, "b": 50}, actionScaleUp, metricSourceReference, false},
+		{"reference drives scale down", map[string]float64{"a": 10, "b": 50}, actionScaleDown, metricSourceReference, false},
+		// a を読み取れない場合は b 自身の CPU 使用率で判断します。
+		{"reference unavailable", map[string]float64{"b": 90}, actionScaleUp, metricSourceCPU, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 500, "projects/p/instances/b": 500})
+			useFakes(t, admin, &fakeMetricClient{cpu: tc.cpu})
+			config := AutoscalerConfig{Project: "p", Instance: "b", PUStep: 100, PUMin: 100, PUMax: 1000, ReferenceInstance: &ReferenceInstance{Instance: "a"}}
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Action != tc.wantAction || result.Diagnostics.MetricSource != tc.wantSource {
+				t.Errorf("got action=%s source=%s want action=%s source=%s", result.Action, result.Diagnostics.MetricSource, tc.wantAction, tc.wantSource)
+			}
+			if (result.Diagnostics.ReferenceError != "") != tc.wantErr {
+				t.Errorf("referenceError got %q", result.Diagnostics.ReferenceError)
+			}
+		})
+	}
+}
+
+func TestEvaluate_ReferenceInstancePU(t *testing.T) {
+	cases := []struct {
+		name        string
+		referencePU int32
+		wantAction  string
+		wantNewPU   int32
+		wantReason  string
+	}{
+		{"larger reference", 800, actionScaleUp, 800, reasonMatchReference},
+		{"smaller reference", 200, actionScaleDown, 200, reasonMatchReference},
+		{"same size", 500, actionNone, 500, reasonMatchReference},
+		{"clamped to puMax", 2000, actionScaleUp, 1000, reasonMatchReference},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": tc.referencePU, "projects/p/instances/b": 500})
+			// b 自身の CPU 使用率は判断に使いません。
+			useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 10, "b": 90}})
+			config := AutoscalerConfig{Project: "p", Instance: "b", PUStep: 100, PUMin: 100, PUMax: 1000, ReferenceInstance: &ReferenceInstance{Instance: "a", Mode: referenceModePU}}
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Action != tc.wantAction || result.NewPU != tc.wantNewPU || result.Reason != tc.wantReason {
+				t.Errorf("got action=%s newPU=%d reason=%s want action=%s newPU=%d reason=%s", result.Action, result.NewPU, result.Reason, tc.wantAction, tc.wantNewPU, tc.wantReason)
+			}
+			if result.Diagnostics.ReferencePU != tc.referencePU {
+				t.Errorf("referencePU got %d want %d", result.Diagnostics.ReferencePU, tc.referencePU)
+			}
+		})
+	}
+}
+
+func TestEvaluate_ReferenceInstancePUUnavailable(t *testing.T) {
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/b": 500})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"b": 90}})
+	config := AutoscalerConfig{Project: "p", Instance: "b", PUStep: 100, PUMin: 100, PUMax: 1000, ReferenceInstance: &ReferenceInstance{Instance: "a", Mode: referenceModePU}}
+	config.applyDefaults()
+	result, err := evaluate(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Action != actionScaleUp || result.Reason == reasonMatchReference {
+		t.Errorf("got action=%s reason=%s want a scale up on b's own CPU usage", result.Action, result.Reason)
+	}
+	if result.Diagnostics.ReferenceError == "" {
+		t.Error("referenceError is empty")
+	}
+}
+
+func TestHandler_ReferenceInstanceAuthorization(t *testing.T) {
+	t.Setenv("AUTHORIZED_CALLERS", `{"p": ["ops"]}`)
+	useFakeIDTokens(t, map[string]string{"ops-token": "scaler@ops.iam.gserviceaccount.com"})
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/b": 500, "projects/other/instances/a": 800})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90, "b": 50}})
+
+	// 呼び出し元が参照先の project を読み取ってよいかも確認します。
+	reference := `"referenceInstance": {"project": "other", "instance": "a", "mode": "pu"}`
+	cases := []struct {
+		name    string
+		path    string
+		handler http.HandlerFunc
+		body    string
+	}{
+		{"single", "/spanner/autoscaler", Handler, `{"project": "p", "instance": "b", "puStep": 100, "puMin": 100, "puMax": 1000, ` + reference + `}`},
+		{"batch", "/spanner/autoscaler/batch", BatchHandler, `{"instances": [{"project": "p", "instance": "b", "puStep": 100, "puMin": 100, "puMax": 1000, ` + reference + `}]}`},
+		{"discovery template", "/spanner/autoscaler/batch", BatchHandler, `{"discovery": {"project": "p", "template": {"puStep": 100, "puMin": 100, "puMax": 1000, ` + reference + `}}}`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Authorization", "Bearer ops-token")
+			rr := httptest.NewRecorder()
+			tc.handler(rr, req)
+			if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "project other") {
+				t.Errorf("got %d %s want 403 for project other", rr.Code, rr.Body.String())
+			}
+		})
+	}
+	if got := admin.updated(); len(got) != 0 {
+		t.Errorf("updated %v want none", got)
+	}
+}
+
+func TestReferenceInstance_Allowlist(t *testing.T) {
+	t.Setenv("ALLOWED_INSTANCES", "p/b")
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 800, "projects/p/instances/b": 500})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90, "b": 50}})
+
+	body := `{"project": "p", "instance": "b", "puStep": 100, "puMin": 100, "puMax": 1000, "referenceInstance": {"instance": "a"}}`
+	rr := httptest.NewRecorder()
+	Handler(rr, httptest.NewRequest(http.MethodPost, "/spanner/autoscaler", strings.NewReader(body)))
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "Reference instance p/a") {
+		t.Errorf("got %d %s want 403 for the reference instance", rr.Code, rr.Body.String())
+	}
+
+	// discovery の template などで Handler を通らない場合も、allowlist にない参照先は読み取りません。
+	for _, mode := range []string{referenceModeCPU, referenceModePU} {
+		config := AutoscalerConfig{Project: "p", Instance: "b", PUStep: 100, PUMin: 100, PUMax: 1000, ReferenceInstance: &ReferenceInstance{Instance: "a", Mode: mode}}
+		config.applyDefaults()
+		result, err := evaluate(context.Background(), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Diagnostics.ReferenceError == "" || result.Diagnostics.ReferencePU != 0 || result.Diagnostics.MetricSource == metricSourceReference {
+			t.Errorf("%s: got referenceError=%q referencePU=%d source=%s want the reference skipped", mode, result.Diagnostics.ReferenceError, result.Diagnostics.ReferencePU, result.Diagnostics.MetricSource)
+		}
+	}
+}
+
+func TestAutoscalerConfig_ValidateReferenceInstance(t *testing.T) {
+	cases := []struct {
+		name    string
+		config  AutoscalerConfig
+		wantErr bool
+	}{
+		{"unset", AutoscalerConfig{Project: "p", Instance: "b"}, false},
+		{"cpu", AutoscalerConfig{Project: "p", Instance: "b", ReferenceInstance: &ReferenceInstance{Instance: "a"}}, false},
+		{"pu in another project", AutoscalerConfig{Project: "p", Instance: "b", ReferenceInstance: &ReferenceInstance{Project: "q", Instance: "b", Mode: referenceModePU}}, false},
+		{"pu with metricQuery", AutoscalerConfig{Project: "p", Instance: "b", MetricQuery: "fetch x", ReferenceInstance: &ReferenceInstance{Instance: "a", Mode: referenceModePU}}, false},
+		{"missing instance", AutoscalerConfig{Project: "p", Instance: "b", ReferenceInstance: &ReferenceInstance{}}, true},
+		{"itself", AutoscalerConfig{Project: "p", Instance: "b", ReferenceInstance: &ReferenceInstance{Project: "p", Instance: "b"}}, true},
+		{"unknown mode", AutoscalerConfig{Project: "p", Instance: "b", ReferenceInstance: &ReferenceInstance{Instance: "a", Mode: "storage"}}, true},
+		{"cpu with metricQuery", AutoscalerConfig{Project: "p", Instance: "b", MetricQuery: "fetch x", ReferenceInstance: &ReferenceInstance{Instance: "a"}}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.config.validateReferenceInstance(); (err != nil) != tc.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package spanner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// remoteConfig は CONFIG_SOURCE_URL から取得するバージョン付きの閾値の設定です。
+//
+//	{"version": "v12", "thresholds": {"*": {...}, "your-project/your-instance": {...}}}
+//
+// thresholds のキーは "project/instance" で、"*" はすべてのインスタンスに適用します。
+type remoteConfig struct {
+	Version    string                      `json:"version"`
+	Thresholds map[string]remoteThresholds `json:"thresholds"`
+}
+
+// remoteThresholds は Request Body の閾値を置き換える値です。0 の項目は置き換えません。
+type remoteThresholds struct {
+	ScaleUpThreshold   float64 `json:"scaleUpThreshold"`
+	ScaleDownThreshold float64 `json:"scaleDownThreshold"`
+}
+
+// ConfigSource reports which version of the remote config drove the decision.
+type ConfigSource struct {
+	Version string `json:"version"`
+	// Stale は取得に失敗したため、最後に取得できたバージョンを使ったことを表します。
+	Stale bool `json:"stale,omitempty"`
+}
+
+// remoteConfigHTTPClient はテストで差し替えられるように変数にしています。
+var remoteConfigHTTPClient = http.DefaultClient
+
+// remoteConfigs は取得した remote config をプロセス内にキャッシュします。
+var remoteConfigs = newRemoteConfigCache()
+
+// remoteConfigTTL は remote config を取得し直すまでの期間です。
+func remoteConfigTTL() time.Duration {
+	return durationFromEnv("CONFIG_SOURCE_TTL_SECONDS", 60, time.Second)
+}
+
+// remoteConfigRetryInterval は取得に失敗してから再び取得を試みるまでの期間です。その間は最後に取得できた config を使います。
+func remoteConfigRetryInterval() time.Duration {
+	return durationFromEnv("CONFIG_SOURCE_RETRY_SECONDS", 30, time.Second)
+}
+
+// remoteConfigCache は最後に取得できた remote config を保持します。
+type remoteConfigCache struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	url     string
+	config  *remoteConfig
+	fetched time.Time
+	// retryAfter は取得に失敗した場合に、次に取得を試みる時刻です。
+	retryAfter time.Time
+	// lastErr は最後に取得に失敗した理由です。
+	lastErr error
+	// fetches は同時に TTL を過ぎた呼び出しが1回だけ取得するようにまとめます。
+	fetches singleflight.Group
+}
+
+func newRemoteConfigCache() *remoteConfigCache {
+	return &remoteConfigCache{now: time.Now}
+}
+
+// get は url の remote config を返します。TTL を過ぎていれば取得し直します。
+// 取得に失敗した場合は最後に取得できた config を stale として返し、CONFIG_SOURCE_RETRY_SECONDS の間は取得し直しません。
+// 取得できたことがなければエラーを返します。取得中は lock を持たないため、他の呼び出しを待たせません。
+func (c *remoteConfigCache) get(ctx context.Context, url string) (*remoteConfig, bool, error) {
+	c.mu.Lock()
+	if c.url == url {
+		if c.config != nil && c.now().Sub(c.fetched) < remoteConfigTTL() {
+			c.mu.Unlock()
+			return c.config, false, nil
+		}
+		if c.now().Before(c.retryAfter) {
+			config, err := c.config, c.lastErr
+			c.mu.Unlock()
+			if config != nil {
+				return config, true, nil
+			}
+			return nil, false, err
+		}
+	}
+	c.mu.Unlock()
+
+	// 取得は呼び出しをまとめて共有するため、最初の呼び出しの cancel で他の呼び出しが失敗しないようにします。
+	v, err, _ := c.fetches.Do(url, func() (any, error) {
+		return fetchRemoteConfig(context.WithoutCancel(ctx), url)
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		if c.url != url {
+			c.url, c.config = url, nil
+		}
+		c.retryAfter, c.lastErr = c.now().Add(remoteConfigRetryInterval()), err
+		if c.config != nil {
+			logf(ctx, "Failed to fetch remote config, using last known good version %s: %v", c.config.Version, err)
+			return c.config, true, nil
+		}
+		return nil, false, err
+	}
+	config := v.(*remoteConfig)
+	if c.config != nil && c.config != config && c.config.Version != config.Version {
+		logf(ctx, "Remote config version changed from %s to %s", c.config.Version, config.Version)
+	}
+	c.url, c.config, c.fetched = url, config, c.now()
+	c.retryAfter, c.lastErr = time.Time{}, nil
+	return config, false, nil
+}
+
+func fetchRemoteConfig(ctx context.Context, url string) (*remoteConfig, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := remoteConfigHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var config remoteConfig
+	if err := json.NewDecoder(resp.Body).Decode(&config); err != nil {
+		return nil, fmt.Errorf("invalid remote config: %w", err)
+	}
+	if config.Version == "" {
+		return nil, errors.New("remote config has no version")
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid remote config version %s: %w", config.Version, err)
+	}
+	return &config, nil
+}
+
+// validate は remote config の閾値の範囲を確認します。不正な config は取得の失敗として扱います。
+func (rc *remoteConfig) validate() error {
+	for key, t := range rc.Thresholds {
+		if t.ScaleUpThreshold < 0 || t.ScaleUpThreshold > 100 || t.ScaleDownThreshold < 0 || t.ScaleDownThreshold > 100 {
+			return fmt.Errorf("thresholds for %s must be between 0 and 100", key)
+		}
+		if t.ScaleUpThreshold > 0 && t.ScaleDownThreshold > 0 && t.ScaleDownThreshold >= t.ScaleUpThreshold {
+			return fmt.Errorf("scaleDownThreshold for %s must be below scaleUpThreshold", key)
+		}
+	}
+	return nil
+}
+
+// applyRemoteConfig は CONFIG_SOURCE_URL が設定されていれば、remote config の閾値で config を置き換えます。
+// 使ったバージョンは result に記録します。remote config を取得できたことがない場合や、
+// 置き換えた config が validate を通らない場合は取得の失敗として Request Body の閾値を使います。
+func applyRemoteConfig(ctx context.Context, config AutoscalerConfig, result *ScaleResult) AutoscalerConfig {
+	url := os.Getenv("CONFIG_SOURCE_URL")
+	if url == "" {
+		return config
+	}
+	rc, stale, err := remoteConfigs.get(ctx, url)
+	if err != nil {
+		logf(ctx, "Failed to fetch remote config, using thresholds in the request: %v", err)
+		result.ConfigSource = &ConfigSource{Stale: true}
+		return config
+	}
+	merged := config
+	for _, key := range []string{"*", config.Project + "/" + config.Instance} {
+		t, ok := rc.Thresholds[key]
+		if !ok {
+			continue
+		}
+		if t.ScaleUpThreshold > 0 {
+			merged.ScaleUpThreshold = t.ScaleUpThreshold
+		}
+		if t.ScaleDownThreshold > 0 {
+			merged.ScaleDownThreshold = t.ScaleDownThreshold
+		}
+	}
+	if err := validateRemoteMerge(merged); err != nil {
+		logf(ctx, "Remote config version %s is invalid for this instance, using thresholds in the request: %v", rc.Version, err)
+		result.ConfigSource = &ConfigSource{Stale: true}
+		return config
+	}
+	result.ConfigSource = &ConfigSource{Version: rc.Version, Stale: stale}
+	logf(ctx, "Using remote config version %s: scale_up_threshold=%.2f, scale_down_threshold=%.2f", rc.Version, merged.ScaleUpThreshold, merged.ScaleDownThreshold)
+	return merged
+}
+
+// validateRemoteMerge は remote config の閾値で置き換えた config を確認します。
+// "*" とインスタンスのキーを組み合わせた結果や、Request Body の panicCPUThreshold との関係はここで確認します。
+func validateRemoteMerge(config AutoscalerConfig) error {
+	if config.ScaleDownThreshold >= config.ScaleUpThreshold {
+		return errors.New("scaleDownThreshold must be below scaleUpThreshold")
+	}
+	return config.validate()
+}
@@ -0,0 +1,273 @@
+package spanner
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConfigSource は active なバージョンの config を返す versioned config source の fake です。
+type fakeConfigSource struct {
+	mu       sync.Mutex
+	versions map[string]string
+	active   string
+	fail     bool
+	// requests は受け付けたリクエストの数です。
+	requests int
+	// release を設定すると、close されるまでレスポンスを返しません。
+	release chan struct{}
+}
+
+func (s *fakeConfigSource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests++
+	release := s.release
+	s.mu.Unlock()
+	if release != nil {
+		<-release
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte(s.versions[s.active]))
+}
+
+func (s *fakeConfigSource) set(active string, fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active, s.fail = active, fail
+}
+
+func (s *fakeConfigSource) requestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func useFakeConfigSource(t *testing.T, source *fakeConfigSource) *remoteConfigCache {
+	t.Helper()
+	server := httptest.NewServer(source)
+	t.Cleanup(server.Close)
+	t.Setenv("CONFIG_SOURCE_URL", server.URL)
+	t.Setenv("CONFIG_SOURCE_TTL_SECONDS", "60")
+	t.Setenv("CONFIG_SOURCE_RETRY_SECONDS", "30")
+	orig := remoteConfigs
+	remoteConfigs = newRemoteConfigCache()
+	t.Cleanup(func() { remoteConfigs = orig })
+	return remoteConfigs
+}
+
+func TestEvaluate_RemoteConfig(t *testing.T) {
+	source := &fakeConfigSource{versions: map[string]string{
+		"v1": `{"version": "v1", "thresholds": {"*": {"scaleUpThreshold": 80, "scaleDownThreshold": 20}}}`,
+		"v2": `{"version": "v2", "thresholds": {"*": {"scaleUpThreshold": 80, "scaleDownThreshold": 20}, "p/a": {"scaleUpThreshold": 60}}}`,
+	}}
+	cache := useFakeConfigSource(t, source)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 500})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 70}})
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000}
+	config.applyDefaults()
+
+	cases := []struct {
+		name        string
+		active      string
+		fail        bool
+		wantVersion string
+		wantStale   bool
+		wantAction  string
+	}{
+		{"v1 raises the scale up threshold", "v1", false, "v1", false, actionNone},
+		{"v2 lowers it for this instance", "v2", false, "v2", false, actionScaleUp},
+		{"rollback to v1", "v1", false, "v1", false, actionNone},
+		{"fetch failure uses last known good", "v2", true, "v1", true, actionNone},
+		{"recovered", "v2", false, "v2", false, actionScaleUp},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			source.set(tc.active, tc.fail)
+			now = now.Add(time.Minute)
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.ConfigSource == nil || result.ConfigSource.Version != tc.wantVersion || result.ConfigSource.Stale != tc.wantStale {
+				t.Errorf("config source got %+v want version=%s stale=%v", result.ConfigSource, tc.wantVersion, tc.wantStale)
+			}
+			if result.Action != tc.wantAction {
+				t.Errorf("action got %s want %s", result.Action, tc.wantAction)
+			}
+		})
+	}
+}
+
+func TestEvaluate_RemoteConfigCached(t *testing.T) {
+	source := &fakeConfigSource{versions: map[string]string{
+		"v1": `{"version": "v1", "thresholds": {}}`,
+		"v2": `{"version": "v2", "thresholds": {}}`,
+	}, active: "v1"}
+	useFakeConfigSource(t, source)
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 500})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 40}})
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000}
+	config.applyDefaults()
+
+	if _, err := evaluate(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	// TTL の間は取得し直しません。
+	source.set("v2", false)
+	result, err := evaluate(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := result.ConfigSource.Version; got != "v1" {
+		t.Errorf("version got %s want v1", got)
+	}
+}
+
+func TestEvaluate_RemoteConfigNeverFetched(t *testing.T) {
+	source := &fakeConfigSource{fail: true}
+	useFakeConfigSource(t, source)
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 500})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 70}})
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000}
+	config.applyDefaults()
+
+	// 取得できたことがなければ Request Body の閾値で判断します。
+	result, err := evaluate(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ConfigSource == nil || !result.ConfigSource.Stale || result.Action != actionScaleUp {
+		t.Errorf("got config source=%+v action=%s", result.ConfigSource, result.Action)
+	}
+}
+
+func TestRemoteConfigCache_RetryAfterFailure(t *testing.T) {
+	source := &fakeConfigSource{versions: map[string]string{
+		"v1": `{"version": "v1", "thresholds": {}}`,
+	}, active: "v1"}
+	cache := useFakeConfigSource(t, source)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	url := os.Getenv("CONFIG_SOURCE_URL")
+	ctx := context.Background()
+
+	if _, _, err := cache.get(ctx, url); err != nil {
+		t.Fatal(err)
+	}
+	source.set("v1", true)
+	now = now.Add(time.Minute)
+	for i := 0; i < 3; i++ {
+		rc, stale, err := cache.get(ctx, url)
+		if err != nil || rc.Version != "v1" || !stale {
+			t.Fatalf("got %v, stale=%v, %v want stale v1", rc, stale, err)
+		}
+	}
+	// 失敗してから CONFIG_SOURCE_RETRY_SECONDS の間は取得し直しません。
+	if got := source.requestCount(); got != 2 {
+		t.Errorf("requests got %d want 2", got)
+	}
+	now = now.Add(30 * time.Second)
+	if _, _, err := cache.get(ctx, url); err != nil {
+		t.Fatal(err)
+	}
+	if got := source.requestCount(); got != 3 {
+		t.Errorf("requests after the retry interval got %d want 3", got)
+	}
+}
+
+func TestRemoteConfigCache_ConcurrentFetch(t *testing.T) {
+	source := &fakeConfigSource{versions: map[string]string{
+		"v1": `{"version": "v1", "thresholds": {}}`,
+	}, active: "v1", release: make(chan struct{})}
+	cache := useFakeConfigSource(t, source)
+	url := os.Getenv("CONFIG_SOURCE_URL")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := cache.get(context.Background(), url)
+			errs <- err
+		}()
+	}
+	// 取得中も lock を持たないため、他の呼び出しは同じ取得を待ちます。
+	for source.requestCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(source.release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := source.requestCount(); got != 1 {
+		t.Errorf("requests got %d want 1", got)
+	}
+}
+
+func TestEvaluate_RemoteConfigInvalid(t *testing.T) {
+	source := &fakeConfigSource{versions: map[string]string{
+		"v1":      `{"version": "v1", "thresholds": {"*": {"scaleUpThreshold": 60}}}`,
+		"bad":     `{"version": "bad", "thresholds": {"*": {"scaleUpThreshold": 30, "scaleDownThreshold": 50}}}`,
+		"range":   `{"version": "range", "thresholds": {"*": {"scaleUpThreshold": 150}}}`,
+		"crossed": `{"version": "crossed", "thresholds": {"*": {"scaleDownThreshold": 65}}}`,
+		"panic":   `{"version": "panic", "thresholds": {"p/a": {"scaleUpThreshold": 95}}}`,
+	}}
+	cache := useFakeConfigSource(t, source)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 500})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 40}})
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000, PanicCPUThreshold: 90}
+	config.applyDefaults()
+
+	cases := []struct {
+		name        string
+		active      string
+		wantVersion string
+		wantStale   bool
+		wantUp      float64
+	}{
+		{"valid", "v1", "v1", false, 60},
+		// 不正な payload は取得の失敗として最後に取得できたバージョンを使います。
+		{"scale down above scale up", "bad", "v1", true, 60},
+		{"out of range", "range", "v1", true, 60},
+		// 置き換えた結果が不正な場合は Request Body の閾値を使います。
+		{"crossed with the request", "crossed", "", true, config.ScaleUpThreshold},
+		{"above panic threshold", "panic", "", true, config.ScaleUpThreshold},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			source.set(tc.active, false)
+			now = now.Add(time.Minute)
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.ConfigSource == nil || result.ConfigSource.Version != tc.wantVersion || result.ConfigSource.Stale != tc.wantStale {
+				t.Errorf("config source got %+v want version=%s stale=%v", result.ConfigSource, tc.wantVersion, tc.wantStale)
+			}
+			if got := result.config.ScaleUpThreshold; got != tc.wantUp {
+				t.Errorf("scaleUpThreshold got %v want %v", got, tc.wantUp)
+			}
+		})
+	}
+}
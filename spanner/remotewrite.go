@@ -0,0 +1,187 @@
+package spanner
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// remoteWriteSample は Prometheus remote-write で送る1つの time series のサンプルです。
+type remoteWriteSample struct {
+	// Labels は __name__ を含む label です。
+	Labels    map[string]string
+	Value     float64
+	Timestamp time.Time
+}
+
+const (
+	remoteWriteQueueSize = 1000
+	remoteWriteMaxBatch  = 500
+	remoteWriteRetries   = 3
+)
+
+var (
+	// remoteWriteHTTPClient と remoteWriteRetryBackoff はテストで差し替えられるように変数にしています。
+	remoteWriteHTTPClient   = http.DefaultClient
+	remoteWriteRetryBackoff = time.Second
+
+	remoteWriteQueue = make(chan remoteWriteSample, remoteWriteQueueSize)
+	remoteWriteStart sync.Once
+)
+
+// pushDecision は PROMETHEUS_REMOTE_WRITE_URL が設定されていれば、result のサンプルを remote-write の送信待ちに追加します。
+// 送信はバックグラウンドでまとめて行うため、判断の処理を待たせません。送信待ちが溢れた場合は捨てます。
+func pushDecision(ctx context.Context, result *ScaleResult) {
+	if os.Getenv("PROMETHEUS_REMOTE_WRITE_URL") == "" {
+		return
+	}
+	remoteWriteStart.Do(func() { go runRemoteWriter() })
+	for _, s := range decisionSamples(result, time.Now()) {
+		select {
+		case remoteWriteQueue <- s:
+		default:
+			logf(ctx, "Dropping remote-write samples of %s because the queue is full", result.Instance)
+			return
+		}
+	}
+}
+
+// decisionSamples は result の CPU 使用率と判断後の PU のサンプルを返します。
+func decisionSamples(result *ScaleResult, now time.Time) []remoteWriteSample {
+	labels := func(name string) map[string]string {
+		return map[string]string{
+			"__name__": name,
+			"project":  result.Project,
+			"instance": result.Instance,
+			"action":   result.Action,
+		}
+	}
+	return []remoteWriteSample{
+		{Labels: labels("autoscaler_cpu_usage"), Value: result.CPUUsage, Timestamp: now},
+		{Labels: labels("autoscaler_processing_units"), Value: float64(result.NewPU), Timestamp: now},
+	}
+}
+
+// runRemoteWriter は送信待ちのサンプルを remoteWriteMaxBatch 件までまとめて送ります。
+func runRemoteWriter() {
+	for s := range remoteWriteQueue {
+		batch := []remoteWriteSample{s}
+	drain:
+		for len(batch) < remoteWriteMaxBatch {
+			select {
+			case s := <-remoteWriteQueue:
+				batch = append(batch, s)
+			default:
+				break drain
+			}
+		}
+		if err := sendRemoteWrite(os.Getenv("PROMETHEUS_REMOTE_WRITE_URL"), batch); err != nil {
+			log.Printf("Failed to send %d remote-write samples: %v", len(batch), err)
+		}
+	}
+}
+
+// sendRemoteWrite は batch を url に送ります。5xx とネットワークのエラーは remoteWriteRetries 回まで再試行します。
+func sendRemoteWrite(url string, batch []remoteWriteSample) error {
+	if url == "" {
+		return nil
+	}
+	body := snappyEncode(encodeWriteRequest(batch))
+	var err error
+	for attempt := 0; attempt <= remoteWriteRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * remoteWriteRetryBackoff)
+		}
+		var retry bool
+		if retry, err = postRemoteWrite(url, body); err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+// postRemoteWrite は body を POST し、失敗した場合は再試行してよいかを返します。
+func postRemoteWrite(url string, body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), readTimeout())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	resp, err := remoteWriteHTTPClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode/100 == 5, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return false, nil
+}
+
+// encodeWriteRequest は samples を prometheus.WriteRequest の protobuf にエンコードします。
+// label は remote-write の仕様どおり名前の順に並べます。
+func encodeWriteRequest(samples []remoteWriteSample) []byte {
+	var b []byte
+	for _, s := range samples {
+		var ts []byte
+		names := make([]string, 0, len(s.Labels))
+		for name := range s.Labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			var l []byte
+			l = protowire.AppendTag(l, 1, protowire.BytesType)
+			l = protowire.AppendString(l, name)
+			l = protowire.AppendTag(l, 2, protowire.BytesType)
+			l = protowire.AppendString(l, s.Labels[name])
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, l)
+		}
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.Value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(s.Timestamp.UnixMilli()))
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sample)
+
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, ts)
+	}
+	return b
+}
+
+// snappyEncode は src を snappy の block format にします。
+// 圧縮はせず literal だけで表しますが、remote-write の受信側はそのまま展開できます。
+func snappyEncode(src []byte) []byte {
+	const maxLiteral = 1 << 16
+	dst := binary.AppendUvarint(nil, uint64(len(src)))
+	for len(src) > 0 {
+		n := min(len(src), maxLiteral)
+		if n <= 60 {
+			dst = append(dst, byte(n-1)<<2)
+		} else {
+			// tag 61 は literal の長さ - 1 を続く2バイトの little endian で表します。
+			dst = append(dst, 61<<2, byte(n-1), byte((n-1)>>8))
+		}
+		dst = append(dst, src[:n]...)
+		src = src[n:]
+	}
+	return dst
+}
@@ -0,0 +1,214 @@
+package spanner
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// snappyDecode は snappyEncode が出力する literal だけの snappy block を展開します。
+func snappyDecode(t *testing.T, src []byte) []byte {
+	t.Helper()
+	n, l := binary.Uvarint(src)
+	if l <= 0 {
+		t.Fatal("invalid snappy length")
+	}
+	src = src[l:]
+	var dst []byte
+	for len(src) > 0 {
+		tag := src[0]
+		if tag&3 != 0 {
+			t.Fatalf("unexpected snappy element %#x", tag)
+		}
+		size := int(tag>>2) + 1
+		src = src[1:]
+		if tag>>2 == 61 {
+			size = (int(src[0]) | int(src[1])<<8) + 1
+			src = src[2:]
+		}
+		dst = append(dst, src[:size]...)
+		src = src[size:]
+	}
+	if uint64(len(dst)) != n {
+		t.Fatalf("decoded %d bytes want %d", len(dst), n)
+	}
+	return dst
+}
+
+// decodeWriteRequest は prometheus.WriteRequest を remoteWriteSample に戻します。
+func decodeWriteRequest(t *testing.T, b []byte) []remoteWriteSample {
+	t.Helper()
+	fields := func(b []byte, fn func(num protowire.Number, v []byte, bits uint64)) {
+		for len(b) > 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			if n < 0 {
+				t.Fatal(protowire.ParseError(n))
+			}
+			b = b[n:]
+			switch typ {
+			case protowire.BytesType:
+				v, n := protowire.ConsumeBytes(b)
+				fn(num, v, 0)
+				b = b[n:]
+			case protowire.Fixed64Type:
+				v, n := protowire.ConsumeFixed64(b)
+				fn(num, nil, v)
+				b = b[n:]
+			case protowire.VarintType:
+				v, n := protowire.ConsumeVarint(b)
+				fn(num, nil, v)
+				b = b[n:]
+			default:
+				t.Fatalf("unexpected wire type %d", typ)
+			}
+		}
+	}
+	var samples []remoteWriteSample
+	fields(b, func(_ protowire.Number, ts []byte, _ uint64) {
+		s := remoteWriteSample{Labels: map[string]string{}}
+		var prev string
+		fields(ts, func(num protowire.Number, v []byte, _ uint64) {
+			switch num {
+			case 1:
+				var name, value string
+				fields(v, func(num protowire.Number, v []byte, _ uint64) {
+					if num == 1 {
+						name = string(v)
+					} else {
+						value = string(v)
+					}
+				})
+				if name < prev {
+					t.Errorf("label %s is not sorted after %s", name, prev)
+				}
+				prev = name
+				s.Labels[name] = value
+			case 2:
+				fields(v, func(num protowire.Number, _ []byte, bits uint64) {
+					if num == 1 {
+						s.Value = math.Float64frombits(bits)
+					} else {
+						s.Timestamp = time.UnixMilli(int64(bits))
+					}
+				})
+			}
+		})
+		samples = append(samples, s)
+	})
+	return samples
+}
+
+func TestPushDecision(t *testing.T) {
+	bodies := make(chan *http.Request, 1)
+	payloads := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies <- r
+		payloads <- b
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("PROMETHEUS_REMOTE_WRITE_URL", srv.URL)
+
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 100})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90}})
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000}
+	config.applyDefaults()
+	start := time.Now().Truncate(time.Millisecond)
+	result, err := evaluate(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := apply(context.Background(), result); err != nil {
+		t.Fatal(err)
+	}
+
+	var r *http.Request
+	var payload []byte
+	select {
+	case r = <-bodies:
+		payload = <-payloads
+	case <-time.After(5 * time.Second):
+		t.Fatal("no remote-write request was sent")
+	}
+	for key, want := range map[string]string{
+		"Content-Type":                      "application/x-protobuf",
+		"Content-Encoding":                  "snappy",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+	} {
+		if got := r.Header.Get(key); got != want {
+			t.Errorf("%s got %q want %q", key, got, want)
+		}
+	}
+
+	samples := decodeWriteRequest(t, snappyDecode(t, payload))
+	want := map[string]float64{"autoscaler_cpu_usage": 90, "autoscaler_processing_units": 200}
+	if len(samples) != len(want) {
+		t.Fatalf("samples got %+v", samples)
+	}
+	for _, s := range samples {
+		name := s.Labels["__name__"]
+		if v, ok := want[name]; !ok || s.Value != v {
+			t.Errorf("%s got %v want %v", name, s.Value, want[name])
+		}
+		if s.Labels["project"] != "p" || s.Labels["instance"] != "a" || s.Labels["action"] != actionScaleUp {
+			t.Errorf("%s labels got %v", name, s.Labels)
+		}
+		if s.Timestamp.Before(start) || s.Timestamp.After(time.Now()) {
+			t.Errorf("%s timestamp got %v", name, s.Timestamp)
+		}
+	}
+}
+
+func TestSendRemoteWrite_Retry(t *testing.T) {
+	orig := remoteWriteRetryBackoff
+	remoteWriteRetryBackoff = 0
+	t.Cleanup(func() { remoteWriteRetryBackoff = orig })
+
+	cases := []struct {
+		name      string
+		statuses  []int
+		wantCalls int
+		wantErr   bool
+	}{
+		{"success", []int{http.StatusNoContent}, 1, false},
+		{"retry server errors", []int{http.StatusServiceUnavailable, http.StatusInternalServerError, http.StatusOK}, 3, false},
+		{"give up after retries", []int{500, 500, 500, 500, 500}, remoteWriteRetries + 1, true},
+		{"do not retry client errors", []int{http.StatusBadRequest, http.StatusOK}, 1, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.statuses[calls])
+				calls++
+			}))
+			defer srv.Close()
+
+			batch := []remoteWriteSample{{Labels: map[string]string{"__name__": "x"}, Value: 1, Timestamp: time.Now()}}
+			if err := sendRemoteWrite(srv.URL, batch); (err != nil) != tc.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if calls != tc.wantCalls {
+				t.Errorf("calls got %d want %d", calls, tc.wantCalls)
+			}
+		})
+	}
+}
+
+func TestSnappyEncode_LongInput(t *testing.T) {
+	src := make([]byte, 70000)
+	for i := range src {
+		src[i] = byte(i)
+	}
+	got := snappyDecode(t, snappyEncode(src))
+	if string(got) != string(src) {
+		t.Error("decoded bytes do not match the input")
+	}
+}
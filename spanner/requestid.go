@@ -0,0 +1,41 @@
+package spanner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// requestIDHeader は呼び出しを識別する correlation ID のヘッダーです。
+const requestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+// withRequestID は r の X-Request-Id ヘッダーの値か、なければ新しく生成した UUID を correlation ID として context に設定します。
+// correlation ID はレスポンスの X-Request-Id ヘッダーにも設定します。
+func withRequestID(w http.ResponseWriter, r *http.Request) *http.Request {
+	id := r.Header.Get(requestIDHeader)
+	if id == "" {
+		id = uuid.NewString()
+	}
+	w.Header().Set(requestIDHeader, id)
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+}
+
+// requestID は ctx の correlation ID を返します。設定されていなければ空文字を返します。
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// logf は ctx の correlation ID を付けてログを出力します。
+func logf(ctx context.Context, format string, args ...any) {
+	if id := requestID(ctx); id != "" {
+		log.Printf("[request_id=%s] %s", id, fmt.Sprintf(format, args...))
+		return
+	}
+	log.Printf(format, args...)
+}
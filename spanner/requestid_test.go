@@ -0,0 +1,98 @@
+package spanner
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestHandler_RequestID(t *testing.T) {
+	var buf strings.Builder
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	cases := []struct {
+		name   string
+		header string
+	}{
+		{"echo provided header", "caller-id-123"},
+		{"generate when absent", ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf.Reset()
+			admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 100})
+			useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90}})
+
+			body := `{"project": "p", "instance": "a", "puStep": 100, "puMin": 100, "puMax": 1000}`
+			req := httptest.NewRequest(http.MethodPost, "/spanner/autoscaler", strings.NewReader(body))
+			if tc.header != "" {
+				req.Header.Set(requestIDHeader, tc.header)
+			}
+			rr := httptest.NewRecorder()
+			Handler(rr, req)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("status got %d: %s", rr.Code, rr.Body.String())
+			}
+
+			id := rr.Header().Get(requestIDHeader)
+			if tc.header != "" && id != tc.header {
+				t.Errorf("header got %q want %q", id, tc.header)
+			}
+			if tc.header == "" {
+				if _, err := uuid.Parse(id); err != nil {
+					t.Errorf("generated ID %q is not a UUID: %v", id, err)
+				}
+			}
+			var result ScaleResult
+			if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+				t.Fatal(err)
+			}
+			if result.RequestID != id {
+				t.Errorf("response requestId got %q want %q", result.RequestID, id)
+			}
+			for _, line := range []string{"Request received", "Current CPU Usage", "Scaling up a to 200 PUs"} {
+				if !strings.Contains(buf.String(), "[request_id="+id+"] "+line) {
+					t.Errorf("log line %q is not tagged with %s:\n%s", line, id, buf.String())
+				}
+			}
+			history := loadState("projects/p/instances/a").History
+			if len(history) != 1 || history[0].RequestID != id {
+				t.Errorf("history got %+v want request ID %s", history, id)
+			}
+		})
+	}
+}
+
+func TestBatchHandler_RequestID(t *testing.T) {
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 100, "projects/p/instances/b": 100})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90, "b": 40}})
+
+	body := `{"instances": [
+		{"project": "p", "instance": "a", "puStep": 100, "puMin": 100, "puMax": 1000},
+		{"project": "p", "instance": "b", "puStep": 100, "puMin": 100, "puMax": 1000}
+	]}`
+	req := httptest.NewRequest(http.MethodPost, "/spanner/autoscaler/batch", strings.NewReader(body))
+	req.Header.Set(requestIDHeader, "batch-id")
+	rr := httptest.NewRecorder()
+	BatchHandler(rr, req)
+
+	var result BatchResult
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.RequestID != "batch-id" || rr.Header().Get(requestIDHeader) != "batch-id" {
+		t.Errorf("got requestId=%q header=%q", result.RequestID, rr.Header().Get(requestIDHeader))
+	}
+	for _, res := range result.Results {
+		if res.RequestID != "batch-id" {
+			t.Errorf("%s: requestId got %q", res.Instance, res.RequestID)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package spanner
+
+import (
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// isTransient は err が Spanner や Cloud Monitoring の一時的な障害によるものかを返します。
+func isTransient(err error) bool {
+	s, ok := status.FromError(err)
+	if !ok {
+		return false
+	}
+	switch s.Code() {
+	case codes.Unavailable, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
+
+// isNoChange は UpdateInstance の err が、インスタンスが既に要求したサイズのため何も変更しなかったことによるものかを返します。
+// 外部でリサイズされた直後や、同じリクエストを再送した場合に起こります。
+func isNoChange(err error) bool {
+	return status.Code(err) == codes.AlreadyExists
+}
+
+// retryAfter は err が一時的な障害であれば、呼び出し元が再試行するまで待つべき時間を返します。
+// 連続して失敗するごとに RETRY_AFTER_BASE_SECONDS から倍にし、RETRY_AFTER_MAX_SECONDS を上限とします。
+// 一時的な障害でなければ 0 を返します。
+func retryAfter(instanceName string, err error) time.Duration {
+	if err == nil || !isTransient(err) {
+		return 0
+	}
+	var failures int
+	updateState(instanceName, func(s *instanceState) {
+		s.TransientFailures++
+		failures = s.TransientFailures
+	})
+	base := durationFromEnv("RETRY_AFTER_BASE_SECONDS", 30, time.Second)
+	max := durationFromEnv("RETRY_AFTER_MAX_SECONDS", 600, time.Second)
+	d := base
+	for i := 1; i < failures && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	if d < time.Second {
+		d = time.Second
+	}
+	return d
+}
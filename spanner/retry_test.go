@@ -0,0 +1,68 @@
+package spanner
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestHandler_RetryAfter(t *testing.T) {
+	t.Setenv("RETRY_AFTER_BASE_SECONDS", "30")
+	t.Setenv("RETRY_AFTER_MAX_SECONDS", "100")
+	cases := []struct {
+		name           string
+		err            error
+		wantStatus     []int
+		wantRetryAfter []string
+	}{
+		{
+			name:           "unavailable",
+			err:            status.Error(codes.Unavailable, "try again"),
+			wantStatus:     []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+			wantRetryAfter: []string{"30", "60", "100"},
+		},
+		{
+			name:           "resource exhausted",
+			err:            fmt.Errorf("wrapped: %w", status.Error(codes.ResourceExhausted, "quota")),
+			wantStatus:     []int{http.StatusServiceUnavailable},
+			wantRetryAfter: []string{"30"},
+		},
+		{
+			name:           "permission denied",
+			err:            status.Error(codes.PermissionDenied, "denied"),
+			wantStatus:     []int{http.StatusInternalServerError},
+			wantRetryAfter: []string{""},
+		},
+		{
+			name:           "unexpected",
+			err:            errors.New("boom"),
+			wantStatus:     []int{http.StatusInternalServerError},
+			wantRetryAfter: []string{""},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := newFakeInstanceAdmin(nil)
+			admin.getErr = tc.err
+			useFakes(t, admin, &fakeMetricClient{})
+
+			for i := range tc.wantStatus {
+				body := `{"project":"p","instance":"a","puStep":100,"puMin":100,"puMax":1000}`
+				rr := httptest.NewRecorder()
+				Handler(rr, httptest.NewRequest(http.MethodPost, "/spanner/autoscaler", strings.NewReader(body)))
+				if rr.Code != tc.wantStatus[i] {
+					t.Errorf("call %d: status got %d want %d", i, rr.Code, tc.wantStatus[i])
+				}
+				if got := rr.Header().Get("Retry-After"); got != tc.wantRetryAfter[i] {
+					t.Errorf("call %d: Retry-After got %q want %q", i, got, tc.wantRetryAfter[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package spanner
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const reasonSettling = "settling"
+
+// skipSettling は最後のリサイズから SettleSeconds が経過していなければ、スケーリングしない理由を result に設定して true を返します。
+// UpdateInstance が完了した直後は READY でも PU やメトリクスが追いついていないことがあるため、
+// cooldown と異なりスケールアップと pending の再試行も含めてリサイズしません。
+func skipSettling(ctx context.Context, config AutoscalerConfig, state instanceState, now time.Time, result *ScaleResult) bool {
+	if config.SettleSeconds <= 0 {
+		return false
+	}
+	settle := time.Duration(config.SettleSeconds * float64(time.Second))
+	settling := !state.LastResized.IsZero() && now.Sub(state.LastResized) < settle
+	inputs := map[string]any{"settleSeconds": config.SettleSeconds}
+	if !state.LastResized.IsZero() {
+		inputs["secondsSinceLastResize"] = now.Sub(state.LastResized).Seconds()
+	}
+	result.trace("settle_window", traceOutcome(settling), inputs)
+	if !settling {
+		return false
+	}
+	logf(ctx, "Skipping scaling while %s settles after the last resize.", result.label())
+	result.Reason = reasonSettling
+	result.Message = fmt.Sprintf("Skipping scaling because the last resize was %s ago, within the settle window.", now.Sub(state.LastResized).Round(time.Second))
+	return true
+}
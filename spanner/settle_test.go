@@ -0,0 +1,50 @@
+package spanner
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEvaluate_SettleWindow(t *testing.T) {
+	cases := []struct {
+		name        string
+		cpu         float64
+		lastResized time.Duration
+		pendingPU   int32
+		wantAction  string
+		wantReason  string
+	}{
+		{"scale up within the window", 90, 30 * time.Second, 0, actionNone, reasonSettling},
+		{"pending retry within the window", 40, 30 * time.Second, 800, actionNone, reasonSettling},
+		{"scale up after the window", 90, 3 * time.Minute, 0, actionScaleUp, reasonCPUAboveThreshold},
+		{"never resized", 90, 0, 0, actionScaleUp, reasonCPUAboveThreshold},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			const name = "projects/p/instances/a"
+			admin := newFakeInstanceAdmin(map[string]int32{name: 500})
+			useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": tc.cpu}})
+			updateState(name, func(s *instanceState) {
+				if tc.lastResized > 0 {
+					s.LastResized = time.Now().Add(-tc.lastResized)
+					s.LastChangePU = 100
+				}
+				s.PendingPU = tc.pendingPU
+			})
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000, SettleSeconds: 120, RetryPendingUpdates: true}
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Action != tc.wantAction || result.Reason != tc.wantReason {
+				t.Errorf("got action=%s reason=%s want action=%s reason=%s", result.Action, result.Reason, tc.wantAction, tc.wantReason)
+			}
+			// 待つ間もメトリクスは読み取ります。
+			if result.CPUUsage != tc.cpu {
+				t.Errorf("cpu got %v want %v", result.CPUUsage, tc.cpu)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package spanner
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	spannerdb "cloud.google.com/go/spanner"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+)
+
+// leaseTable は spannerLeaseBackend が lease を記録するテーブルです。LEASE_DATABASE に次の DDL で作成します。
+//
+//	CREATE TABLE AutoscalerLeases (
+//	  LeaseKey STRING(MAX) NOT NULL,
+//	  Token STRING(MAX) NOT NULL,
+//	  Expires TIMESTAMP NOT NULL,
+//	) PRIMARY KEY (LeaseKey)
+const leaseTable = "AutoscalerLeases"
+
+var leaseColumns = []string{"LeaseKey", "Token", "Expires"}
+
+// spannerLeaseBackend は Spanner のテーブルの行を lease にする leaseBackend です。
+// 複数の autoscaler のインスタンスが同じデータベースを使うことで、fleet 全体で同じインスタンスを同時に更新しないようにします。
+// 期限は各プロセスの時刻で判断するため、lease の期限は時計のずれより十分長くしてください。
+type spannerLeaseBackend struct {
+	database string
+	now      func() time.Time
+
+	mu     sync.Mutex
+	client *spannerdb.Client
+}
+
+func newSpannerLeaseBackend(database string) *spannerLeaseBackend {
+	return &spannerLeaseBackend{database: database, now: time.Now}
+}
+
+// spannerClient は最初に使う時に Spanner のクライアントを作り、以降は使い回します。
+func (b *spannerLeaseBackend) spannerClient(ctx context.Context) (*spannerdb.Client, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.client != nil {
+		return b.client, nil
+	}
+	c, err := spannerdb.NewClient(context.WithoutCancel(ctx), b.database)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spanner client for leases: %w", err)
+	}
+	b.client = c
+	return c, nil
+}
+
+func (b *spannerLeaseBackend) Acquire(ctx context.Context, key string, ttl time.Duration) (lease, error) {
+	c, err := b.spannerClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token := uuid.NewString()
+	_, err = c.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spannerdb.ReadWriteTransaction) error {
+		if _, expires, ok, err := readLease(ctx, tx, key); err != nil {
+			return err
+		} else if ok && b.now().Before(expires) {
+			return errLeaseHeld
+		}
+		return tx.BufferWrite([]*spannerdb.Mutation{
+			spannerdb.InsertOrUpdate(leaseTable, leaseColumns, []any{key, token, b.now().Add(ttl)}),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &spannerLease{backend: b, client: c, key: key, token: token}, nil
+}
+
+// readLease は key の lease の token と期限を読み取ります。行がない場合は ok が false です。
+func readLease(ctx context.Context, tx *spannerdb.ReadWriteTransaction, key string) (string, time.Time, bool, error) {
+	row, err := tx.ReadRow(ctx, leaseTable, spannerdb.Key{key}, leaseColumns[1:])
+	if spannerdb.ErrCode(err) == codes.NotFound {
+		return "", time.Time{}, false, nil
+	}
+	if err != nil {
+		return "", time.Time{}, false, err
+	}
+	var token string
+	var expires time.Time
+	if err := row.Columns(&token, &expires); err != nil {
+		return "", time.Time{}, false, err
+	}
+	return token, expires, true, nil
+}
+
+type spannerLease struct {
+	backend *spannerLeaseBackend
+	client  *spannerdb.Client
+	key     string
+	token   string
+}
+
+func (l *spannerLease) Renew(ctx context.Context, ttl time.Duration) error {
+	_, err := l.client.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spannerdb.ReadWriteTransaction) error {
+		token, expires, ok, err := readLease(ctx, tx, l.key)
+		if err != nil {
+			return err
+		}
+		if !ok || token != l.token || !l.backend.now().Before(expires) {
+			return errLeaseLost
+		}
+		return tx.BufferWrite([]*spannerdb.Mutation{
+			spannerdb.Update(leaseTable, leaseColumns, []any{l.key, l.token, l.backend.now().Add(ttl)}),
+		})
+	})
+	return err
+}
+
+func (l *spannerLease) Release(ctx context.Context) error {
+	_, err := l.client.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spannerdb.ReadWriteTransaction) error {
+		token, _, ok, err := readLease(ctx, tx, l.key)
+		if err != nil || !ok || token != l.token {
+			return err
+		}
+		return tx.BufferWrite([]*spannerdb.Mutation{spannerdb.Delete(leaseTable, spannerdb.Key{l.key})})
+	})
+	return err
+}
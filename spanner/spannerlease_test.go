@@ -0,0 +1,105 @@
+package spanner
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	spannerdb "cloud.google.com/go/spanner"
+	"cloud.google.com/go/spanner/spannertest"
+	"cloud.google.com/go/spanner/spansql"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const testLeaseDatabase = "projects/p/instances/i/databases/d"
+
+// newTestSpannerLeaseBackend は in-memory の Spanner に lease のテーブルを作り、それを使う backend を返します。
+// 同じ srv から作った backend は、別々のプロセスの autoscaler と同じように別のクライアントを使います。
+func newTestSpannerLeaseBackend(t *testing.T, srv *spannertest.Server) *spannerLeaseBackend {
+	t.Helper()
+	ctx := context.Background()
+	c, err := spannerdb.NewClient(ctx, testLeaseDatabase,
+		option.WithEndpoint(srv.Addr),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+		option.WithoutAuthentication(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	b := newSpannerLeaseBackend(testLeaseDatabase)
+	b.client = c
+	return b
+}
+
+func newTestSpannerServer(t *testing.T) *spannertest.Server {
+	t.Helper()
+	srv, err := spannertest.NewServer("localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+	ddl, err := spansql.ParseDDL("lease.sql", `CREATE TABLE AutoscalerLeases (
+		LeaseKey STRING(MAX) NOT NULL,
+		Token STRING(MAX) NOT NULL,
+		Expires TIMESTAMP NOT NULL,
+	) PRIMARY KEY (LeaseKey)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.UpdateDDL(ddl); err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
+func TestSpannerLeaseBackend(t *testing.T) {
+	srv := newTestSpannerServer(t)
+	now := time.Now()
+	clock := func() time.Time { return now }
+	first, second := newTestSpannerLeaseBackend(t, srv), newTestSpannerLeaseBackend(t, srv)
+	first.now, second.now = clock, clock
+	ctx := context.Background()
+
+	l, err := first.Acquire(ctx, "a", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 別のプロセスからは lease を取得できません。
+	if _, err := second.Acquire(ctx, "a", time.Minute); !errors.Is(err, errLeaseHeld) {
+		t.Errorf("acquire from another process got %v want %v", err, errLeaseHeld)
+	}
+	if _, err := second.Acquire(ctx, "b", time.Minute); err != nil {
+		t.Errorf("acquire of another key got %v", err)
+	}
+	now = now.Add(50 * time.Second)
+	if err := l.Renew(ctx, time.Minute); err != nil {
+		t.Errorf("renew got %v", err)
+	}
+
+	// 期限が切れた lease は他のプロセスが取得でき、元の lease は更新できません。
+	now = now.Add(2 * time.Minute)
+	taken, err := second.Acquire(ctx, "a", time.Minute)
+	if err != nil {
+		t.Fatalf("acquire after expiry got %v", err)
+	}
+	if err := l.Renew(ctx, time.Minute); !errors.Is(err, errLeaseLost) {
+		t.Errorf("renew after expiry got %v want %v", err, errLeaseLost)
+	}
+	// 失った lease を解放しても、他のプロセスの lease は残ります。
+	if err := l.Release(ctx); err != nil {
+		t.Errorf("release got %v", err)
+	}
+	if _, err := first.Acquire(ctx, "a", time.Minute); !errors.Is(err, errLeaseHeld) {
+		t.Errorf("acquire after releasing a lost lease got %v want %v", err, errLeaseHeld)
+	}
+	if err := taken.Release(ctx); err != nil {
+		t.Errorf("release got %v", err)
+	}
+	if _, err := first.Acquire(ctx, "a", time.Minute); err != nil {
+		t.Errorf("acquire after release got %v", err)
+	}
+}
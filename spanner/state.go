@@ -0,0 +1,117 @@
+package spanner
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// historyRetention は history を保持する期間です。週次の digest を作れるように1週間より少し長くしています。
+	historyRetention = 8 * 24 * time.Hour
+	// maxHistoryEntries は1インスタンスあたりに保持する history の上限です。
+	maxHistoryEntries = 20000
+)
+
+var (
+	// historyStarted はこのプロセスで history を記録し始めた時刻です。それより前の history はありません。
+	historyStarted = time.Now()
+
+	// stateStore はインスタンスごとの autoscaler の状態を保持します。
+	// このストアは複数のリクエストから同時にアクセスされるため、Mutexで保護します。
+	stateStore = struct {
+		sync.Mutex
+		m map[string]*instanceState
+	}{m: make(map[string]*instanceState)}
+)
+
+// instanceState はインスタンスごとに保持する autoscaler の状態です。
+type instanceState struct {
+	LastResized time.Time
+	// LastChangePU は最後のリサイズで変化した PU です。スケールダウンは負の値になります。
+	LastChangePU int32
+	// LastScaledUp は最後にスケールアップした時刻です。
+	LastScaledUp time.Time
+	// PendingPU は失敗したまま再試行を待っているリサイズの目標 PU です。0 の場合はありません。
+	PendingPU int32
+	// TransientFailures は連続して発生した一時的な障害の回数です。
+	TransientFailures int
+	// NoShrinkFloorPU は NoShrinkWindow に入った時点の PU です。期間外の場合は 0 です。
+	NoShrinkFloorPU int32
+	// FirstSeen は autoscaler が最初にインスタンスを見た時刻です。作成時刻が分からない場合に使います。
+	FirstSeen time.Time
+	// DriftInvocations は CPU 使用率が drift zone 内の呼び出しが続いた回数です。
+	DriftInvocations int
+	// DisplayName は最後に取得したインスタンスの表示名です。
+	DisplayName string
+	// Metric は minMetricReadIntervalSeconds を指定した場合に最後に読み取ったメトリクスです。
+	Metric  *cachedMetric
+	History []historyEntry
+}
+
+// historyEntry は1回の autoscaler の判断の記録です。
+type historyEntry struct {
+	Time               time.Time
+	CPUUsage           float64
+	CurrentPU          int32
+	NewPU              int32
+	PUMin              int32
+	PUMax              int32
+	ScaleUpThreshold   float64
+	ScaleDownThreshold float64
+	Action             string
+	Reason             string
+	// RequestID は判断した呼び出しの correlation ID です。
+	RequestID string
+}
+
+// loadState は instanceName の状態のコピーを返します。
+func loadState(instanceName string) instanceState {
+	stateStore.Lock()
+	defer stateStore.Unlock()
+	s, ok := stateStore.m[instanceName]
+	if !ok {
+		return instanceState{}
+	}
+	cp := *s
+	cp.History = append([]historyEntry(nil), s.History...)
+	return cp
+}
+
+// updateState は instanceName の状態を f で更新します。
+func updateState(instanceName string, f func(s *instanceState)) {
+	stateStore.Lock()
+	defer stateStore.Unlock()
+	s, ok := stateStore.m[instanceName]
+	if !ok {
+		s = &instanceState{}
+		stateStore.m[instanceName] = s
+	}
+	f(s)
+}
+
+// stateInstanceNames は状態を保持しているインスタンス名を返します。
+func stateInstanceNames() []string {
+	stateStore.Lock()
+	defer stateStore.Unlock()
+	names := make([]string, 0, len(stateStore.m))
+	for name := range stateStore.m {
+		names = append(names, name)
+	}
+	return names
+}
+
+// appendHistory は history に e を追加し、保持期間と上限を超えた古い記録を削除します。
+func (s *instanceState) appendHistory(e historyEntry) {
+	s.History = append(s.History, e)
+	cutoff := e.Time.Add(-historyRetention)
+	i := 0
+	for i < len(s.History) && s.History[i].Time.Before(cutoff) {
+		i++
+	}
+	if over := len(s.History) - i - maxHistoryEntries; over > 0 {
+		i += over
+	}
+	if i > 0 {
+		s.History = append([]historyEntry(nil), s.History[i:]...)
+	}
+}
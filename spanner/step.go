@@ -0,0 +1,56 @@
+package spanner
+
+import "math"
+
+// stepUp は currentPU から1ステップ スケールアップした PU を返します。PUMax での制限はしません。
+// SizeLadder を指定した場合は currentPU より大きい次の段にします。
+// ProportionalStep が有効な場合は currentPU の ProportionalStepPercent % を足し、有効な PU に切り上げます。
+func (c *AutoscalerConfig) stepUp(currentPU int32) int32 {
+	if len(c.SizeLadder) > 0 {
+		return c.ladderCeil(currentPU + 1)
+	}
+	if !c.ProportionalStep {
+		return currentPU + int32(c.PUStep)
+	}
+	pu := roundUpProcessingUnits(int32(math.Ceil(float64(currentPU) * (1 + c.ProportionalStepPercent/100))))
+	if pu <= currentPU {
+		pu = roundUpProcessingUnits(currentPU + 1)
+	}
+	return pu
+}
+
+// stepDown は currentPU から1ステップ スケールダウンした PU を返します。PUMin での制限はしません。
+// SizeLadder を指定した場合は currentPU より小さい次の段にします。
+// costTiers でインスタンスの区分に scaleDownStepMultiplier を指定した場合は、ステップにその値を掛けます。
+// ProportionalStep が有効な場合は currentPU の ProportionalStepPercent % を引いて有効な PU に切り上げ、
+// 切り上げると currentPU から変化しない場合は currentPU より1つ小さい有効な PU にします。
+func (c *AutoscalerConfig) stepDown(currentPU int32) int32 {
+	if len(c.SizeLadder) > 0 {
+		return c.ladderFloor(currentPU - 1)
+	}
+	weight := c.scaleDownStepMultiplier()
+	if !c.ProportionalStep {
+		if weight == 1 {
+			return currentPU - int32(c.PUStep)
+		}
+		return weightedStepDown(currentPU, float64(c.PUStep)*weight)
+	}
+	// 重みを掛けても 0 PU にはしません。
+	percent := min(c.ProportionalStepPercent*weight, 99)
+	return weightedStepDown(currentPU, float64(currentPU)*percent/100)
+}
+
+// roundDownProcessingUnits は pu 以下で最大の有効な Processing Unit を返します。
+// 1000 PU 以下は 100 PU 単位、それより大きい場合は 1000 PU 単位です。
+func roundDownProcessingUnits(pu int32) int32 {
+	if pu <= 0 {
+		return 0
+	}
+	if pu < 2000 {
+		if pu >= 1000 {
+			return 1000
+		}
+		return pu / 100 * 100
+	}
+	return pu / 1000 * 1000
+}
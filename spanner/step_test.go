@@ -0,0 +1,70 @@
+package spanner
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAutoscalerConfig_Step(t *testing.T) {
+	fixed := AutoscalerConfig{PUStep: 100}
+	proportional := AutoscalerConfig{PUStep: 100, ProportionalStep: true}
+	proportional.applyDefaults()
+	cases := []struct {
+		name      string
+		config    AutoscalerConfig
+		currentPU int32
+		wantUp    int32
+		wantDown  int32
+	}{
+		{"fixed small", fixed, 200, 300, 100},
+		{"fixed large", fixed, 20000, 20100, 19900},
+		{"proportional small", proportional, 200, 300, 100},
+		{"proportional 400", proportional, 400, 500, 300},
+		{"proportional 1000", proportional, 1000, 2000, 800},
+		{"proportional 2000", proportional, 2000, 3000, 1000},
+		{"proportional large", proportional, 20000, 25000, 15000},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.config.stepUp(tc.currentPU); got != tc.wantUp {
+				t.Errorf("stepUp(%d) got %d want %d", tc.currentPU, got, tc.wantUp)
+			}
+			if got := tc.config.stepDown(tc.currentPU); got != tc.wantDown {
+				t.Errorf("stepDown(%d) got %d want %d", tc.currentPU, got, tc.wantDown)
+			}
+		})
+	}
+}
+
+func TestEvaluate_ProportionalStep(t *testing.T) {
+	cases := []struct {
+		name         string
+		proportional bool
+		currentPU    int32
+		cpu          float64
+		wantNewPU    int32
+	}{
+		{"fixed step up on large instance", false, 20000, 90, 20100},
+		{"proportional step up on large instance", true, 20000, 90, 25000},
+		{"proportional step down on large instance", true, 20000, 10, 15000},
+		{"fixed step up on small instance", false, 100, 90, 200},
+		{"proportional step up on small instance", true, 100, 90, 200},
+		{"proportional step down clamped to puMin", true, 200, 10, 100},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": tc.currentPU})
+			useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": tc.cpu}})
+
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 50000, ProportionalStep: tc.proportional}
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.NewPU != tc.wantNewPU {
+				t.Errorf("newPU got %d want %d (action=%s reason=%s)", result.NewPU, tc.wantNewPU, result.Action, result.Reason)
+			}
+		})
+	}
+}
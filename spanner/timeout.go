@@ -0,0 +1,64 @@
+package spanner
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const reasonDeadlineTooClose = "deadline_too_close"
+
+// requestTimeoutHeader は呼び出し元が autoscaler に与える時間 (秒) を伝えるヘッダーです。
+const requestTimeoutHeader = "X-Request-Timeout-Seconds"
+
+// requestContext は r の context に、呼び出し元が指定した時間と REQUEST_TIMEOUT_SECONDS の小さい方のタイムアウトを設定します。
+// 呼び出し元の時間は X-Request-Timeout-Seconds ヘッダーと configSeconds の小さい方です。0 以下の値は指定なしとして扱います。
+func requestContext(r *http.Request, configSeconds float64) (context.Context, context.CancelFunc) {
+	budget := requestTimeout()
+	if d := secondsToDuration(configSeconds); d > 0 && (budget <= 0 || d < budget) {
+		budget = d
+	}
+	if v := r.Header.Get(requestTimeoutHeader); v != "" {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			logf(r.Context(), "Invalid %s: %v", requestTimeoutHeader, err)
+		} else if d := secondsToDuration(n); d > 0 && (budget <= 0 || d < budget) {
+			budget = d
+		}
+	}
+	if budget <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), budget)
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// requestTimeout はプラットフォームのリクエストのタイムアウトです。デフォルトは Cloud Run と同じ 300 秒です。
+func requestTimeout() time.Duration {
+	return durationFromEnv("REQUEST_TIMEOUT_SECONDS", 300, time.Second)
+}
+
+// minUpdateBudget は UpdateInstance を始めるために deadline までに残っている必要がある時間です。
+func minUpdateBudget() time.Duration {
+	return durationFromEnv("MIN_UPDATE_BUDGET_SECONDS", 10, time.Second)
+}
+
+// skipNearDeadline は ctx の deadline までに完了を待てそうにない場合、リサイズを取りやめて true を返します。
+// 完了を確認できないリサイズを始めると、次の呼び出しで同じリサイズを繰り返すおそれがあるためです。
+func skipNearDeadline(ctx context.Context, result *ScaleResult) bool {
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Until(deadline) >= minUpdateBudget() {
+		return false
+	}
+	logf(ctx, "Skipping resize to %d PUs because the request deadline is too close.", result.NewPU)
+	result.Action = actionNone
+	result.Reason = reasonDeadlineTooClose
+	result.Message = fmt.Sprintf("Skipped resize to %d PUs because the request deadline is too close.", result.NewPU)
+	result.NewPU = result.CurrentPU
+	return true
+}
@@ -0,0 +1,96 @@
+package spanner
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestContext(t *testing.T) {
+	t.Setenv("REQUEST_TIMEOUT_SECONDS", "300")
+	cases := []struct {
+		name          string
+		header        string
+		configSeconds float64
+		want          time.Duration
+	}{
+		{"platform default", "", 0, 300 * time.Second},
+		{"header", "30", 0, 30 * time.Second},
+		{"config", "", 20, 20 * time.Second},
+		{"smaller of header and config", "30", 20, 20 * time.Second},
+		{"larger than platform default", "600", 0, 300 * time.Second},
+		{"invalid header", "soon", 0, 300 * time.Second},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/spanner/autoscaler", nil)
+			if tc.header != "" {
+				r.Header.Set(requestTimeoutHeader, tc.header)
+			}
+			start := time.Now()
+			ctx, cancel := requestContext(r, tc.configSeconds)
+			defer cancel()
+			deadline, ok := ctx.Deadline()
+			if !ok {
+				t.Fatal("context has no deadline")
+			}
+			if got := deadline.Sub(start); got < tc.want-time.Second || got > tc.want+time.Second {
+				t.Errorf("timeout got %v want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHandler_RequestTimeoutHeaderBoundsCalls(t *testing.T) {
+	t.Setenv("READ_TIMEOUT_SECONDS", "10")
+	t.Setenv("UPDATE_TIMEOUT_SECONDS", "240")
+	t.Setenv("MIN_UPDATE_BUDGET_SECONDS", "1")
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 100})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90}})
+
+	body := `{"project": "p", "instance": "a", "puStep": 100, "puMin": 100, "puMax": 1000}`
+	req := httptest.NewRequest(http.MethodPost, "/spanner/autoscaler", strings.NewReader(body))
+	req.Header.Set(requestTimeoutHeader, "5")
+	rr := httptest.NewRecorder()
+	Handler(rr, req)
+	end := time.Now()
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status got %d: %s", rr.Code, rr.Body.String())
+	}
+	for name, deadline := range map[string]time.Time{"GetInstance": admin.getDeadline, "op.Wait": admin.waitDeadline} {
+		if deadline.IsZero() || deadline.After(end.Add(5*time.Second)) {
+			t.Errorf("%s: deadline got %v want at most 5s from the request", name, deadline)
+		}
+	}
+}
+
+func TestApply_SkipsResizeNearDeadline(t *testing.T) {
+	t.Setenv("MIN_UPDATE_BUDGET_SECONDS", "10")
+	const name = "projects/p/instances/a"
+	admin := newFakeInstanceAdmin(map[string]int32{name: 100})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90}})
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000}
+	config.applyDefaults()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := evaluate(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := apply(ctx, result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Action != actionNone || result.Reason != reasonDeadlineTooClose || result.NewPU != 100 {
+		t.Errorf("got action=%s reason=%s newPU=%d", result.Action, result.Reason, result.NewPU)
+	}
+	if got := admin.updated(); len(got) != 0 {
+		t.Errorf("updates got %v want none", got)
+	}
+	if got := loadState(name).LastResized; !got.IsZero() {
+		t.Errorf("last resized was recorded: %v", got)
+	}
+}
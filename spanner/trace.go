@@ -0,0 +1,43 @@
+package spanner
+
+const (
+	tracePass    = "pass"
+	traceStop    = "stop"
+	traceClamped = "clamped"
+)
+
+// TraceStep is one rule or guard evaluated while deciding how to scale an instance, in evaluation order.
+type TraceStep struct {
+	Rule string `json:"rule"`
+	// Inputs はルールの判断に使った値です。
+	Inputs map[string]any `json:"inputs,omitempty"`
+	// Outcome はルールの結果です。pass は次のルールに進んだこと、stop はそのルールで判断が確定したことを表します。
+	Outcome string `json:"outcome"`
+}
+
+// trace は trace を有効にした場合に、評価したルールを result.Trace に追加します。
+func (r *ScaleResult) trace(rule, outcome string, inputs map[string]any) {
+	if !r.config.Trace {
+		return
+	}
+	r.Trace = append(r.Trace, TraceStep{Rule: rule, Inputs: inputs, Outcome: outcome})
+}
+
+// traceOutcome は stop が true であれば stop を、そうでなければ pass を返します。
+func traceOutcome(stop bool) string {
+	if stop {
+		return traceStop
+	}
+	return tracePass
+}
+
+// desiredPU は evaluation のスケーリングの向きに1ステップ進めた PU を返します。
+func desiredPU(config AutoscalerConfig, e Evaluation, currentPU int32) int32 {
+	switch e.Direction {
+	case directionUp:
+		return config.stepUp(currentPU)
+	case directionDown:
+		return config.stepDown(currentPU)
+	}
+	return currentPU
+}
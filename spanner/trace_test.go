@@ -0,0 +1,97 @@
+package spanner
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestEvaluate_Trace(t *testing.T) {
+	cases := []struct {
+		name      string
+		currentPU int32
+		cpu       float64
+		config    AutoscalerConfig
+		wantRules []string
+		wantSteps map[string]TraceStep
+	}{
+		{
+			name:      "scale up",
+			currentPU: 100,
+			cpu:       90,
+			config:    AutoscalerConfig{PUStep: 100, PUMin: 100, PUMax: 1000},
+			wantRules: []string{"current_capacity", "instance_age", "metric_read", "min_sample_count", "thresholds", "evaluator:cpu", "step_up", "decision", "update", "final"},
+			wantSteps: map[string]TraceStep{
+				"evaluator:cpu": {Outcome: directionUp, Inputs: map[string]any{"value": 90.0, "permitsDown": false, "desiredPU": int32(200)}},
+				"step_up":       {Outcome: tracePass, Inputs: map[string]any{"currentPU": int32(100), "newPU": int32(200), "reason": reasonCPUAboveThreshold}},
+				"final":         {Outcome: actionScaleUp, Inputs: map[string]any{"currentPU": int32(100), "newPU": int32(200), "reason": reasonCPUAboveThreshold}},
+			},
+		},
+		{
+			name:      "scale down clamped to puMin and safe mode",
+			currentPU: 400,
+			cpu:       10,
+			config:    AutoscalerConfig{PUStep: 200, PUMin: 300, PUMax: 1000, SafeMode: true},
+			wantRules: []string{"current_capacity", "instance_age", "metric_read", "min_sample_count", "thresholds", "evaluator:cpu", "scale_down_veto", "cooldown", "step_down", "clamp_floor", "safe_mode", "decision", "update", "final"},
+			wantSteps: map[string]TraceStep{
+				"cooldown":    {Outcome: tracePass, Inputs: map[string]any{"cooldownSeconds": 1800.0}},
+				"clamp_floor": {Outcome: traceClamped, Inputs: map[string]any{"newPU": int32(200), "floor": int32(300)}},
+				"final":       {Outcome: actionScaleDown, Inputs: map[string]any{"currentPU": int32(400), "newPU": int32(300), "reason": reasonCPUBelowThreshold}},
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": tc.currentPU})
+			useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": tc.cpu}})
+			config := tc.config
+			config.Project, config.Instance, config.Trace = "p", "a", true
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := apply(context.Background(), result); err != nil {
+				t.Fatal(err)
+			}
+
+			var rules []string
+			steps := make(map[string]TraceStep)
+			for _, s := range result.Trace {
+				rules = append(rules, s.Rule)
+				steps[s.Rule] = s
+			}
+			if !reflect.DeepEqual(rules, tc.wantRules) {
+				t.Errorf("rules got %v want %v", rules, tc.wantRules)
+			}
+			for rule, want := range tc.wantSteps {
+				got := steps[rule]
+				if got.Outcome != want.Outcome {
+					t.Errorf("%s outcome got %q want %q", rule, got.Outcome, want.Outcome)
+				}
+				for k, v := range want.Inputs {
+					if got.Inputs[k] != v {
+						t.Errorf("%s input %s got %v (%T) want %v (%T)", rule, k, got.Inputs[k], got.Inputs[k], v, v)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluate_TraceDisabled(t *testing.T) {
+	admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 100})
+	useFakes(t, admin, &fakeMetricClient{cpu: map[string]float64{"a": 90}})
+	config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000}
+	config.applyDefaults()
+	result, err := evaluate(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := apply(context.Background(), result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Trace != nil {
+		t.Errorf("trace got %+v without trace enabled", result.Trace)
+	}
+}
@@ -0,0 +1,70 @@
+package spanner
+
+import (
+	"math"
+	"time"
+)
+
+// trendPoint は傾きを求めるためのデータポイントです。
+type trendPoint struct {
+	t time.Time
+	v float64
+}
+
+// trendSlope は points を最小二乗法で直線に当てはめた傾きを 1 分あたりの変化量で返します。
+// 傾きを求められない場合は 0 を返します。
+func trendSlope(points []trendPoint) float64 {
+	if len(points) < 2 {
+		return 0
+	}
+	origin := points[0].t
+	var sumX, sumY float64
+	for _, p := range points {
+		sumX += p.t.Sub(origin).Minutes()
+		sumY += p.v
+	}
+	n := float64(len(points))
+	meanX, meanY := sumX/n, sumY/n
+	var cov, varX float64
+	for _, p := range points {
+		dx := p.t.Sub(origin).Minutes() - meanX
+		cov += dx * (p.v - meanY)
+		varX += dx * dx
+	}
+	if varX == 0 {
+		return 0
+	}
+	return cov / varX
+}
+
+// preProvisionPU は PreProvisionIntervalMinutes 後の CPU 使用率の見込みが scaleUpThreshold に収まる PU を返します。
+// CPU 使用率が上昇していない場合や PreProvisionIntervalMinutes を指定していない場合は 0 を返します。
+// 見込みは result に記録します。
+func preProvisionPU(config AutoscalerConfig, result *ScaleResult) int32 {
+	slope := result.Diagnostics.TrendSlopePerMinute
+	if config.PreProvisionIntervalMinutes <= 0 || slope <= 0 || config.ScaleUpThreshold <= 0 {
+		return 0
+	}
+	projected := result.CPUUsage + slope*config.PreProvisionIntervalMinutes
+	result.Diagnostics.ProjectedCPUUsage = projected
+	return roundUpProcessingUnits(int32(math.Ceil(float64(result.CurrentPU) * projected / config.ScaleUpThreshold)))
+}
+
+// noPUMaxEstimate は CPU 使用率が上昇していないか、既に PUMax のため PUMax に達するまでの時間を見積もれないことを表します。
+const noPUMaxEstimate = -1
+
+// estimateSecondsToPUMax は CPU 使用率が今の傾きで上昇し続けた場合に、PUMax でも scaleUpThreshold を超えるまでの秒数を返します。
+// 需要は PU と CPU 使用率の積に比例するとみなし、currentPU * (cpuUsage + 傾き * t) が PUMax * scaleUpThreshold に達する t を求めます。
+// 既に超えている場合は 0 を返します。
+func estimateSecondsToPUMax(config AutoscalerConfig, result *ScaleResult) float64 {
+	slope := result.Diagnostics.TrendSlopePerMinute
+	if slope <= 0 || result.CurrentPU <= 0 || result.CurrentPU >= int32(config.PUMax) {
+		return noPUMaxEstimate
+	}
+	ceiling := float64(config.PUMax) * config.ScaleUpThreshold / float64(result.CurrentPU)
+	minutes := (ceiling - result.CPUUsage) / slope
+	if minutes < 0 {
+		return 0
+	}
+	return math.Round(minutes * 60)
+}
@@ -0,0 +1,116 @@
+package spanner
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTrendSlope(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		name   string
+		points []trendPoint
+		want   float64
+	}{
+		{"single point", []trendPoint{{now, 50}}, 0},
+		{"flat", []trendPoint{{now, 50}, {now.Add(time.Minute), 50}}, 0},
+		{"rising", []trendPoint{{now, 60}, {now.Add(time.Minute), 65}, {now.Add(2 * time.Minute), 70}}, 5},
+		{"falling", []trendPoint{{now, 70}, {now.Add(2 * time.Minute), 60}}, -5},
+		{"same timestamp", []trendPoint{{now, 60}, {now, 70}}, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := trendSlope(tc.points); math.Abs(got-tc.want) > 1e-9 {
+				t.Errorf("got %v want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEvaluate_PreProvision(t *testing.T) {
+	cases := []struct {
+		name      string
+		samples   []float64
+		currentPU int32
+		interval  float64
+		wantNewPU int32
+	}{
+		{"instantaneous sizing", []float64{70, 65, 60}, 1000, 0, 1100},
+		{"rising trend provisions for the next interval", []float64{70, 65, 60}, 1000, 5, 2000},
+		{"falling trend uses step", []float64{70, 75, 80}, 1000, 5, 1100},
+		{"projection below step uses step", []float64{51, 50.9, 50.8}, 500, 5, 600},
+		{"clamped to puMax", []float64{90, 80, 70}, 1000, 10, 3000},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": tc.currentPU})
+			useFakes(t, admin, &fakeMetricClient{samples: map[string][]float64{"a": tc.samples}})
+
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 3000, PreProvisionIntervalMinutes: tc.interval}
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Action != actionScaleUp || result.NewPU != tc.wantNewPU {
+				t.Errorf("got action=%s newPU=%d want scale_up to %d", result.Action, result.NewPU, tc.wantNewPU)
+			}
+		})
+	}
+}
+
+func TestEstimateSecondsToPUMax(t *testing.T) {
+	cases := []struct {
+		name      string
+		currentPU int32
+		cpu       float64
+		slope     float64
+		want      float64
+	}{
+		{"rising with headroom", 500, 40, 2, 1800},
+		{"faster rise", 500, 40, 6, 600},
+		{"less headroom", 800, 40, 2, 675},
+		{"already beyond ceiling", 500, 120, 2, 0},
+		{"flat", 500, 40, 0, noPUMaxEstimate},
+		{"falling", 500, 40, -2, noPUMaxEstimate},
+		{"already at max", 1000, 40, 2, noPUMaxEstimate},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := AutoscalerConfig{PUMax: 1000, ScaleUpThreshold: 50}
+			result := &ScaleResult{CurrentPU: tc.currentPU, CPUUsage: tc.cpu, Diagnostics: Diagnostics{TrendSlopePerMinute: tc.slope}}
+			if got := estimateSecondsToPUMax(config, result); got != tc.want {
+				t.Errorf("got %v want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEvaluate_EstimatedSecondsToPUMax(t *testing.T) {
+	cases := []struct {
+		name    string
+		samples []float64
+		want    float64
+	}{
+		{"rising", []float64{40, 38, 36}, 1800},
+		{"not rising", []float64{40, 40, 40}, noPUMaxEstimate},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := newFakeInstanceAdmin(map[string]int32{"projects/p/instances/a": 500})
+			useFakes(t, admin, &fakeMetricClient{samples: map[string][]float64{"a": tc.samples}})
+
+			config := AutoscalerConfig{Project: "p", Instance: "a", PUStep: 100, PUMin: 100, PUMax: 1000}
+			config.applyDefaults()
+			result, err := evaluate(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.EstimatedSecondsToPUMax != tc.want {
+				t.Errorf("got %v want %v", result.EstimatedSecondsToPUMax, tc.want)
+			}
+		})
+	}
+}